@@ -55,9 +55,12 @@ create table user (
  sysadmin_flag tinyint (1),
  creation_time timestamp,
  update_time timestamp,
+# the static ID of the user in an external identity backend
+ external_id varchar(255) DEFAULT NULL,
  primary key (user_id),
  UNIQUE (username),
- UNIQUE (email)
+ UNIQUE (email),
+ INDEX idx_external_id (external_id)
 );
 
 insert into user (username, email, password, realname, comment, deleted, sysadmin_flag, creation_time, update_time) values 
@@ -125,6 +128,14 @@ update_time timestamp default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP,
 PRIMARY KEY (id)
 );
 
+create table user_group_member
+(
+user_id int NOT NULL,
+group_id int NOT NULL,
+creation_time timestamp default CURRENT_TIMESTAMP,
+PRIMARY KEY (user_id, group_id)
+);
+
 create table access_log (
  log_id int NOT NULL AUTO_INCREMENT,
  username varchar (255) NOT NULL,
@@ -303,4 +314,4 @@ CREATE TABLE IF NOT EXISTS `alembic_version` (
     `version_num` varchar(32) NOT NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
-insert into alembic_version values ('1.5.0');
+insert into alembic_version values ('1.5.1');
@@ -52,10 +52,16 @@ create table user (
  sysadmin_flag tinyint (1),
  creation_time timestamp,
  update_time timestamp,
+/*
+ the static ID of the user in an external identity backend
+*/
+ external_id varchar(255) DEFAULT NULL,
  UNIQUE (username),
  UNIQUE (email)
 );
 
+CREATE INDEX idx_external_id ON user (external_id);
+
 insert into user (username, email, password, realname, comment, deleted, sysadmin_flag, creation_time, update_time) values 
 ('admin', 'admin@example.com', '', 'system admin', 'admin user',0, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
 ('anonymous', 'anonymous@example.com', '', 'anonymous user', 'anonymous user', 1, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
@@ -69,6 +75,13 @@ creation_time timestamp default CURRENT_TIMESTAMP,
 update_time timestamp default CURRENT_TIMESTAMP
 );
 
+create table user_group_member (
+user_id int NOT NULL,
+group_id int NOT NULL,
+creation_time timestamp default CURRENT_TIMESTAMP,
+PRIMARY KEY (user_id, group_id)
+);
+
 create table project (
  project_id INTEGER PRIMARY KEY,
  owner_id int NOT NULL,
@@ -112,6 +112,22 @@ func GetOrmer() orm.Ormer {
 	return globalOrm
 }
 
+// WithTransaction runs f in a transaction of a dedicated ormer, as the shared one of GetOrmer can't
+// hold a transaction. The transaction is committed when f succeeds and rolled back when it fails.
+func WithTransaction(f func(o orm.Ormer) error) error {
+	o := orm.NewOrm()
+	if err := o.Begin(); err != nil {
+		return err
+	}
+	if err := f(o); err != nil {
+		if rbErr := o.Rollback(); rbErr != nil {
+			log.Errorf("failed to roll back the transaction: %v", rbErr)
+		}
+		return err
+	}
+	return o.Commit()
+}
+
 // ClearTable is the shortcut for test cases, it should be called only in test cases.
 func ClearTable(table string) error {
 	o := GetOrmer()
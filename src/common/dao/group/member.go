@@ -0,0 +1,107 @@
+// Copyright (c) 2017 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package group
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// GetGroupsOfUser - Get the user groups the user is a member of
+func GetGroupsOfUser(userID int) ([]*models.UserGroup, error) {
+	o := dao.GetOrmer()
+	sql := `select g.id, g.group_name, g.group_type, g.ldap_group_dn
+		from user_group g join user_group_member m on g.id = m.group_id
+		where m.user_id = ? order by g.group_name`
+	groups := []*models.UserGroup{}
+	_, err := o.Raw(sql, userID).QueryRows(&groups)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// AddGroupMember - Add the user to the user group
+func AddGroupMember(groupID, userID int) error {
+	o := dao.GetOrmer()
+	sql := `insert into user_group_member (user_id, group_id) values (?, ?)`
+	_, err := o.Raw(sql, userID, groupID).Exec()
+	return err
+}
+
+// DeleteGroupMember - Remove the user from the user group
+func DeleteGroupMember(groupID, userID int) error {
+	o := dao.GetOrmer()
+	sql := `delete from user_group_member where user_id = ? and group_id = ?`
+	_, err := o.Raw(sql, userID, groupID).Exec()
+	return err
+}
+
+// AddGroupMembers - Add the user to the user groups in a single statement
+func AddGroupMembers(userID int, groupIDs []int) error {
+	return addGroupMembers(dao.GetOrmer(), userID, groupIDs)
+}
+
+func addGroupMembers(o orm.Ormer, userID int, groupIDs []int) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	sql := `insert into user_group_member (user_id, group_id) values ` +
+		strings.TrimSuffix(strings.Repeat("(?, ?), ", len(groupIDs)), ", ")
+	params := make([]interface{}, 0, 2*len(groupIDs))
+	for _, groupID := range groupIDs {
+		params = append(params, userID, groupID)
+	}
+	_, err := o.Raw(sql, params...).Exec()
+	return err
+}
+
+// DeleteGroupMembers - Remove the user from the user groups in a single statement
+func DeleteGroupMembers(userID int, groupIDs []int) error {
+	return deleteGroupMembers(dao.GetOrmer(), userID, groupIDs)
+}
+
+func deleteGroupMembers(o orm.Ormer, userID int, groupIDs []int) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	sql := fmt.Sprintf(`delete from user_group_member where user_id = ? and group_id in ( %s )`,
+		strings.TrimSuffix(strings.Repeat("?, ", len(groupIDs)), ", "))
+	params := make([]interface{}, 0, 1+len(groupIDs))
+	params = append(params, userID)
+	for _, groupID := range groupIDs {
+		params = append(params, groupID)
+	}
+	_, err := o.Raw(sql, params...).Exec()
+	return err
+}
+
+// UpdateGroupMembers - Remove the user from the removed user groups and add it to the added ones
+// in a single transaction, leaving its memberships intact if any statement fails
+func UpdateGroupMembers(userID int, added, removed []int) error {
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return dao.WithTransaction(func(o orm.Ormer) error {
+		if err := deleteGroupMembers(o, userID, removed); err != nil {
+			return err
+		}
+		return addGroupMembers(o, userID, added)
+	})
+}
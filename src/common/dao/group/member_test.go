@@ -0,0 +1,134 @@
+// Copyright (c) 2017 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package group
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestGroupMember(t *testing.T) {
+	user, err := dao.GetUser(models.User{Username: "member_test_01"})
+	if err != nil || user == nil {
+		t.Fatalf("Error occurred when getting user: %v", err)
+	}
+
+	groupID, err := AddUserGroup(models.UserGroup{
+		GroupName:   "member_group_01",
+		GroupType:   common.RackspaceGroupType,
+		LdapGroupDN: "member_group_01",
+	})
+	if err != nil {
+		t.Fatalf("Error occurred when adding user group: %v", err)
+	}
+	defer DeleteUserGroup(groupID)
+
+	err = AddGroupMember(groupID, user.UserID)
+	assert.Nil(t, err)
+
+	groups, err := GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "member_group_01", groups[0].GroupName)
+	}
+
+	err = DeleteGroupMember(groupID, user.UserID)
+	assert.Nil(t, err)
+
+	groups, err = GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	assert.Len(t, groups, 0)
+}
+
+func TestGroupMembersBatch(t *testing.T) {
+	user, err := dao.GetUser(models.User{Username: "member_test_01"})
+	if err != nil || user == nil {
+		t.Fatalf("Error occurred when getting user: %v", err)
+	}
+
+	var groupIDs []int
+	for _, name := range []string{"member_group_02", "member_group_03", "member_group_04"} {
+		groupID, err := AddUserGroup(models.UserGroup{
+			GroupName:   name,
+			GroupType:   common.RackspaceGroupType,
+			LdapGroupDN: name,
+		})
+		if err != nil {
+			t.Fatalf("Error occurred when adding user group: %v", err)
+		}
+		defer DeleteUserGroup(groupID)
+		groupIDs = append(groupIDs, groupID)
+	}
+
+	assert.Nil(t, AddGroupMembers(user.UserID, nil))
+	assert.Nil(t, AddGroupMembers(user.UserID, groupIDs))
+
+	groups, err := GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	assert.Len(t, groups, 3)
+
+	assert.Nil(t, DeleteGroupMembers(user.UserID, groupIDs[:2]))
+
+	groups, err = GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "member_group_04", groups[0].GroupName)
+	}
+	assert.Nil(t, DeleteGroupMembers(user.UserID, groupIDs[2:]))
+}
+
+func TestUpdateGroupMembersRollback(t *testing.T) {
+	user, err := dao.GetUser(models.User{Username: "member_test_01"})
+	if err != nil || user == nil {
+		t.Fatalf("Error occurred when getting user: %v", err)
+	}
+
+	var groupIDs []int
+	for _, name := range []string{"member_group_05", "member_group_06"} {
+		groupID, err := AddUserGroup(models.UserGroup{
+			GroupName:   name,
+			GroupType:   common.RackspaceGroupType,
+			LdapGroupDN: name,
+		})
+		if err != nil {
+			t.Fatalf("Error occurred when adding user group: %v", err)
+		}
+		defer DeleteUserGroup(groupID)
+		groupIDs = append(groupIDs, groupID)
+	}
+
+	assert.Nil(t, UpdateGroupMembers(user.UserID, groupIDs[:1], nil))
+
+	// the duplicate membership fails the insert once the delete is done, which is rolled back
+	err = UpdateGroupMembers(user.UserID, []int{groupIDs[1], groupIDs[1]}, groupIDs[:1])
+	assert.NotNil(t, err)
+	groups, err := GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "member_group_05", groups[0].GroupName)
+	}
+
+	assert.Nil(t, UpdateGroupMembers(user.UserID, groupIDs[1:], groupIDs[:1]))
+	groups, err = GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "member_group_06", groups[0].GroupName)
+	}
+	assert.Nil(t, UpdateGroupMembers(user.UserID, nil, groupIDs[1:]))
+}
@@ -86,6 +86,10 @@ func DeleteUserGroup(id int) error {
 		if err != nil {
 			return err
 		}
+		_, err = o.Raw(`delete from user_group_member where group_id = ?`, id).Exec()
+		if err != nil {
+			return err
+		}
 	}
 	return err
 }
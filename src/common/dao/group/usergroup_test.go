@@ -59,6 +59,7 @@ func TestMain(m *testing.M) {
 			"delete from user where username='member_test_01' or username='pm_sample'",
 			"delete from user_group",
 			"delete from project_member",
+			"delete from user_group_member",
 		}
 		dao.PrepareTestData(clearSqls, initSqls)
 
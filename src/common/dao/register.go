@@ -25,7 +25,7 @@ import (
 // Register is used for user to register, the password is encrypted before the record is inserted into database.
 func Register(user models.User) (int64, error) {
 	o := GetOrmer()
-	p, err := o.Raw("insert into user (username, password, realname, email, comment, salt, sysadmin_flag, creation_time, update_time) values (?, ?, ?, ?, ?, ?, ?, ?, ?)").Prepare()
+	p, err := o.Raw("insert into user (username, password, realname, email, comment, salt, sysadmin_flag, creation_time, update_time, external_id) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").Prepare()
 	if err != nil {
 		return 0, err
 	}
@@ -34,7 +34,12 @@ func Register(user models.User) (int64, error) {
 	salt := utils.GenerateRandomString()
 
 	now := time.Now()
-	r, err := p.Exec(user.Username, utils.Encrypt(user.Password, salt), user.Realname, user.Email, user.Comment, salt, user.HasAdminRole, now, now)
+	// users without an external ID have none rather than an empty one
+	var externalID interface{}
+	if user.ExternalID != "" {
+		externalID = user.ExternalID
+	}
+	r, err := p.Exec(user.Username, utils.Encrypt(user.Password, salt), user.Realname, user.Email, user.Comment, salt, user.HasAdminRole, now, now, externalID)
 
 	if err != nil {
 		return 0, err
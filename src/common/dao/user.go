@@ -33,7 +33,7 @@ func GetUser(query models.User) (*models.User, error) {
 	o := GetOrmer()
 
 	sql := `select user_id, username, email, realname, comment, reset_uuid, salt,
-		sysadmin_flag, creation_time, update_time
+		sysadmin_flag, creation_time, update_time, external_id
 		from user u
 		where deleted = 0 `
 	queryParam := make([]interface{}, 1)
@@ -62,6 +62,11 @@ func GetUser(query models.User) (*models.User, error) {
 		queryParam = append(queryParam, query.Realname)
 	}
 
+	if query.ExternalID != "" {
+		sql += ` and external_id = ? `
+		queryParam = append(queryParam, query.ExternalID)
+	}
+
 	var u []models.User
 	n, err := o.Raw(sql, queryParam).QueryRows(&u)
 
@@ -79,6 +84,39 @@ func GetUser(query models.User) (*models.User, error) {
 	return &u[0], nil
 }
 
+// GetDeletedUserByRealname returns the most recently deleted user with the realname,
+// nil if there is no such user.
+func GetDeletedUserByRealname(realname string) (*models.User, error) {
+	return getDeletedUser("realname", realname)
+}
+
+// GetDeletedUserByExternalID returns the most recently deleted user with the external ID,
+// nil if there is no such user.
+func GetDeletedUserByExternalID(externalID string) (*models.User, error) {
+	return getDeletedUser("external_id", externalID)
+}
+
+func getDeletedUser(column, value string) (*models.User, error) {
+	o := GetOrmer()
+
+	sql := `select user_id, username, email, realname, comment, deleted, reset_uuid, salt,
+		sysadmin_flag, creation_time, update_time, external_id
+		from user u
+		where deleted = 1 and ` + column + ` = ?
+		order by update_time desc, user_id desc
+		limit 1`
+	var u []models.User
+	n, err := o.Raw(sql, value).QueryRows(&u)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	return &u[0], nil
+}
+
 // LoginByDb is used for user to login with database auth mode.
 func LoginByDb(auth models.AuthModel) (*models.User, error) {
 	o := GetOrmer()
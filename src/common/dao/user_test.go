@@ -29,10 +29,11 @@ func TestDeleteUser(t *testing.T) {
 	realname := "user_for_test"
 
 	u := models.User{
-		Username: username,
-		Email:    email,
-		Password: password,
-		Realname: realname,
+		Username:   username,
+		Email:      email,
+		Password:   password,
+		Realname:   realname,
+		ExternalID: "external-" + realname,
 	}
 	id, err := Register(u)
 	if err != nil {
@@ -71,6 +72,22 @@ func TestDeleteUser(t *testing.T) {
 		t.Errorf("unexpected email: %s != %s", user.Email,
 			expected)
 	}
+
+	deleted, err := GetDeletedUserByRealname(realname)
+	if err != nil {
+		t.Fatalf("Error occurred in GetDeletedUserByRealname: %v", err)
+	}
+	if deleted == nil || deleted.UserID != int(id) || deleted.Deleted != 1 {
+		t.Errorf("unexpected deleted user: %+v", deleted)
+	}
+
+	deleted, err = GetDeletedUserByExternalID("external-" + realname)
+	if err != nil {
+		t.Fatalf("Error occurred in GetDeletedUserByExternalID: %v", err)
+	}
+	if deleted == nil || deleted.UserID != int(id) || deleted.ExternalID != "external-"+realname {
+		t.Errorf("unexpected deleted user: %+v", deleted)
+	}
 }
 
 func TestOnBoardUser(t *testing.T) {
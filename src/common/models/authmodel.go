@@ -18,4 +18,18 @@ package models
 type AuthModel struct {
 	Principal string
 	Password  string
+	// Metadata of the request the credential came with. It is optional,
+	// authenticators may use it when present but must not require it.
+	Metadata *RequestMetadata
+}
+
+// RequestMetadata describes the request an AuthModel was extracted from.
+type RequestMetadata struct {
+	ClientIP  string
+	UserAgent string
+	// TraceHeaders are the tracing headers of the request to be propagated, keyed by canonical header name.
+	TraceHeaders map[string]string
+	// ClientCertSubject is the subject of the client certificate verified during the TLS handshake,
+	// empty when the client presented none or it wasn't verified.
+	ClientCertSubject string
 }
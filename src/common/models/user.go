@@ -40,6 +40,8 @@ type User struct {
 	Salt         string    `orm:"column(salt)" json:"-"`
 	CreationTime time.Time `orm:"column(creation_time)" json:"creation_time"`
 	UpdateTime   time.Time `orm:"column(update_time)" json:"update_time"`
+	// ExternalID is the static ID of the user in an external identity backend, if any
+	ExternalID string `orm:"column(external_id);null" json:"external_id,omitempty"`
 }
 
 // UserQuery ...
@@ -0,0 +1,113 @@
+// Copyright (c) 2017 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notifiertest provides an in-memory sink of notifier topics for tests. It lives
+// outside common/utils/test as the notifier depends on packages tested with that one.
+package notifiertest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+// NotificationSink records the values published to the notifier topics it subscribes to,
+// so tests can assert which notifications were emitted. Only one sink can subscribe to a
+// topic at a time, Close it when the test is done.
+type NotificationSink struct {
+	sync.Mutex
+	topics   []string
+	values   map[string][]interface{}
+	received chan struct{}
+}
+
+// sinkHandler is the notifier.NotificationHandler of a sink for one topic
+type sinkHandler struct {
+	sink  *NotificationSink
+	topic string
+}
+
+// Handle ...
+func (h *sinkHandler) Handle(value interface{}) error {
+	h.sink.record(h.topic, value)
+	return nil
+}
+
+// IsStateful ...
+func (h *sinkHandler) IsStateful() bool {
+	return false
+}
+
+// NewNotificationSink returns a sink subscribed to the topics
+func NewNotificationSink(topics ...string) (*NotificationSink, error) {
+	s := &NotificationSink{
+		values:   make(map[string][]interface{}),
+		received: make(chan struct{}, 1),
+	}
+	for _, topic := range topics {
+		if err := notifier.Subscribe(topic, &sinkHandler{sink: s, topic: topic}); err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.topics = append(s.topics, topic)
+	}
+	return s, nil
+}
+
+// Close unsubscribes the sink from its topics
+func (s *NotificationSink) Close() {
+	handler := reflect.TypeOf(&sinkHandler{}).String()
+	for _, topic := range s.topics {
+		notifier.UnSubscribe(topic, handler)
+	}
+	s.topics = nil
+}
+
+func (s *NotificationSink) record(topic string, value interface{}) {
+	s.Lock()
+	s.values[topic] = append(s.values[topic], value)
+	s.Unlock()
+
+	select {
+	case s.received <- struct{}{}:
+	default:
+	}
+}
+
+// Values returns the values received so far on the topic, in arrival order
+func (s *NotificationSink) Values(topic string) []interface{} {
+	s.Lock()
+	defer s.Unlock()
+	return append([]interface{}{}, s.values[topic]...)
+}
+
+// Wait returns the values of the topic once at least count of them are received.
+// As the notifier delivers notifications asynchronously, tests should wait rather than
+// read the Values right after publishing.
+func (s *NotificationSink) Wait(topic string, count int, timeout time.Duration) ([]interface{}, error) {
+	deadline := time.After(timeout)
+	for {
+		if values := s.Values(topic); len(values) >= count {
+			return values, nil
+		}
+		select {
+		case <-s.received:
+		case <-deadline:
+			return nil, fmt.Errorf("received %d notifications of topic %s in %v, expected %d", len(s.Values(topic)), topic, timeout, count)
+		}
+	}
+}
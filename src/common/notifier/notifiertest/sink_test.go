@@ -0,0 +1,48 @@
+// Copyright (c) 2017 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifiertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+func TestNotificationSink(t *testing.T) {
+	sink, err := NewNotificationSink(notifier.UserOnboardedTopic, notifier.UserRenamedTopic)
+	require.Nil(t, err)
+
+	onboarded := notifier.UserOnboardedNotification{UserID: 1, Username: "alice", Reason: notifier.ReasonFirstLogin}
+	require.Nil(t, notifier.Publish(notifier.UserOnboardedTopic, onboarded))
+
+	values, err := sink.Wait(notifier.UserOnboardedTopic, 1, time.Second)
+	require.Nil(t, err)
+	assert.Equal(t, []interface{}{onboarded}, values)
+	assert.Empty(t, sink.Values(notifier.UserRenamedTopic))
+
+	_, err = sink.Wait(notifier.UserRenamedTopic, 1, 10*time.Millisecond)
+	assert.NotNil(t, err)
+
+	// a closed sink stops receiving, and the topics can be subscribed again
+	sink.Close()
+	assert.NotNil(t, notifier.Publish(notifier.UserOnboardedTopic, onboarded))
+
+	sink, err = NewNotificationSink(notifier.UserOnboardedTopic)
+	require.Nil(t, err)
+	sink.Close()
+}
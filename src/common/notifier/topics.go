@@ -8,4 +8,22 @@ import (
 const (
 	//ScanAllPolicyTopic is for notifying the change of scanning all policy.
 	ScanAllPolicyTopic = common.ScanAllPolicy
+
+	//UserOnboardedTopic is for notifying a user is created on first login by an external auth provider.
+	UserOnboardedTopic = "OnBoardUser"
+
+	//UserRenamedTopic is for notifying a user is renamed by an external auth provider.
+	UserRenamedTopic = "RenameUser"
+
+	//GroupMembershipChangedTopic is for notifying the groups of a user are changed by an external auth provider.
+	GroupMembershipChangedTopic = "ChangeGroupMembership"
+
+	//UserDeletedTopic is for notifying a user is deleted in Harbor.
+	UserDeletedTopic = "DeleteUser"
+
+	//LoginSucceededTopic is for notifying a user authenticated successfully with an external auth provider.
+	LoginSucceededTopic = "LoginSucceeded"
+
+	//BackendHealthChangedTopic is for notifying an external auth backend became unhealthy or healthy again.
+	BackendHealthChangedTopic = "BackendHealthChanged"
 )
@@ -0,0 +1,94 @@
+package notifier
+
+//OnboardReason tells what triggered an onboarding related notification.
+type OnboardReason string
+
+const (
+	//ReasonFirstLogin means the user logged in for the first time.
+	ReasonFirstLogin OnboardReason = "first_login"
+
+	//ReasonUsernameChange means the username changed in the auth backend.
+	ReasonUsernameChange OnboardReason = "username_change"
+
+	//ReasonGroupChange means the group membership changed in the auth backend.
+	ReasonGroupChange OnboardReason = "group_change"
+
+	//ReasonReactivated means a user deleted in Harbor logged in again and was restored.
+	ReasonReactivated OnboardReason = "reactivated"
+
+	//ReasonUsernameConflict means the user was renamed to free its username for another user.
+	ReasonUsernameConflict OnboardReason = "username_conflict"
+)
+
+//UserOnboardedNotification is the value of UserOnboardedTopic.
+type UserOnboardedNotification struct {
+	UserID   int
+	Username string
+	//UID is the static ID of the user in the auth backend.
+	UID string
+
+	Reason OnboardReason
+}
+
+//UserRenamedNotification is the value of UserRenamedTopic.
+type UserRenamedNotification struct {
+	UserID      int
+	OldUsername string
+	NewUsername string
+	//UID is the static ID of the user in the auth backend.
+	UID string
+
+	Reason OnboardReason
+}
+
+//LoginSucceededNotification is the value of LoginSucceededTopic. It never holds the credential.
+type LoginSucceededNotification struct {
+	UserID   int
+	Username string
+	//UID is the static ID of the user in the auth backend.
+	UID string
+	//ClientIP and UserAgent describe the source of the login, when known.
+	ClientIP  string
+	UserAgent string
+	//CacheHit is set when the login was served without asking the auth backend.
+	CacheHit bool
+}
+
+//GroupMembershipChangedNotification is the value of GroupMembershipChangedTopic.
+type GroupMembershipChangedNotification struct {
+	UserID int
+	//UID is the static ID of the user in the auth backend.
+	UID string
+	//Added and Removed are the sorted names of the groups the user joined and left.
+	Added   []string
+	Removed []string
+
+	Reason OnboardReason
+}
+
+//UserDeletedNotification is the value of UserDeletedTopic.
+type UserDeletedNotification struct {
+	UserID int
+	//Username is the name of the user before it was deleted.
+	Username string
+	//Realname of the user, which external auth providers may use for the static ID of the user.
+	Realname string
+}
+
+//BackendState is the health of an external auth backend.
+type BackendState string
+
+const (
+	//BackendHealthy means the backend answers again.
+	BackendHealthy BackendState = "healthy"
+
+	//BackendUnhealthy means the backend failed several requests in a row.
+	BackendUnhealthy BackendState = "unhealthy"
+)
+
+//BackendHealthChangedNotification is the value of BackendHealthChangedTopic.
+type BackendHealthChangedNotification struct {
+	//Host is the host (and port) of the backend.
+	Host  string
+	State BackendState
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/vmware/harbor/src/common"
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
 	"github.com/vmware/harbor/src/common/utils/log"
 	"github.com/vmware/harbor/src/ui/config"
 )
@@ -257,13 +258,29 @@ func (ua *UserAPI) Delete() {
 		return
 	}
 
-	var err error
+	user, err := dao.GetUser(models.User{UserID: ua.userID})
+	if err != nil {
+		log.Errorf("Error occurred in GetUser: %v", err)
+		ua.RenderError(http.StatusInternalServerError, "Failed to delete User")
+		return
+	}
+
 	err = dao.DeleteUser(ua.userID)
 	if err != nil {
 		log.Errorf("Failed to delete data from database, error: %v", err)
 		ua.RenderError(http.StatusInternalServerError, "Failed to delete User")
 		return
 	}
+
+	if user != nil {
+		if err := notifier.Publish(notifier.UserDeletedTopic, notifier.UserDeletedNotification{
+			UserID:   user.UserID,
+			Username: user.Username,
+			Realname: user.Realname,
+		}); err != nil {
+			log.Errorf("Failed to publish the deletion of user %d: %v", user.UserID, err)
+		}
+	}
 }
 
 // ChangePassword handles PUT to /api/users/{}/password
@@ -14,6 +14,10 @@
 package auth
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -106,3 +110,33 @@ func TestErrAuth(t *testing.T) {
 	expectedStr := "Failed to authenticate user, due to error 'test'"
 	assert.Equal(expectedStr, e.Error())
 }
+
+func TestNewRequestMetadata(t *testing.T) {
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("User-Agent", "docker/17.06")
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("Authorization", "Basic xxx")
+
+	md := NewRequestMetadata(req)
+	assert.Equal(t, "10.0.0.1", md.ClientIP)
+	assert.Equal(t, "docker/17.06", md.UserAgent)
+	assert.Equal(t, map[string]string{"X-Request-Id": "req-1"}, md.TraceHeaders)
+
+	req.Header.Set("X-Forwarded-For", "192.168.0.1, 10.0.0.2")
+	assert.Equal(t, "192.168.0.1", NewRequestMetadata(req).ClientIP)
+	assert.Nil(t, NewRequestMetadata(nil))
+}
+
+func TestNewRequestMetadataClientCert(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/projects", nil)
+	assert.Empty(t, NewRequestMetadata(req).ClientCertSubject)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci", Organization: []string{"Acme"}}}
+	// unverified certificates are ignored
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	assert.Empty(t, NewRequestMetadata(req).ClientCertSubject)
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	assert.Equal(t, "CN=ci,O=Acme", NewRequestMetadata(req).ClientCertSubject)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2017 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// traceHeaders are the tracing headers propagated to authenticators
+var traceHeaders = []string{
+	"Traceparent",
+	"Tracestate",
+	"X-Request-Id",
+	"X-B3-Traceid",
+	"X-B3-Spanid",
+	"X-B3-Sampled",
+}
+
+// NewRequestMetadata extracts the metadata of req to be passed to the authenticator in models.AuthModel.
+func NewRequestMetadata(req *http.Request) *models.RequestMetadata {
+	if req == nil {
+		return nil
+	}
+
+	md := &models.RequestMetadata{
+		ClientIP:     clientIP(req),
+		UserAgent:    req.UserAgent(),
+		TraceHeaders: make(map[string]string),
+	}
+	for _, h := range traceHeaders {
+		if v := req.Header.Get(h); len(v) > 0 {
+			md.TraceHeaders[h] = v
+		}
+	}
+	// only certificates verified against the configured client CAs are trusted
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+		md.ClientCertSubject = req.TLS.VerifiedChains[0][0].Subject.String()
+	}
+	return md
+}
+
+// clientIP returns the first address in X-Forwarded-For, falling back to the remote address of req.
+func clientIP(req *http.Request) string {
+	if xff := req.Header.Get("X-Forwarded-For"); len(xff) > 0 {
+		return strings.TrimSpace(strings.Split(xff, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
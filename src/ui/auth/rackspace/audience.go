@@ -0,0 +1,99 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// AudienceMatch decides how the audiences the token is valid for are checked against the configured ones
+type AudienceMatch string
+
+const (
+	// AudienceMatchAny accepts tokens valid for at least one of the configured audiences
+	AudienceMatchAny AudienceMatch = "any"
+	// AudienceMatchAll accepts tokens valid for every configured audience
+	AudienceMatchAll AudienceMatch = "all"
+)
+
+// audienceCheck is the audiences sent to the backend in the TokenReview and the policy the
+// audiences it returns are checked with. A nil check accepts every token.
+type audienceCheck struct {
+	audiences []string
+	match     AudienceMatch
+}
+
+// audienceConfig returns the audience check configured by RACKSPACE_MK8S_AUTH_AUDIENCES, a comma
+// separated list, and RACKSPACE_MK8S_AUTH_AUDIENCE_MATCH, any by default, or nil when no
+// audiences are configured
+func audienceConfig() (*audienceCheck, error) {
+	const matchEnvVar = "RACKSPACE_MK8S_AUTH_AUDIENCE_MATCH"
+
+	match := AudienceMatch(envOrDefault(matchEnvVar, string(AudienceMatchAny)))
+	if match != AudienceMatchAny && match != AudienceMatchAll {
+		return nil, fmt.Errorf("The env var %s is not a valid match, expected %q or %q", matchEnvVar, AudienceMatchAny, AudienceMatchAll)
+	}
+
+	var audiences []string
+	for _, aud := range strings.Split(envOrDefault("RACKSPACE_MK8S_AUTH_AUDIENCES", ""), ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			audiences = append(audiences, aud)
+		}
+	}
+	if len(audiences) == 0 {
+		return nil, nil
+	}
+	return &audienceCheck{audiences: audiences, match: match}, nil
+}
+
+// requested returns the audiences to send to the backend, none when there's no check
+func (c *audienceCheck) requested() []string {
+	if c == nil {
+		return nil
+	}
+	return c.audiences
+}
+
+// check returns ErrAudienceMismatch when the audiences of id don't satisfy the configured ones
+func (c *audienceCheck) check(id Identity) error {
+	if c == nil {
+		return nil
+	}
+
+	valid := make(map[string]bool, len(id.Audiences))
+	for _, aud := range id.Audiences {
+		valid[aud] = true
+	}
+	matched := 0
+	for _, aud := range c.audiences {
+		if valid[aud] {
+			matched++
+		}
+	}
+
+	if (c.match == AudienceMatchAll && matched == len(c.audiences)) || (c.match != AudienceMatchAll && matched > 0) {
+		return nil
+	}
+	if len(id.Audiences) == 0 {
+		// the backend ignored the requested audiences, the token may be scoped for another service
+		log.Warningf("UID=%s BackendUsername=%s The backend didn't echo any token audience, expected %s of %v", id.UID, id.Username, c.match, c.audiences)
+		return ErrAudienceMismatch
+	}
+	log.Warningf("UID=%s BackendUsername=%s Token audiences %v don't match %s of %v", id.UID, id.Username, id.Audiences, c.match, c.audiences)
+	return ErrAudienceMismatch
+}
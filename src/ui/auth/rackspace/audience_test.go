@@ -0,0 +1,98 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func authenticateWithAudiences(t *testing.T, match string, returned []string) error {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	fb.response.Status.Audiences = returned
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":            fb.URL,
+		"RACKSPACE_MK8S_AUTH_AUDIENCES":      "harbor, registry",
+		"RACKSPACE_MK8S_AUTH_AUDIENCE_MATCH": match,
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Equal(t, []string{"harbor", "registry"}, fb.lastRequest.Spec.Audiences)
+	return err
+}
+
+func TestAuthenticateAudienceMatchAny(t *testing.T) {
+	assert.Nil(t, authenticateWithAudiences(t, "", []string{"registry"}))
+	assert.Nil(t, authenticateWithAudiences(t, "any", []string{"other", "harbor"}))
+	assert.Equal(t, ErrAudienceMismatch, authenticateWithAudiences(t, "any", []string{"other"}))
+	assert.Equal(t, ErrAudienceMismatch, authenticateWithAudiences(t, "any", nil))
+}
+
+func TestAuthenticateAudienceMatchAll(t *testing.T) {
+	assert.Equal(t, ErrAudienceMismatch, authenticateWithAudiences(t, "all", []string{"harbor"}))
+	assert.Nil(t, authenticateWithAudiences(t, "all", []string{"registry", "other", "harbor"}))
+	assert.Equal(t, ErrAudienceMismatch, authenticateWithAudiences(t, "all", []string{}))
+}
+
+func TestAuthenticateCachedAudienceMismatch(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	fb.response.Status.Audiences = []string{"harbor"}
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                     fb.URL,
+		"RACKSPACE_MK8S_AUTH_AUDIENCES":               "harbor",
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL":               "10m",
+		"RACKSPACE_MK8S_AUTH_CACHE_REVERIFY_INTERVAL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.cache.now = clock.now
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+
+	// once verified again, a token now scoped for another service is evicted and rejected
+	fb.response.Status.Audiences = []string{"other"}
+	clock.t = clock.t.Add(time.Minute)
+	_, err = a.Authenticate(m)
+	assert.Equal(t, ErrAudienceMismatch, err)
+	_, ok := a.cache.get(m.Password)
+	assert.False(t, ok)
+}
+
+func TestAudienceConfig(t *testing.T) {
+	// off by default, every token is accepted
+	c, err := audienceConfig()
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+	assert.Nil(t, c.requested())
+	assert.Nil(t, c.check(Identity{Username: "alice"}))
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_AUDIENCE_MATCH": "some"})()
+	_, err = audienceConfig()
+	assert.NotNil(t, err)
+}
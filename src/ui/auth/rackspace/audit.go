@@ -0,0 +1,113 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// AuditRecord is an auth decision. It never holds the token.
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Outcome string    `json:"outcome"`
+	// Username is the username given at login
+	Username string `json:"username"`
+	// HarborUsername and UID are the user's, when the login succeeded
+	HarborUsername string `json:"harbor_username,omitempty"`
+	UID            string `json:"uid,omitempty"`
+	ClientIP       string `json:"client_ip,omitempty"`
+	// Reason is the error condition of a failed login, or its error when the condition isn't known
+	Reason string `json:"reason,omitempty"`
+}
+
+// Auditor keeps the audit records of the logins, separately from Harbor's logs. Auditing is
+// disabled by default.
+type Auditor interface {
+	Audit(r AuditRecord) error
+}
+
+// RegisterAuditor sets the auditor of the registered authenticator. It must be called before any
+// login is served.
+func RegisterAuditor(auditor Auditor) {
+	registered.auditor = auditor
+}
+
+// auditFile returns the auditor appending to RACKSPACE_MK8S_AUTH_AUDIT_FILE, or nil when it's unset
+func auditFile() (Auditor, error) {
+	path := envOrDefault("RACKSPACE_MK8S_AUTH_AUDIT_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return newFileAuditor(path)
+}
+
+// fileAuditor appends the audit records to a file as JSON lines
+type fileAuditor struct {
+	sync.Mutex
+	f *os.File
+}
+
+func newFileAuditor(path string) (*fileAuditor, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditor{f: f}, nil
+}
+
+// Audit ...
+func (fa *fileAuditor) Audit(r AuditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	fa.Lock()
+	defer fa.Unlock()
+	_, err = fa.f.Write(append(line, '\n'))
+	return err
+}
+
+// audit records the decision of the login, failures to record it are only logged
+func (a *Auth) audit(m models.AuthModel, user *models.User, err error) {
+	if a.auditor == nil {
+		return
+	}
+
+	r := AuditRecord{
+		Time:     time.Now().UTC(),
+		Outcome:  outcomeSuccess,
+		Username: m.Principal,
+		ClientIP: clientIP(m),
+	}
+	if err != nil {
+		r.Outcome = outcomeFailure
+		if r.Reason = errorCondition(err); r.Reason == "" {
+			r.Reason = err.Error()
+		}
+	} else {
+		r.HarborUsername, r.UID = user.Username, userUID(user)
+	}
+
+	if err := a.auditor.Audit(r); err != nil {
+		log.Errorf("ProvidedUsername=%s Error writing audit record: %v", m.Principal, err)
+	}
+}
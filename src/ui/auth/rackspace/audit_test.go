@@ -0,0 +1,85 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestAuthenticateAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":        fb.URL,
+		"RACKSPACE_MK8S_AUTH_AUDIT_FILE": path,
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	md := &models.RequestMetadata{ClientIP: "10.0.0.1"}
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "secret-token", Metadata: md})
+	assert.Nil(t, err)
+	fb.status = http.StatusUnauthorized
+	_, err = a.Authenticate(models.AuthModel{Principal: "bob", Password: "other-secret-token", Metadata: md})
+	assert.NotNil(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "secret-token")
+
+	var records []AuditRecord
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := AuditRecord{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &r))
+		assert.False(t, r.Time.IsZero())
+		r.Time = time.Time{}
+		records = append(records, r)
+	}
+
+	assert.Equal(t, []AuditRecord{
+		{Outcome: outcomeSuccess, Username: "alice", HarborUsername: "alice", UID: "uid-alice", ClientIP: "10.0.0.1"},
+		{Outcome: outcomeFailure, Username: "bob", ClientIP: "10.0.0.1", Reason: conditionUnauthorized},
+	}, records)
+
+	// the file is appended to
+	a, err = setupAuth()
+	assert.Nil(t, err)
+	a.Authenticate(models.AuthModel{Principal: "bob", Password: "other-secret-token"})
+	data, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(bytes.Split(bytes.TrimSpace(data), []byte("\n"))))
+}
@@ -0,0 +1,305 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultBackendName is the name of the backend of RACKSPACE_MK8S_AUTH_URL
+const defaultBackendName = "default"
+
+// backend is a kubernetes-auth deployment reviewing tokens, with its own URL, CA and timeouts
+type backend struct {
+	name      string
+	url       string
+	transport transport
+}
+
+// backendRoute sends the tokens starting with prefix to backend, nil for the default backend
+type backendRoute struct {
+	prefix  string
+	backend *backend
+}
+
+// backendRouter picks the backend of each token, e.g. while migrating to a new backend issuing
+// tokens with a distinct prefix. A nil router sends every token to the default backend.
+type backendRouter struct {
+	// routes are sorted by decreasing prefix length, so the longest matching prefix wins
+	routes []backendRoute
+	// failover are the backends tried in turn when the backend of the token fails, nil for the
+	// default backend
+	failover []*backend
+}
+
+// route returns the backend of the longest prefix of token, or nil for the default backend
+func (br *backendRouter) route(token string) *backend {
+	if br == nil {
+		return nil
+	}
+	for _, r := range br.routes {
+		if strings.HasPrefix(token, r.prefix) {
+			return r.backend
+		}
+	}
+	return nil
+}
+
+// chain returns the backend of token followed by the failover backends, nil for the default backend
+func (br *backendRouter) chain(token string) []*backend {
+	routed := br.route(token)
+	if br == nil {
+		return []*backend{routed}
+	}
+
+	chain := make([]*backend, 1, 1+len(br.failover))
+	chain[0] = routed
+	for _, b := range br.failover {
+		if b != routed {
+			chain = append(chain, b)
+		}
+	}
+	return chain
+}
+
+// backendFor returns the backend reviewing token
+func (a *Auth) backendFor(token string) *backend {
+	return a.resolveBackend(a.router.route(token))
+}
+
+// backendsFor returns the backend reviewing token followed by its failover backends
+func (a *Auth) backendsFor(token string) []*backend {
+	chain := a.router.chain(token)
+	for i, b := range chain {
+		chain[i] = a.resolveBackend(b)
+	}
+	return chain
+}
+
+// resolveBackend returns b, or the default backend when b is nil
+func (a *Auth) resolveBackend(b *backend) *backend {
+	if b != nil {
+		return b
+	}
+	return &backend{name: defaultBackendName, url: a.authURL, transport: a.transport}
+}
+
+// backendRouting returns the router of RACKSPACE_MK8S_AUTH_BACKEND_ROUTES, in the form
+// "prefix1=backend1,prefix2=backend2", and RACKSPACE_MK8S_AUTH_FAILOVER_BACKENDS, a comma
+// separated list of backends, or nil when both are unset. The backends are the default one
+// and the ones named in RACKSPACE_MK8S_AUTH_BACKENDS, each configured by the env vars
+// RACKSPACE_MK8S_AUTH_BACKEND_<NAME>_URL, and optionally _CA_CERT, _TIMEOUT, _CONNECT_TIMEOUT and
+// _RESPONSE_HEADER_TIMEOUT. The timeouts default to the default backend's, the CA to
+// the OpenStack CA. The protocol and extra headers are the same for all backends, and so is the
+// fake transport, when set.
+func backendRouting(timeouts clientTimeouts, headers http.Header, fake transport) (*backendRouter, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_BACKEND_ROUTES"
+
+	backends, err := namedBackends(timeouts, headers, fake)
+	if err != nil {
+		return nil, err
+	}
+
+	failover, err := failoverBackends(backends)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := os.Getenv(envVar)
+	if strings.TrimSpace(routes) == "" {
+		if len(failover) > 0 {
+			return &backendRouter{failover: failover}, nil
+		}
+		if len(backends) > 0 {
+			return nil, fmt.Errorf("RACKSPACE_MK8S_AUTH_BACKENDS is set but %s isn't, no token would be sent to them", envVar)
+		}
+		return nil, nil
+	}
+
+	br := &backendRouter{failover: failover}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(routes, ",") {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("The env var %s is not a valid route %q, expected prefix=backend", envVar, entry)
+		}
+		prefix, name := kv[0], strings.TrimSpace(kv[1])
+		if seen[prefix] {
+			return nil, fmt.Errorf("The env var %s is not a valid route %q, the prefix is routed twice", envVar, entry)
+		}
+		seen[prefix] = true
+
+		b, ok := backends[name]
+		if !ok && name != defaultBackendName {
+			return nil, fmt.Errorf("The env var %s is not a valid route %q, unknown backend %q", envVar, entry, name)
+		}
+		br.routes = append(br.routes, backendRoute{prefix: prefix, backend: b})
+	}
+
+	sort.SliceStable(br.routes, func(i, j int) bool {
+		return len(br.routes[i].prefix) > len(br.routes[j].prefix)
+	})
+	return br, nil
+}
+
+// failoverBackends returns the backends of RACKSPACE_MK8S_AUTH_FAILOVER_BACKENDS among backends,
+// nil for the default one
+func failoverBackends(backends map[string]*backend) ([]*backend, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_FAILOVER_BACKENDS"
+
+	var failover []*backend
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(os.Getenv(envVar), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("The env var %s is not a valid backend list, %q is listed twice", envVar, name)
+		}
+		seen[name] = true
+
+		b, ok := backends[name]
+		if !ok && name != defaultBackendName {
+			return nil, fmt.Errorf("The env var %s is not a valid backend list, unknown backend %q", envVar, name)
+		}
+		failover = append(failover, b)
+	}
+	return failover, nil
+}
+
+// namedBackends returns the backends of RACKSPACE_MK8S_AUTH_BACKENDS by name
+func namedBackends(timeouts clientTimeouts, headers http.Header, fake transport) (map[string]*backend, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_BACKENDS"
+
+	backends := make(map[string]*backend)
+	for _, name := range strings.Split(os.Getenv(envVar), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !validBackendName(name) || name == defaultBackendName {
+			return nil, fmt.Errorf("The env var %s is not a valid backend list, %q is not a valid backend name", envVar, name)
+		}
+		if _, ok := backends[name]; ok {
+			return nil, fmt.Errorf("The env var %s is not a valid backend list, %q is listed twice", envVar, name)
+		}
+
+		b, err := namedBackend(name, timeouts, headers, fake)
+		if err != nil {
+			return nil, err
+		}
+		backends[name] = b
+	}
+	return backends, nil
+}
+
+// namedBackend returns the backend configured by the RACKSPACE_MK8S_AUTH_BACKEND_<NAME>_* env vars,
+// reviewing its tokens with fake instead when it's set
+func namedBackend(name string, timeouts clientTimeouts, headers http.Header, fake transport) (*backend, error) {
+	prefix := "RACKSPACE_MK8S_AUTH_BACKEND_" + strings.ToUpper(name) + "_"
+
+	rawURL := os.Getenv(prefix + "URL")
+	if rawURL == "" {
+		return nil, fmt.Errorf("The env var %sURL of the backend %s is not set", prefix, name)
+	}
+	authURL, err := backendURL(prefix+"URL", rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	backendTimeouts, err := timeoutsFromEnv(prefix, timeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	if fake != nil {
+		return &backend{name: name, url: authURL, transport: fake}, nil
+	}
+
+	t, err := backendTransport(authURL, envOrDefault(prefix+"CA_CERT", openStackCAPath), backendTimeouts, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &backend{name: name, url: authURL, transport: t}, nil
+}
+
+// urls returns the URLs of the named backends, routed or failed over to
+func (br *backendRouter) urls() []string {
+	if br == nil {
+		return nil
+	}
+	var urls []string
+	for _, r := range br.routes {
+		if r.backend != nil {
+			urls = append(urls, r.backend.url)
+		}
+	}
+	for _, b := range br.failover {
+		if b != nil {
+			urls = append(urls, b.url)
+		}
+	}
+	return urls
+}
+
+// validBackendName reports whether name only has letters, digits and underscores, so that it can
+// be part of env var names
+func validBackendName(name string) bool {
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// describe returns the routes as prefix=backend pairs, for the config summary
+func (br *backendRouter) describe() string {
+	if br == nil || len(br.routes) == 0 {
+		return "off"
+	}
+	pairs := make([]string, 0, len(br.routes))
+	for _, r := range br.routes {
+		name := defaultBackendName
+		if r.backend != nil {
+			name = r.backend.name
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", r.prefix, name))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// describeFailover returns the failover backends, for the config summary
+func (br *backendRouter) describeFailover() string {
+	if br == nil || len(br.failover) == 0 {
+		return "off"
+	}
+	names := make([]string, 0, len(br.failover))
+	for _, b := range br.failover {
+		name := defaultBackendName
+		if b != nil {
+			name = b.name
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,107 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestSingleBackendDefault(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Nil(t, a.router)
+	assert.Contains(t, configSummary(a), "backendRoutes=off")
+	a.resolver.Store = &fakeStore{}
+
+	for _, token := range []string{"token", "v2.token"} {
+		_, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: token})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, fb.requests)
+}
+
+func TestPrefixRouting(t *testing.T) {
+	legacy := newFakeBackend(t)
+	defer legacy.Close()
+	next := newFakeBackend(t)
+	defer next.Close()
+	next.response.Status.User.Username = "bob"
+	next.response.Status.User.UID = "uid-bob"
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                  legacy.URL,
+		"RACKSPACE_MK8S_AUTH_TIMEOUT":              "5s",
+		"RACKSPACE_MK8S_AUTH_BACKENDS":             "next",
+		"RACKSPACE_MK8S_AUTH_BACKEND_NEXT_URL":     next.URL,
+		"RACKSPACE_MK8S_AUTH_BACKEND_NEXT_TIMEOUT": "2s",
+		"RACKSPACE_MK8S_AUTH_BACKEND_ROUTES":       "v2.=next,v2.legacy.=default",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Contains(t, configSummary(a), "backendRoutes=v2.legacy.=default,v2.=next")
+	a.resolver.Store = &fakeStore{}
+
+	user, err := a.Authenticate(models.AuthModel{Principal: "bob", Password: "v2.token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", user.Username)
+	assert.Equal(t, 1, next.requests)
+	assert.Equal(t, "v2.token", next.lastRequest.Spec.Token)
+
+	user, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+
+	// the longest prefix wins
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "v2.legacy.token"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, legacy.requests)
+	assert.Equal(t, 1, next.requests)
+
+	// each backend has its own client and timeouts
+	b := a.router.route("v2.token")
+	assert.Equal(t, "next", b.name)
+	assert.Equal(t, 2*time.Second, b.transport.(*httpTransport).client.Timeout)
+	assert.Equal(t, 5*time.Second, a.transport.(*httpTransport).client.Timeout)
+
+	// and its own endpoint label
+	assert.Equal(t, strings.TrimPrefix(next.URL, "http://"), a.metrics.endpointLabel(next.URL))
+}
+
+func TestBackendRoutingInvalid(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"RACKSPACE_MK8S_AUTH_BACKEND_ROUTES": "v2.=next"},
+		{"RACKSPACE_MK8S_AUTH_BACKEND_ROUTES": "v2."},
+		{"RACKSPACE_MK8S_AUTH_BACKEND_ROUTES": "v2.=default,v2.=default"},
+		{"RACKSPACE_MK8S_AUTH_BACKENDS": "next", "RACKSPACE_MK8S_AUTH_BACKEND_ROUTES": "v2.=next"},
+		{"RACKSPACE_MK8S_AUTH_BACKENDS": "next", "RACKSPACE_MK8S_AUTH_BACKEND_NEXT_URL": "http://next:8080"},
+		{"RACKSPACE_MK8S_AUTH_BACKENDS": "next-1", "RACKSPACE_MK8S_AUTH_BACKEND_ROUTES": "v2.=next-1"},
+		{"RACKSPACE_MK8S_AUTH_BACKENDS": "default", "RACKSPACE_MK8S_AUTH_BACKEND_ROUTES": "v2.=default"},
+		{"RACKSPACE_MK8S_AUTH_REQUIRE_HTTPS": "true", "RACKSPACE_MK8S_AUTH_BACKENDS": "next", "RACKSPACE_MK8S_AUTH_BACKEND_NEXT_URL": "http://next:8080", "RACKSPACE_MK8S_AUTH_BACKEND_ROUTES": "v2.=next"},
+	} {
+		restore := setEnv(t, env)
+		_, err := backendRouting(clientTimeouts{total: defaultTimeout}, nil, nil)
+		assert.NotNil(t, err, "%v", env)
+		restore()
+	}
+}
@@ -0,0 +1,96 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// BatchEntry is a token validated by ValidateTokens
+type BatchEntry struct {
+	Token string
+	// Timeout, when set, limits the validation of this entry, within the deadline of the batch
+	Timeout time.Duration
+}
+
+// BatchResult is the outcome of validating a BatchEntry
+type BatchResult struct {
+	// Identity is the token's user as returned by the backend, when Err is nil. It's never set
+	// when the backend didn't authenticate the token, Err is then ErrNotAuthenticated.
+	Identity      Identity
+	Authenticated bool
+	// TimedOut is set when the entry's or the batch's deadline passed before the backend answered
+	TimedOut bool
+	Err      error
+}
+
+// ValidateTokens validates the tokens of the entries concurrently and returns their results in the
+// same order. Unlike Authenticate, the users are neither looked up in nor added to Harbor's database.
+// An entry failing or timing out doesn't fail the others.
+func (a *Auth) ValidateTokens(ctx context.Context, entries []BatchEntry) []BatchResult {
+	results := make([]BatchResult, len(entries))
+
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = a.validateToken(ctx, entries[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (a *Auth) validateToken(ctx context.Context, entry BatchEntry) BatchResult {
+	if a.maintenance != nil {
+		return BatchResult{Err: a.maintenance}
+	}
+
+	m := models.AuthModel{Password: strings.TrimSpace(entry.Token)}
+	if m.Password == "" {
+		return BatchResult{Err: ErrInvalidToken}
+	}
+
+	if entry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, entry.Timeout)
+		defer cancel()
+	}
+
+	authResp, err := a.reviewContext(ctx, m)
+	if err != nil {
+		return BatchResult{TimedOut: ctx.Err() == context.DeadlineExceeded, Err: err}
+	}
+
+	if !authResp.Status.Authenticated {
+		return BatchResult{Err: ErrNotAuthenticated}
+	}
+
+	id := authResp.identity()
+	if err := a.audiences.check(id); err != nil {
+		return BatchResult{Identity: id, Err: err}
+	}
+	id.Username = withUsernameClaim(id, a.usernameClaim)
+	id.Groups = withExtraGroups(id, a.extraGroupsKey)
+	id.Extra = a.extraLimit.limitExtra(id)
+	return BatchResult{Identity: id, Authenticated: true}
+}
@@ -0,0 +1,79 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTokensPerEntryTimeout(t *testing.T) {
+	// tokens starting with "slow" take a while to be reviewed
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), `"token":"slow`) {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Write([]byte(`{"apiVersion":"` + defaultAPIVersion + `","kind":"` + defaultKind + `","status":{"authenticated":true,"user":{"username":"alice","uid":"uid-alice"}}}`))
+	}))
+	defer backend.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": backend.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	start := time.Now()
+	results := a.ValidateTokens(context.Background(), []BatchEntry{
+		{Token: "fast-1"},
+		{Token: "slow-1", Timeout: 50 * time.Millisecond},
+		{Token: "fast-2", Timeout: time.Second},
+		{Token: "slow-2", Timeout: 2 * time.Second},
+		{Token: "  "},
+	})
+	assert.Len(t, results, 5)
+
+	for _, i := range []int{0, 2, 3} {
+		assert.Nil(t, results[i].Err, "entry %d", i)
+		assert.False(t, results[i].TimedOut, "entry %d", i)
+		assert.True(t, results[i].Authenticated, "entry %d", i)
+		assert.Equal(t, "uid-alice", results[i].Identity.UID, "entry %d", i)
+	}
+
+	assert.NotNil(t, results[1].Err)
+	assert.True(t, results[1].TimedOut)
+
+	assert.Equal(t, ErrInvalidToken, results[4].Err)
+	assert.False(t, results[4].TimedOut)
+
+	// the entries are validated concurrently
+	assert.True(t, time.Since(start) < time.Second, "took %v", time.Since(start))
+
+	// the batch's deadline applies to entries with a longer timeout of their own
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results = a.ValidateTokens(ctx, []BatchEntry{
+		{Token: "slow-3", Timeout: 2 * time.Second},
+		{Token: "fast-3"},
+	})
+	assert.True(t, results[0].TimedOut)
+	assert.Nil(t, results[1].Err)
+}
@@ -0,0 +1,393 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// cacheEntry is a user resolved from a token
+type cacheEntry struct {
+	user    models.User
+	created time.Time
+	// uid is the backend UID the token was resolved to, last verified at verified
+	uid      string
+	verified time.Time
+	// elem is the entry's key in the cache's recency list
+	elem *list.Element
+}
+
+// newCacheEntry returns the entry of user, created and verified at created
+func newCacheEntry(user models.User, created time.Time) *cacheEntry {
+	return &cacheEntry{user: user, created: created, uid: userUID(&user), verified: created}
+}
+
+// reasons an entry is evicted from the cache, used as the "reason" metric label
+const (
+	// evictionExpired is an entry older than the effective TTL
+	evictionExpired = "expired"
+	// evictionCapacity is the least recently used entry of a full cache
+	evictionCapacity = "capacity"
+	// evictionInvalidated is an entry invalidated explicitly, e.g. of a deleted user
+	evictionInvalidated = "invalidated"
+)
+
+// userCache caches the users resolved from tokens so that kubernetes-auth and the database
+// aren't consulted on every request. Entries are keyed by the hash of the token, never the
+// token itself, and expire once they are older than the effective TTL. Keying by token rather
+// than by user ties the expiry to each token: a user with several tokens has one entry per
+// token, so a fresh token can't keep serving a user whose other token has expired.
+// A nil cache is disabled.
+type userCache struct {
+	sync.Mutex
+	entries map[string]*cacheEntry
+	// bytes is the approximate memory used by the entries, see entrySize
+	bytes int64
+	ttl   *adaptiveTTL
+	now   func() time.Time
+	// reverifyInterval, when set, is how long a cached token is served before the backend is asked
+	// again whether it still maps to the same UID
+	reverifyInterval time.Duration
+	// maxEntries, when set, is the number of entries beyond which the least recently used is evicted
+	maxEntries int
+	// recency lists the keys of the entries from the most to the least recently used
+	recency *list.List
+	// evictions counts the evicted entries by reason
+	evictions map[string]int64
+
+	// wake is signalled by put so that the eviction loop, idle while the cache is empty, resumes
+	wake chan struct{}
+	// stop cancels the eviction loop and done is closed once it has returned
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// newUserCache returns a cache using ttl, or nil (disabled) if the base TTL is zero
+func newUserCache(ttl *adaptiveTTL) *userCache {
+	if ttl.base <= 0 {
+		return nil
+	}
+	return &userCache{
+		entries:   make(map[string]*cacheEntry),
+		ttl:       ttl,
+		now:       time.Now,
+		evictions: make(map[string]int64),
+		recency:   list.New(),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// defaultEvictionInterval is the default interval between two sweeps of the expired entries
+const defaultEvictionInterval = time.Minute
+
+// cacheEvictionInterval returns RACKSPACE_MK8S_AUTH_CACHE_EVICTION_INTERVAL, zero disabling the
+// sweeps so that expired entries are only evicted when their token is used again
+func cacheEvictionInterval() (time.Duration, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_CACHE_EVICTION_INTERVAL"
+
+	interval, err := envDuration(envVar, defaultEvictionInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("The env var %s is not a valid interval, expected 0 or more", envVar)
+	}
+	return interval, nil
+}
+
+// cacheReverifyInterval returns RACKSPACE_MK8S_AUTH_CACHE_REVERIFY_INTERVAL, zero (the default)
+// serving the cached tokens until they expire without verifying them again
+func cacheReverifyInterval() (time.Duration, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_CACHE_REVERIFY_INTERVAL"
+
+	interval, err := envDuration(envVar, 0)
+	if err != nil {
+		return 0, err
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("The env var %s is not a valid interval, expected 0 or more", envVar)
+	}
+	return interval, nil
+}
+
+// defaultCacheMaxEntries is the default number of cached entries, a few MB of users
+const defaultCacheMaxEntries = 10000
+
+// cacheMaxEntries returns RACKSPACE_MK8S_AUTH_CACHE_MAX_ENTRIES, zero leaving the cache unbounded
+// so that entries are only evicted once expired
+func cacheMaxEntries() (int, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_CACHE_MAX_ENTRIES"
+
+	max, err := envInt(envVar, defaultCacheMaxEntries)
+	if err != nil {
+		return 0, err
+	}
+	if max < 0 {
+		return 0, fmt.Errorf("The env var %s is not a valid number of entries, expected 0 or more", envVar)
+	}
+	return max, nil
+}
+
+// startEviction starts the loop sweeping the expired entries every interval until Close is
+// called. Nothing is started when interval is zero.
+func (c *userCache) startEviction(interval time.Duration) {
+	if c == nil || interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stop = cancel
+	c.done = make(chan struct{})
+	go c.evictionLoop(ctx, interval)
+}
+
+// evictionLoop sweeps the expired entries every interval until ctx is done. It waits for a put
+// instead of ticking while the cache is empty.
+func (c *userCache) evictionLoop(ctx context.Context, interval time.Duration) {
+	defer close(c.done)
+
+	for {
+		if n, _ := c.size(); n == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.wake:
+			}
+		}
+
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+			c.evictExpired()
+		}
+	}
+}
+
+// evictExpired removes the entries older than the effective TTL
+func (c *userCache) evictExpired() {
+	ttl := c.ttl.get()
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	n := 0
+	for key, e := range c.entries {
+		if now.Sub(e.created) >= ttl {
+			c.remove(key, evictionExpired)
+			n++
+		}
+	}
+	if n > 0 {
+		log.Debugf("Evicted %d expired cache entries", n)
+	}
+}
+
+// Close stops the eviction loop and waits for it to return
+func (c *userCache) Close() {
+	if c == nil || c.stop == nil {
+		return
+	}
+	c.stop()
+	<-c.done
+}
+
+// tokenKey returns the cache key of token
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns a copy of the user cached for token
+func (c *userCache) get(token string) (*models.User, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	key := tokenKey(token)
+	ttl := c.ttl.get()
+
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().Sub(e.created) >= ttl {
+		c.remove(key, evictionExpired)
+		return nil, false
+	}
+
+	c.recency.MoveToFront(e.elem)
+	user := e.user
+	return &user, true
+}
+
+// put caches a copy of user for token
+func (c *userCache) put(token string, user *models.User) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	c.set(tokenKey(token), newCacheEntry(*user, c.now()))
+	c.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// reverifyDue returns the UID cached for token when it hasn't been verified for the reverify
+// interval
+func (c *userCache) reverifyDue(token string) (string, bool) {
+	if c == nil || c.reverifyInterval <= 0 {
+		return "", false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[tokenKey(token)]
+	if !ok || c.now().Sub(e.verified) < c.reverifyInterval {
+		return "", false
+	}
+	return e.uid, true
+}
+
+// verified records that the backend still maps token to the cached UID
+func (c *userCache) verified(token string) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[tokenKey(token)]; ok {
+		e.verified = c.now()
+	}
+}
+
+// invalidateToken evicts the entry of token
+func (c *userCache) invalidateToken(token string) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.remove(tokenKey(token), evictionInvalidated)
+}
+
+// set stores e under key as the most recently used entry, keeping the byte estimate up to date,
+// and evicts the least recently used entries beyond maxEntries. The lock must be held.
+func (c *userCache) set(key string, e *cacheEntry) {
+	if old, ok := c.entries[key]; ok {
+		c.bytes -= entrySize(key, old)
+		c.recency.Remove(old.elem)
+	}
+	e.elem = c.recency.PushFront(key)
+	c.entries[key] = e
+	c.bytes += entrySize(key, e)
+
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		oldest := c.recency.Back().Value.(string)
+		log.Debugf("UserID=%d Evicted the least recently used cache entry, the cache is full at %d entries", c.entries[oldest].user.UserID, c.maxEntries)
+		c.remove(oldest, evictionCapacity)
+	}
+}
+
+// remove evicts the entry under key for reason, keeping the byte estimate and the eviction counts
+// up to date. The lock must be held.
+func (c *userCache) remove(key, reason string) {
+	if e, ok := c.entries[key]; ok {
+		c.bytes -= entrySize(key, e)
+		c.recency.Remove(e.elem)
+		delete(c.entries, key)
+		c.evictions[reason]++
+	}
+}
+
+// entrySize estimates the memory used by an entry: the entry itself, its key and the strings of its
+// user. The map's own overhead isn't counted.
+func entrySize(key string, e *cacheEntry) int64 {
+	u := e.user
+	size := int(unsafe.Sizeof(*e)) + len(key) + len(e.uid) +
+		len(u.Username) + len(u.Email) + len(u.Password) + len(u.Realname) + len(u.ExternalID) + len(u.Comment) +
+		len(u.Rolename) + len(u.Salt) + len(u.ResetUUID)
+	return int64(size)
+}
+
+// size returns the number of entries and their approximate memory use
+func (c *userCache) size() (int, int64) {
+	if c == nil {
+		return 0, 0
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	return len(c.entries), c.bytes
+}
+
+// evictionCounts returns a copy of the number of evicted entries by reason
+func (c *userCache) evictionCounts() map[string]int64 {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	counts := make(map[string]int64, len(c.evictions))
+	for reason, n := range c.evictions {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// effectiveTTL returns the current TTL, or zero when caching is disabled
+func (c *userCache) effectiveTTL() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.ttl.get()
+}
+
+// backendFailed and backendSucceeded feed the backend health into the TTL policy
+func (c *userCache) backendFailed() {
+	if c != nil {
+		c.ttl.backendFailed()
+	}
+}
+
+func (c *userCache) backendSucceeded() {
+	if c != nil {
+		c.ttl.backendSucceeded()
+	}
+}
@@ -0,0 +1,365 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// fakeClock is a settable time source for cache tests
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestAuthenticateUsesCache(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":       fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.cache.now = clock.now
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	user, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, 1, fb.requests)
+
+	cached, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, user, cached)
+	assert.Equal(t, 1, fb.requests)
+
+	clock.t = clock.t.Add(time.Minute)
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fb.requests)
+}
+
+func TestAuthenticateCachesPerToken(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":       fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.cache.now = clock.now
+
+	// the same user authenticates with two tokens issued 30s apart
+	first := models.AuthModel{Principal: "alice", Password: "token-1"}
+	second := models.AuthModel{Principal: "alice", Password: "token-2"}
+
+	_, err = a.Authenticate(first)
+	assert.Nil(t, err)
+	clock.t = clock.t.Add(30 * time.Second)
+	_, err = a.Authenticate(second)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fb.requests)
+	assert.Equal(t, "token-2", fb.lastRequest.Spec.Token)
+
+	// the first token's entry expires and is reviewed again
+	clock.t = clock.t.Add(30 * time.Second)
+	_, err = a.Authenticate(first)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fb.requests)
+	assert.Equal(t, "token-1", fb.lastRequest.Spec.Token)
+
+	// while the second token is still served from the cache
+	user, err := a.Authenticate(second)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, 3, fb.requests)
+
+	// and a rejected token is never answered with the user of another one
+	fb.status = http.StatusUnauthorized
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token-3"})
+	assert.NotNil(t, err)
+}
+
+func TestAuthenticateCacheReverify(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                     fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL":               "10m",
+		"RACKSPACE_MK8S_AUTH_CACHE_REVERIFY_INTERVAL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.cache.now = clock.now
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	user, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, "uid-alice", userUID(user))
+	assert.Equal(t, 1, fb.requests)
+
+	// served from the cache until the reverify interval has passed
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fb.requests)
+
+	// then verified once, and served from the cache again while the UID is the same
+	clock.t = clock.t.Add(time.Minute)
+	cached, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, user, cached)
+	assert.Equal(t, 2, fb.requests)
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fb.requests)
+
+	// the backend reuses the token for another identity, the stale user isn't served
+	fb.response.Status.User.Username = "bob"
+	fb.response.Status.User.UID = "uid-bob"
+	clock.t = clock.t.Add(time.Minute)
+	user, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", user.Username)
+	assert.Equal(t, "uid-bob", userUID(user))
+
+	// and the new mapping is the one cached
+	requests := fb.requests
+	cached, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", cached.Username)
+	assert.Equal(t, requests, fb.requests)
+
+	// the cached user keeps being served while the backend fails
+	fb.status = http.StatusInternalServerError
+	clock.t = clock.t.Add(time.Minute)
+	cached, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", cached.Username)
+}
+
+func TestCacheReverifyInterval(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_CACHE_REVERIFY_INTERVAL": "-1s"})()
+	_, err := cacheReverifyInterval()
+	assert.NotNil(t, err)
+}
+
+func TestCacheStats(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":       fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.cache.now = clock.now
+
+	stats := a.Stats()
+	assert.Equal(t, 0, stats.CacheEntries)
+	assert.Equal(t, int64(0), stats.CacheBytes)
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token-1"})
+	assert.Nil(t, err)
+	one := a.Stats()
+	assert.Equal(t, 1, one.CacheEntries)
+	assert.True(t, one.CacheBytes > 0)
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token-2"})
+	assert.Nil(t, err)
+	two := a.Stats()
+	assert.Equal(t, 2, two.CacheEntries)
+	assert.Equal(t, 2*one.CacheBytes, two.CacheBytes)
+
+	// re-caching a token replaces its entry
+	a.cache.put("token-2", &models.User{Username: "alice", Realname: "uid-alice"})
+	assert.Equal(t, 2, a.Stats().CacheEntries)
+
+	// expired entries are evicted when looked up
+	clock.t = clock.t.Add(time.Minute)
+	_, ok := a.cache.get("token-1")
+	assert.False(t, ok)
+	_, ok = a.cache.get("token-2")
+	assert.False(t, ok)
+	stats = a.Stats()
+	assert.Equal(t, 0, stats.CacheEntries)
+	assert.Equal(t, int64(0), stats.CacheBytes)
+
+	// a disabled cache reports nothing
+	var disabled *userCache
+	entries, bytes := disabled.size()
+	assert.Equal(t, 0, entries)
+	assert.Equal(t, int64(0), bytes)
+}
+
+func TestCacheEvictionLoop(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := newUserCache(newAdaptiveTTL(time.Minute, time.Minute, false))
+	c.now = clock.now
+	c.startEviction(5 * time.Millisecond)
+
+	c.put("token", &models.User{UserID: 1, Username: "alice"})
+	c.Lock()
+	clock.t = clock.t.Add(time.Minute)
+	c.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for n, _ := c.size(); n > 0 && time.Now().Before(deadline); n, _ = c.size() {
+		time.Sleep(time.Millisecond)
+	}
+	n, _ := c.size()
+	assert.Equal(t, 0, n)
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("the eviction loop didn't exit once closed")
+	}
+
+	// closing a cache without a loop, or a disabled one, is a no-op
+	newUserCache(newAdaptiveTTL(time.Minute, time.Minute, false)).Close()
+	var disabled *userCache
+	disabled.startEviction(time.Millisecond)
+	disabled.Close()
+}
+
+func TestCacheEvictionInterval(t *testing.T) {
+	interval, err := cacheEvictionInterval()
+	assert.Nil(t, err)
+	assert.Equal(t, defaultEvictionInterval, interval)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_CACHE_EVICTION_INTERVAL": "-1s"})()
+	_, err = cacheEvictionInterval()
+	assert.NotNil(t, err)
+}
+
+func TestCacheEvictionReasons(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := newUserCache(newAdaptiveTTL(time.Minute, time.Minute, false))
+	c.now = clock.now
+	c.maxEntries = 2
+
+	c.put("token-1", &models.User{UserID: 1, Username: "alice"})
+	clock.t = clock.t.Add(time.Second)
+	c.put("token-2", &models.User{UserID: 2, Username: "bob"})
+	clock.t = clock.t.Add(time.Second)
+
+	// token-1 is served, so token-2 is the least recently used once the cache is full
+	_, ok := c.get("token-1")
+	assert.True(t, ok)
+	clock.t = clock.t.Add(time.Second)
+	c.put("token-3", &models.User{UserID: 3, Username: "carol"})
+	_, ok = c.get("token-2")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]int64{evictionCapacity: 1}, c.evictionCounts())
+
+	c.invalidateToken("token-3")
+	assert.Equal(t, int64(1), c.evictionCounts()[evictionInvalidated])
+
+	clock.t = clock.t.Add(time.Minute)
+	c.evictExpired()
+	assert.Equal(t, map[string]int64{evictionCapacity: 1, evictionInvalidated: 1, evictionExpired: 1}, c.evictionCounts())
+
+	// replacing an entry isn't an eviction
+	c.put("token-4", &models.User{UserID: 4, Username: "dave"})
+	c.put("token-4", &models.User{UserID: 4, Username: "dave"})
+	assert.Equal(t, int64(3), sumCounts(c.evictionCounts()))
+
+	var disabled *userCache
+	assert.Nil(t, disabled.evictionCounts())
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	max, err := cacheMaxEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, defaultCacheMaxEntries, max)
+
+	restore := setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_CACHE_MAX_ENTRIES": "0"})
+	max, err = cacheMaxEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, max)
+	restore()
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_CACHE_MAX_ENTRIES": "-1"})()
+	_, err = cacheMaxEntries()
+	assert.NotNil(t, err)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newUserCache(newAdaptiveTTL(time.Minute, time.Minute, false))
+	c.maxEntries = 3
+
+	for _, token := range []string{"token-1", "token-2", "token-3"} {
+		c.put(token, &models.User{Username: token})
+	}
+	// token-1 is served and token-2 re-cached, leaving token-3 the least recently used
+	_, ok := c.get("token-1")
+	assert.True(t, ok)
+	c.put("token-2", &models.User{Username: "token-2"})
+
+	c.put("token-4", &models.User{Username: "token-4"})
+	c.put("token-5", &models.User{Username: "token-5"})
+	n, bytes := c.size()
+	assert.Equal(t, 3, n)
+	for token, cached := range map[string]bool{"token-1": false, "token-2": true, "token-3": false, "token-4": true, "token-5": true} {
+		_, ok := c.get(token)
+		assert.Equal(t, cached, ok, token)
+	}
+	assert.Equal(t, int64(2), c.evictionCounts()[evictionCapacity])
+	assert.Equal(t, 3, c.recency.Len())
+
+	// the byte estimate follows the evictions
+	for _, token := range []string{"token-2", "token-4", "token-5"} {
+		c.invalidateToken(token)
+	}
+	assert.True(t, bytes > 0)
+	n, bytes = c.size()
+	assert.Equal(t, 0, n)
+	assert.Equal(t, int64(0), bytes)
+	assert.Equal(t, 0, c.recency.Len())
+}
+
+func sumCounts(counts map[string]int64) int64 {
+	var n int64
+	for _, v := range counts {
+		n += v
+	}
+	return n
+}
@@ -0,0 +1,47 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Command rackspace-auth-check reads a kubernetes-auth token from stdin, reviews it with the
+// backend configured by the RACKSPACE_MK8S_AUTH_* env vars exactly like Harbor does, and prints
+// the backend's response and how its user would be mapped to Harbor. Harbor's database isn't
+// touched, e.g.
+//
+//	RACKSPACE_MK8S_AUTH_URL=https://auth.mk8s.local rackspace-auth-check < token
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/vmware/harbor/src/ui/auth/rackspace"
+)
+
+// maxTokenSize bounds what is read from stdin
+const maxTokenSize = 1 << 20
+
+func main() {
+	token, err := ioutil.ReadAll(io.LimitReader(os.Stdin, maxTokenSize))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read the token from stdin: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := rackspace.DryRun(context.Background(), string(token), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to review the token: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// DBCheckPolicy decides what the startup check of Harbor's database does when it's unreachable
+type DBCheckPolicy string
+
+const (
+	// DBCheckOff skips the check, the first login is then the first to reach the database
+	DBCheckOff DBCheckPolicy = "off"
+	// DBCheckWarn logs an error and starts anyway
+	DBCheckWarn DBCheckPolicy = "warn"
+	// DBCheckFail fails the startup
+	DBCheckFail DBCheckPolicy = "fail"
+)
+
+// adminUserID is the ID of Harbor's admin, which always exists
+const adminUserID = 1
+
+// dbCheckPolicy returns the configured database check policy, skipping the check by default
+func dbCheckPolicy() (DBCheckPolicy, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_DB_CHECK"
+
+	policy := DBCheckPolicy(envOrDefault(envVar, string(DBCheckOff)))
+	if policy != DBCheckOff && policy != DBCheckWarn && policy != DBCheckFail {
+		return "", fmt.Errorf("The env var %s is not a valid policy, expected %q, %q or %q", envVar, DBCheckOff, DBCheckWarn, DBCheckFail)
+	}
+	return policy, nil
+}
+
+// CheckDatabase checks Harbor's database can be read, as every login depends on it, when
+// RACKSPACE_MK8S_AUTH_DB_CHECK is warn or fail. It must be called once the database is initialized.
+func CheckDatabase() error {
+	policy, err := dbCheckPolicy()
+	if err != nil || registered == nil {
+		return err
+	}
+	return registered.resolver.checkDatabase(policy)
+}
+
+// checkDatabase reads the admin user, returning the error of an unreachable database with
+// DBCheckFail and only logging it with DBCheckWarn
+func (r *UserResolver) checkDatabase(policy DBCheckPolicy) error {
+	if policy == DBCheckOff {
+		return nil
+	}
+
+	start := time.Now()
+	if _, err := r.Store.GetUser(models.User{UserID: adminUserID}); err != nil {
+		err = fmt.Errorf("Harbor's database is unreachable: %v", err)
+		if policy == DBCheckFail {
+			return err
+		}
+		log.Errorf("%v, logins will fail until it is reachable", err)
+		return nil
+	}
+
+	log.Infof("Harbor's database is reachable, checked in %v", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestCheckDatabase(t *testing.T) {
+	store := &fakeStore{users: []models.User{{UserID: adminUserID, Username: "admin"}}}
+	r := &UserResolver{Store: store}
+
+	for _, policy := range []DBCheckPolicy{DBCheckOff, DBCheckWarn, DBCheckFail} {
+		assert.Nil(t, r.checkDatabase(policy))
+	}
+
+	store.err = errors.New("dial tcp 10.0.0.5:5432: connect: connection refused")
+	err := r.checkDatabase(DBCheckFail)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "database is unreachable")
+		assert.Contains(t, err.Error(), "connection refused")
+	}
+	assert.Nil(t, r.checkDatabase(DBCheckWarn))
+	assert.Nil(t, r.checkDatabase(DBCheckOff))
+}
+
+func TestDBCheckPolicy(t *testing.T) {
+	policy, err := dbCheckPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, DBCheckOff, policy)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_DB_CHECK": "fail"})()
+	policy, err = dbCheckPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, DBCheckFail, policy)
+
+	restore := setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_DB_CHECK": "panic"})
+	defer restore()
+	_, err = dbCheckPolicy()
+	assert.NotNil(t, err)
+}
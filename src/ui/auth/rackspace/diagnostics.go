@@ -0,0 +1,141 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vmware/harbor/src/common/notifier"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// CachedIdentitySummary describes a cached user for admin diagnostics. The tokens themselves are
+// never exposed, only the hashes the entries are keyed by.
+type CachedIdentitySummary struct {
+	// Key is the hash of the token the user was resolved from
+	Key      string
+	Username string
+	// UID is the backend's static ID of the user
+	UID          string
+	RemainingTTL time.Duration
+}
+
+// ListCachedIdentities returns the unexpired cached users, sorted by username. It is empty when
+// caching is disabled.
+func (a *Auth) ListCachedIdentities() []CachedIdentitySummary {
+	return a.cache.list()
+}
+
+// Invalidate evicts the cached entries of the user with the username or UID, so the next login
+// of that user is validated by the backend again. It returns the number of evicted entries.
+func (a *Auth) Invalidate(usernameOrUID string) int {
+	n := a.cache.invalidate(usernameOrUID)
+	log.Infof("Invalidated %d cached entries of %s", n, usernameOrUID)
+	return n
+}
+
+func (c *userCache) list() []CachedIdentitySummary {
+	summaries := []CachedIdentitySummary{}
+	if c == nil {
+		return summaries
+	}
+
+	ttl := c.ttl.get()
+
+	c.Lock()
+	defer c.Unlock()
+	now := c.now()
+	for key, e := range c.entries {
+		remaining := ttl - now.Sub(e.created)
+		if remaining <= 0 {
+			continue
+		}
+		summaries = append(summaries, CachedIdentitySummary{
+			Key:          key,
+			Username:     e.user.Username,
+			UID:          userUID(&e.user),
+			RemainingTTL: remaining,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Username != summaries[j].Username {
+			return summaries[i].Username < summaries[j].Username
+		}
+		return summaries[i].Key < summaries[j].Key
+	})
+	return summaries
+}
+
+// invalidateUser evicts the entries of the Harbor user with the ID
+func (c *userCache) invalidateUser(userID int) int {
+	if c == nil {
+		return 0
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	n := 0
+	for key, e := range c.entries {
+		if e.user.UserID == userID {
+			c.remove(key, evictionInvalidated)
+			n++
+		}
+	}
+	return n
+}
+
+// userDeletedHandler evicts the cached entries of the users deleted in Harbor, so they can't keep
+// logging in from the cache until their entries expire
+type userDeletedHandler struct {
+	cache *userCache
+}
+
+// Handle ...
+func (h *userDeletedHandler) Handle(value interface{}) error {
+	n, ok := value.(notifier.UserDeletedNotification)
+	if !ok {
+		return fmt.Errorf("unexpected %s notification value %T", notifier.UserDeletedTopic, value)
+	}
+
+	evicted := h.cache.invalidateUser(n.UserID)
+	log.Debugf("UID=%s UserID=%d Evicted %d cached entries of deleted user", n.Realname, n.UserID, evicted)
+	return nil
+}
+
+// IsStateful ...
+func (h *userDeletedHandler) IsStateful() bool {
+	return false
+}
+
+// invalidate evicts the entries whose username or UID is usernameOrUID
+func (c *userCache) invalidate(usernameOrUID string) int {
+	if c == nil || usernameOrUID == "" {
+		return 0
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	n := 0
+	for key, e := range c.entries {
+		if e.user.Username == usernameOrUID || userUID(&e.user) == usernameOrUID {
+			c.remove(key, evictionInvalidated)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+func newDiagnosticsAuth(t *testing.T) (*Auth, *fakeClock) {
+	a := &Auth{cache: newUserCache(newAdaptiveTTL(time.Minute, time.Minute, false))}
+	clock := &fakeClock{t: time.Now()}
+	a.cache.now = clock.now
+
+	a.cache.put("token-alice-1", &models.User{UserID: 1, Username: "alice", Realname: "uid-alice"})
+	clock.t = clock.t.Add(10 * time.Second)
+	a.cache.put("token-alice-2", &models.User{UserID: 1, Username: "alice", Realname: "uid-alice"})
+	a.cache.put("token-bob", &models.User{UserID: 2, Username: "bob", Realname: "uid-bob"})
+	return a, clock
+}
+
+func TestListCachedIdentities(t *testing.T) {
+	a, clock := newDiagnosticsAuth(t)
+	clock.t = clock.t.Add(20 * time.Second)
+
+	identities := a.ListCachedIdentities()
+	if assert.Len(t, identities, 3) {
+		assert.Equal(t, CachedIdentitySummary{Key: tokenKey("token-bob"), Username: "bob", UID: "uid-bob", RemainingTTL: 40 * time.Second}, identities[2])
+		for _, id := range identities[:2] {
+			assert.Equal(t, "alice", id.Username)
+			assert.Equal(t, "uid-alice", id.UID)
+			assert.NotContains(t, id.Key, "token")
+		}
+	}
+
+	// expired entries aren't listed
+	clock.t = clock.t.Add(35 * time.Second)
+	identities = a.ListCachedIdentities()
+	assert.Len(t, identities, 2)
+
+	assert.Empty(t, (&Auth{}).ListCachedIdentities())
+}
+
+func TestInvalidate(t *testing.T) {
+	a, _ := newDiagnosticsAuth(t)
+
+	assert.Equal(t, 2, a.Invalidate("alice"))
+	_, ok := a.cache.get("token-alice-1")
+	assert.False(t, ok)
+	_, ok = a.cache.get("token-bob")
+	assert.True(t, ok)
+
+	assert.Equal(t, 1, a.Invalidate("uid-bob"))
+	assert.Equal(t, 0, a.Invalidate("carol"))
+	assert.Empty(t, a.ListCachedIdentities())
+	_, bytes := a.cache.size()
+	assert.Equal(t, int64(0), bytes)
+
+	assert.Equal(t, 0, (&Auth{}).Invalidate("alice"))
+}
+
+func TestDeletedUserEvicted(t *testing.T) {
+	a, _ := newDiagnosticsAuth(t)
+	handler := &userDeletedHandler{cache: a.cache}
+	// replace the handler of the authenticator registered by init
+	notifier.UnSubscribe(notifier.UserDeletedTopic, "")
+	assert.Nil(t, notifier.Subscribe(notifier.UserDeletedTopic, handler))
+	defer notifier.UnSubscribe(notifier.UserDeletedTopic, "")
+
+	assert.Nil(t, notifier.Publish(notifier.UserDeletedTopic, notifier.UserDeletedNotification{UserID: 1, Username: "alice", Realname: "uid-alice"}))
+
+	// the notifications are handled asynchronously
+	deadline := time.Now().Add(time.Second)
+	for len(a.ListCachedIdentities()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	identities := a.ListCachedIdentities()
+	if assert.Len(t, identities, 1) {
+		assert.Equal(t, "bob", identities[0].Username)
+	}
+
+	assert.NotNil(t, handler.Handle("alice"))
+}
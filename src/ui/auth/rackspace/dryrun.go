@@ -0,0 +1,88 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// DryRun reviews token with the backend of the registered authenticator and writes the decoded
+// response and how its user would be mapped to Harbor to w. See Auth.DryRun.
+func DryRun(ctx context.Context, token string, w io.Writer) error {
+	return registered.DryRun(ctx, token, w)
+}
+
+// DryRun reviews token with the backend like a login does, and writes the decoded response and
+// how its user would be mapped to Harbor to w, for support engineers debugging a token in the
+// field. Neither the cache nor the database is used, so nothing is created or updated.
+func (a *Auth) DryRun(ctx context.Context, token string, w io.Writer) error {
+	m := models.AuthModel{Password: strings.TrimSpace(token)}
+	if m.Password == "" {
+		return ErrInvalidToken
+	}
+
+	authResp, err := a.reviewContext(ctx, m)
+	if err != nil {
+		return err
+	}
+	return a.printDryRun(w, authResp)
+}
+
+// printDryRun writes the response and the mapping decision of its user
+func (a *Auth) printDryRun(w io.Writer, authResp *AuthResponse) error {
+	body, err := json.MarshalIndent(authResp, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "AuthResponse:\n%s\n\nMapping:\n", body)
+
+	id := authResp.identity()
+	if err := a.audiences.check(id); err != nil {
+		fmt.Fprintf(w, "  decision:       rejected, %v\n", err)
+		return nil
+	}
+	id.Username = withUsernameClaim(id, a.usernameClaim)
+	id.Groups = withExtraGroups(id, a.extraGroupsKey)
+	id = a.resolver.harborIdentity(id)
+
+	decision := "accepted"
+	switch {
+	case !authResp.Status.Authenticated:
+		decision = "rejected, " + ErrNotAuthenticated.Error()
+	case a.resolver.isAdmin(id.Username):
+		decision = "rejected, " + ErrReservedUsername.Error()
+	}
+	uidField := a.resolver.UIDField
+	if uidField == "" {
+		uidField = UIDFieldExternalID
+	}
+	groupSync := "off"
+	if a.resolver.Groups != nil {
+		groupSync = "on"
+	}
+
+	fmt.Fprintf(w, "  decision:       %s\n", decision)
+	fmt.Fprintf(w, "  harborUsername: %s\n", id.Username)
+	fmt.Fprintf(w, "  uid:            %s (stored in %s)\n", id.UID, uidField)
+	fmt.Fprintf(w, "  groups:         %s (group sync %s)\n", strings.Join(canonicalGroups(id.Groups), ","), groupSync)
+	fmt.Fprintf(w, "  emailDomain:    %s\n", a.resolver.emailDomains.domain(id.Groups))
+	return nil
+}
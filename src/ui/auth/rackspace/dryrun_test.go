@@ -0,0 +1,74 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":             fb.URL,
+		"RACKSPACE_MK8S_AUTH_USERNAME_PREFIX": "mk8s:",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	store := &fakeStore{}
+	a.resolver.Store = store
+
+	var out bytes.Buffer
+	assert.Nil(t, a.DryRun(context.Background(), " token\n", &out))
+	assert.Equal(t, "token", fb.lastRequest.Spec.Token)
+
+	printed := out.String()
+	assert.Contains(t, printed, `"username": "alice"`)
+	assert.Contains(t, printed, "decision:       accepted")
+	assert.Contains(t, printed, "harborUsername: mk8s:alice")
+	assert.Contains(t, printed, "uid:            uid-alice (stored in external_id)")
+	assert.Contains(t, printed, "emailDomain:    "+defaultEmailDomain)
+
+	// nothing is written to the database
+	assert.Equal(t, 0, store.registers)
+	assert.Equal(t, 0, store.updates)
+
+	assert.Equal(t, ErrInvalidToken, a.DryRun(context.Background(), "  ", &out))
+}
+
+func TestDryRunRejected(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":            fb.URL,
+		"RACKSPACE_MK8S_AUTH_ADMIN_USERNAME": "alice",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	assert.Nil(t, a.DryRun(context.Background(), "token", &out))
+	assert.Contains(t, out.String(), "decision:       rejected, "+ErrReservedUsername.Error())
+
+	// the backend's errors are returned as they are
+	fb.status = 401
+	assert.NotNil(t, a.DryRun(context.Background(), "token", &out))
+}
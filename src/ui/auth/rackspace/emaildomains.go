@@ -0,0 +1,163 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// emailDomainMapping maps the backend's group names to the domains of the synthetic emails of
+// their members, e.g. "tenant-a=a.example.com,tenant-b=b.example.com", so that the emails reflect
+// the tenant of multi-tenant setups. The local part of a synthetic email is always the username,
+// which is unique in Harbor, so the emails stay unique whatever the domain.
+type emailDomainMapping map[string]string
+
+// emailDomains returns the configured email domain mapping, or nil if none is configured, once
+// its domains are checked against the deliverable email domain policy
+func emailDomains() (emailDomainMapping, error) {
+	edm, err := parseEmailDomainMapping(os.Getenv("RACKSPACE_MK8S_AUTH_EMAIL_DOMAINS"))
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := deliverableEmailDomainPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if err := edm.checkDeliverable(policy); err != nil {
+		return nil, err
+	}
+	return edm, nil
+}
+
+// DeliverableEmailDomainPolicy decides what's done with mapped email domains which aren't reserved,
+// to which the synthetic emails could be delivered should Harbor ever send notifications
+type DeliverableEmailDomainPolicy string
+
+const (
+	// DeliverableEmailDomainWarn logs a warning for each deliverable domain
+	DeliverableEmailDomainWarn DeliverableEmailDomainPolicy = "warn"
+	// DeliverableEmailDomainFail fails the configuration
+	DeliverableEmailDomainFail DeliverableEmailDomainPolicy = "fail"
+	// DeliverableEmailDomainAllow accepts them, e.g. for domains known to have no mail server
+	DeliverableEmailDomainAllow DeliverableEmailDomainPolicy = "allow"
+)
+
+// deliverableEmailDomainPolicy returns the configured deliverable email domain policy, warning by default
+func deliverableEmailDomainPolicy() (DeliverableEmailDomainPolicy, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_DELIVERABLE_EMAIL_DOMAINS"
+
+	policy := DeliverableEmailDomainPolicy(envOrDefault(envVar, string(DeliverableEmailDomainWarn)))
+	switch policy {
+	case DeliverableEmailDomainWarn, DeliverableEmailDomainFail, DeliverableEmailDomainAllow:
+		return policy, nil
+	}
+	return "", fmt.Errorf("The env var %s is not a valid policy, expected %q, %q or %q", envVar, DeliverableEmailDomainWarn, DeliverableEmailDomainFail, DeliverableEmailDomainAllow)
+}
+
+// reservedTLDs are the top level domains RFC 2606 and RFC 6761 reserve, which are never delegated
+var reservedTLDs = map[string]bool{"invalid": true, "test": true, "example": true, "localhost": true}
+
+// reservedDomains are the second level domains RFC 2606 reserves for documentation
+var reservedDomains = map[string]bool{"example.com": true, "example.net": true, "example.org": true}
+
+// isReservedDomain reports whether no mail can be delivered to domain, it or its parents being reserved
+func isReservedDomain(domain string) bool {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(domain), "."), ".")
+	n := len(labels)
+	if reservedTLDs[labels[n-1]] {
+		return true
+	}
+	return n >= 2 && reservedDomains[labels[n-2]+"."+labels[n-1]]
+}
+
+// checkDeliverable applies policy to the mapped domains which aren't reserved
+func (edm emailDomainMapping) checkDeliverable(policy DeliverableEmailDomainPolicy) error {
+	if policy == DeliverableEmailDomainAllow {
+		return nil
+	}
+
+	groups := make([]string, 0, len(edm))
+	for group := range edm {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for _, group := range groups {
+		domain := edm[group]
+		if isReservedDomain(domain) {
+			continue
+		}
+		if policy == DeliverableEmailDomainFail {
+			return fmt.Errorf("The email domain %s of group %s isn't reserved and could receive the synthetic emails, use a domain under .invalid", domain, group)
+		}
+		log.Warningf("The email domain %s of group %s isn't reserved and could receive the synthetic emails, consider a domain under .invalid", domain, group)
+	}
+	return nil
+}
+
+func parseEmailDomainMapping(s string) (emailDomainMapping, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	edm := emailDomainMapping{}
+	for _, entry := range strings.Split(s, ",") {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid email domain %q, expected group=domain", entry)
+		}
+		group, domain := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if group == "" || domain == "" || strings.ContainsAny(domain, "@ \t\r\n") {
+			return nil, fmt.Errorf("invalid email domain %q, expected a group and a domain without \"@\" or whitespace", entry)
+		}
+		edm[group] = domain
+	}
+
+	return edm, nil
+}
+
+// domain returns the domain of the user's primary group, the first of its sorted groups which is
+// mapped, or defaultEmailDomain when none is. Sorting the groups keeps the domain stable whatever
+// the order the backend returns them in.
+func (edm emailDomainMapping) domain(groups []string) string {
+	if len(edm) > 0 {
+		for _, group := range canonicalGroups(groups) {
+			if domain, ok := edm[group]; ok {
+				return domain
+			}
+		}
+	}
+	return defaultEmailDomain
+}
+
+// isSynthetic reports whether email is an address made up by emailAddress, with the default, the
+// legacy or a mapped domain
+func (edm emailDomainMapping) isSynthetic(email string) bool {
+	if strings.HasSuffix(email, "@"+defaultEmailDomain) || strings.HasSuffix(email, "@"+legacyEmailDomain) {
+		return true
+	}
+	for _, domain := range edm {
+		if strings.HasSuffix(email, "@"+domain) {
+			return true
+		}
+	}
+	return false
+}
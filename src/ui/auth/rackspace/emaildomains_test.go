@@ -0,0 +1,130 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestParseEmailDomainMapping(t *testing.T) {
+	edm, err := parseEmailDomainMapping("")
+	assert.Nil(t, err)
+	assert.Nil(t, edm)
+
+	edm, err = parseEmailDomainMapping("tenant-a=a.example.com, tenant-b = b.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, emailDomainMapping{"tenant-a": "a.example.com", "tenant-b": "b.example.com"}, edm)
+
+	for _, invalid := range []string{"tenant-a", "=a.example.com", "tenant-a=", "tenant-a=x@a.example.com", "tenant-a=a example.com"} {
+		_, err := parseEmailDomainMapping(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestEmailDomainMappingDomain(t *testing.T) {
+	edm := emailDomainMapping{"tenant-a": "a.example.com", "tenant-b": "b.example.com"}
+
+	// the first mapped group in sorted order wins, whatever the backend's order
+	assert.Equal(t, "a.example.com", edm.domain([]string{"devs", "tenant-b", "tenant-a"}))
+	assert.Equal(t, "b.example.com", edm.domain([]string{"devs", "tenant-b"}))
+	assert.Equal(t, defaultEmailDomain, edm.domain([]string{"devs"}))
+	assert.Equal(t, defaultEmailDomain, emailDomainMapping(nil).domain([]string{"tenant-a"}))
+
+	assert.True(t, edm.isSynthetic("alice@b.example.com"))
+	assert.True(t, edm.isSynthetic("alice@"+defaultEmailDomain))
+	assert.False(t, edm.isSynthetic("alice@example.com"))
+}
+
+func TestResolveEmailDomains(t *testing.T) {
+	store := &fakeStore{}
+	r := &UserResolver{Store: store, emailDomains: emailDomainMapping{"tenant-a": "a.example.com", "tenant-b": "b.example.com"}}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"tenant-a"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice@a.example.com", user.Email)
+
+	// users in no mapped group fall back to the default domain
+	user, err = r.Resolve(Identity{Username: "carol", UID: "uid-carol", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "carol@"+defaultEmailDomain, user.Email)
+
+	// emails stay unique across tenants, as their local part is the unique Harbor username
+	bob, err := r.Resolve(Identity{Username: "bob", UID: "uid-bob", Groups: []string{"tenant-a"}})
+	assert.Nil(t, err)
+	bob2, err := r.Resolve(Identity{Username: "bob2", UID: "uid-bob2", Groups: []string{"tenant-b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "bob@a.example.com", bob.Email)
+	assert.Equal(t, "bob2@b.example.com", bob2.Email)
+
+	// a synthetic email of a mapped domain follows renames like the default one
+	renamed, err := r.Resolve(Identity{Username: "alicia", UID: "uid-alice", Groups: []string{"tenant-b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "alicia@b.example.com", renamed.Email)
+}
+
+func TestEmailAddressDomain(t *testing.T) {
+	assert.Equal(t, "alice@a.example.com", emailAddress(&models.User{Username: "alice"}, "a.example.com"))
+	assert.Equal(t, "alice@example.com", emailAddress(&models.User{Username: "alice", Email: "alice@example.com"}, "a.example.com"))
+}
+
+func TestEmailDomainsFromEnv(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_EMAIL_DOMAINS": "tenant-a"})()
+	_, err := setupAuth()
+	assert.NotNil(t, err)
+}
+
+func TestIsReservedDomain(t *testing.T) {
+	for _, domain := range []string{defaultEmailDomain, "a.tenant.invalid", "mk8s.test", "EXAMPLE.COM", "a.example.org.", "localhost"} {
+		assert.True(t, isReservedDomain(domain), domain)
+	}
+	for _, domain := range []string{legacyEmailDomain, "rackspace.com", "example.com.au", "invalid.com", "mail.example.co"} {
+		assert.False(t, isReservedDomain(domain), domain)
+	}
+}
+
+func TestCheckDeliverableEmailDomains(t *testing.T) {
+	edm := emailDomainMapping{"tenant-a": "a.example.com", "tenant-b": "b.rackspace.com"}
+	assert.Nil(t, edm.checkDeliverable(DeliverableEmailDomainWarn))
+	assert.Nil(t, edm.checkDeliverable(DeliverableEmailDomainAllow))
+	err := edm.checkDeliverable(DeliverableEmailDomainFail)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "b.rackspace.com")
+	}
+
+	reserved := emailDomainMapping{"tenant-a": "a.example.com", "tenant-b": "b.mk8s.invalid"}
+	assert.Nil(t, reserved.checkDeliverable(DeliverableEmailDomainFail))
+
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_EMAIL_DOMAINS":             "tenant-b=b.rackspace.com",
+		"RACKSPACE_MK8S_AUTH_DELIVERABLE_EMAIL_DOMAINS": "fail",
+	})()
+	_, err = emailDomains()
+	assert.NotNil(t, err)
+
+	restore := setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_DELIVERABLE_EMAIL_DOMAINS": "deny"})
+	defer restore()
+	_, err = deliverableEmailDomainPolicy()
+	assert.NotNil(t, err)
+}
+
+func TestIsSyntheticLegacyDomain(t *testing.T) {
+	var edm emailDomainMapping
+	assert.True(t, edm.isSynthetic("alice@"+defaultEmailDomain))
+	assert.True(t, edm.isSynthetic("alice@"+legacyEmailDomain))
+	assert.False(t, edm.isSynthetic("alice@rackspace.com"))
+}
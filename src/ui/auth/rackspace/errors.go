@@ -0,0 +1,260 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+)
+
+// ErrInvalidSignature is returned when the backend response signature does not match its body
+var ErrInvalidSignature = errors.New("auth response signature verification failed")
+
+// ErrInvalidToken is returned without contacting the backend when the token is empty or only whitespace
+var ErrInvalidToken = errors.New("the token is empty")
+
+// ErrTokenExpired is returned without contacting the backend when a locally verified token has expired
+var ErrTokenExpired = errors.New("the token has expired")
+
+// ErrOverloaded is returned when too many requests to kubernetes-auth are already in flight
+var ErrOverloaded = errors.New("too many concurrent auth requests, try again later")
+
+// ErrUntrustedRedirect is returned when the backend redirects a request to another host, which would forward the token
+var ErrUntrustedRedirect = errors.New("auth request redirected to an untrusted host")
+
+// ErrPrincipalMismatch is returned when the username given at login isn't the user of the token
+var ErrPrincipalMismatch = errors.New("the username does not match the token's user")
+
+// ErrAudienceMismatch is returned when the token isn't valid for the configured audiences
+var ErrAudienceMismatch = errors.New("the token is not valid for this audience")
+
+// ErrReservedUsername is returned when the token's user would be Harbor's admin, which the backend can't manage
+var ErrReservedUsername = errors.New("the username is reserved")
+
+// ErrUnknownServiceAccount is returned when the Harbor user a client certificate is mapped to doesn't exist
+var ErrUnknownServiceAccount = errors.New("the service account's user does not exist")
+
+// ErrNotAuthenticated is returned when the backend reviews the token without authenticating its user
+var ErrNotAuthenticated = errors.New("the backend did not authenticate the token")
+
+// ErrUserDeleted is returned when the user logging in was deleted in Harbor and the policy is to reject it
+var ErrUserDeleted = errors.New("the user has been deleted")
+
+// ErrTooManyAttempts is matched, with errors.Is, by the errors of logins throttled by their source IP
+var ErrTooManyAttempts = errors.New("too many login attempts, try again later")
+
+// TooManyAttemptsError is returned without contacting the backend when a source IP made more
+// login attempts than the rate limit allows
+type TooManyAttemptsError struct {
+	ClientIP string
+	// RetryAfter is the time until the next attempt from ClientIP is allowed
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%v ClientIP=%s RetryAfter=%v", ErrTooManyAttempts, e.ClientIP, e.RetryAfter)
+}
+
+// Is makes errors.Is(err, ErrTooManyAttempts) true
+func (e *TooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// ErrBackendProtocol is matched, with errors.Is, by the errors of responses which aren't valid TokenReviews
+var ErrBackendProtocol = errors.New("invalid auth response")
+
+// ErrNoStatus and ErrEmptyStatus are the errors, wrapped in a *BackendProtocolError, of 200 OK
+// responses without a status object, or with an empty one
+var (
+	ErrNoStatus    = errors.New("backend returned no status")
+	ErrEmptyStatus = errors.New("backend returned an empty status")
+)
+
+// maxSnippetLength is the number of bytes of an invalid response kept in its error
+const maxSnippetLength = 64
+
+// secretLike matches the runs of characters long enough to be tokens or other secrets
+var secretLike = regexp.MustCompile(`[A-Za-z0-9+/=._~-]{16,}`)
+
+// BackendProtocolError is returned when the backend's response can't be decoded, telling a
+// misbehaving backend apart from rejected tokens and unreachable backends
+type BackendProtocolError struct {
+	ContentType string
+	// Snippet is the start of the response, with anything looking like a secret redacted
+	Snippet string
+	Err     error
+}
+
+func newBackendProtocolError(contentType string, body []byte, err error) *BackendProtocolError {
+	return &BackendProtocolError{ContentType: contentType, Snippet: redactedSnippet(body), Err: err}
+}
+
+func (e *BackendProtocolError) Error() string {
+	return fmt.Sprintf("%v: %v ContentType=%q AuthResponseSnippet=%q", ErrBackendProtocol, e.Err, e.ContentType, e.Snippet)
+}
+
+// Is makes errors.Is(err, ErrBackendProtocol) true
+func (e *BackendProtocolError) Is(target error) bool {
+	return target == ErrBackendProtocol
+}
+
+func (e *BackendProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// redactedSnippet returns the start of body, with the unprintable characters replaced and the
+// ones looking like secrets redacted
+func redactedSnippet(body []byte) string {
+	s := string(body)
+	truncated := len(s) > maxSnippetLength
+	if truncated {
+		s = s[:maxSnippetLength]
+	}
+	s = strings.Map(func(r rune) rune {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return '?'
+		}
+		return r
+	}, s)
+	s = secretLike.ReplaceAllString(s, "[REDACTED]")
+	if truncated {
+		s += "..."
+	}
+	return s
+}
+
+// BackendUnavailableError is returned, when RACKSPACE_MK8S_AUTH_ERROR_DURATION is set, instead of the
+// errors of backends which couldn't be reached, timed out or answered with a server error, telling
+// how long the review waited for the backend, retries included
+type BackendUnavailableError struct {
+	Duration time.Duration
+	// TimedOut is set when a timeout or the caller's deadline ended the wait
+	TimedOut bool
+	// Canceled is set when the caller gave up on the review
+	Canceled bool
+	Err      error
+}
+
+func newBackendUnavailableError(err error, d time.Duration) *BackendUnavailableError {
+	var netErr net.Error
+	return &BackendUnavailableError{
+		Duration: d,
+		TimedOut: errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()),
+		Canceled: errors.Is(err, context.Canceled),
+		Err:      err,
+	}
+}
+
+func (e *BackendUnavailableError) Error() string {
+	return fmt.Sprintf("%v Duration=%v TimedOut=%t Canceled=%t", e.Err, e.Duration.Round(time.Millisecond), e.TimedOut, e.Canceled)
+}
+
+func (e *BackendUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// backendUnavailable reports whether err says the backend couldn't review the token, i.e. it
+// couldn't be reached, timed out or answered with a server error, rather than rejected it or was
+// never asked
+func backendUnavailable(err error) bool {
+	var e *statusError
+	if errors.As(err, &e) {
+		return e.code >= http.StatusInternalServerError
+	}
+	return errors.Is(err, ErrBackendUnavailable) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// ErrBackendUnavailable is matched, with errors.Is, by the errors of requests which couldn't reach
+// the backend
+var ErrBackendUnavailable = errors.New("the auth backend is unavailable")
+
+// BackendConnectionError is returned when no connection to the backend could be made or kept,
+// e.g. when the local ports or file descriptors are exhausted under load
+type BackendConnectionError struct {
+	Err error
+}
+
+func (e *BackendConnectionError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrBackendUnavailable, e.Err)
+}
+
+// Is makes errors.Is(err, ErrBackendUnavailable) true
+func (e *BackendConnectionError) Is(target error) bool {
+	return target == ErrBackendUnavailable
+}
+
+func (e *BackendConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// connectionErrnos are the errors of the system calls failing when the connections to the backend
+// or the resources they need are exhausted
+var connectionErrnos = []syscall.Errno{
+	syscall.EADDRNOTAVAIL,
+	syscall.EMFILE,
+	syscall.ENFILE,
+	syscall.ENOBUFS,
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+}
+
+// connectionError returns the transport error err as a *BackendConnectionError when the backend
+// couldn't be connected to, timed out or dropped the connection, otherwise err itself
+func connectionError(err error) error {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &opErr), errors.As(err, &dnsErr):
+	case errors.As(err, &netErr) && netErr.Timeout():
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+	default:
+		for _, errno := range connectionErrnos {
+			if errors.Is(err, errno) {
+				return &BackendConnectionError{Err: err}
+			}
+		}
+		return err
+	}
+	return &BackendConnectionError{Err: err}
+}
+
+// statusError is returned when kubernetes-auth answers with a status other than 200 OK
+type statusError struct {
+	code int
+	body []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTPStatusCode=%d AuthResponseBody=%s", e.code, e.body)
+}
+
+// MaintenanceError is returned for every login while authentication is disabled for maintenance
+type MaintenanceError struct {
+	Message string
+}
+
+func (e *MaintenanceError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,125 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// defaultFailoverMaxAttempts is the default number of backends a request is sent to
+const defaultFailoverMaxAttempts = 3
+
+// failoverLimits bound the failover of a request across the backends, so that a login can't take
+// the timeouts of every backend when many are configured
+type failoverLimits struct {
+	// maxAttempts is the number of backends tried, the one of the token included
+	maxAttempts int
+	// budget, when set, is the time all the backends share, retries included
+	budget time.Duration
+}
+
+// failoverLimitsFromEnv returns the limits of RACKSPACE_MK8S_AUTH_FAILOVER_MAX_ATTEMPTS and
+// RACKSPACE_MK8S_AUTH_FAILOVER_BUDGET, zero (the default) leaving the time to the backends' timeouts
+func failoverLimitsFromEnv() (failoverLimits, error) {
+	const attemptsEnvVar = "RACKSPACE_MK8S_AUTH_FAILOVER_MAX_ATTEMPTS"
+	const budgetEnvVar = "RACKSPACE_MK8S_AUTH_FAILOVER_BUDGET"
+
+	attempts, err := envInt(attemptsEnvVar, defaultFailoverMaxAttempts)
+	if err != nil {
+		return failoverLimits{}, err
+	}
+	if attempts < 1 {
+		return failoverLimits{}, fmt.Errorf("The env var %s is not a valid number of attempts, expected 1 or more", attemptsEnvVar)
+	}
+
+	budget, err := envDuration(budgetEnvVar, 0)
+	if err != nil {
+		return failoverLimits{}, err
+	}
+	if budget < 0 {
+		return failoverLimits{}, fmt.Errorf("The env var %s is not a valid budget, expected 0 or more", budgetEnvVar)
+	}
+	return failoverLimits{maxAttempts: attempts, budget: budget}, nil
+}
+
+// failover sends the auth request body to the backend of the token and, while the failures are
+// worth retrying, to its failover backends in turn, within the failover limits. Once they're
+// reached the error of the last backend which answered is returned, rather than the budget's
+// deadline.
+func (a *Auth) failover(ctx context.Context, m models.AuthModel, authRequestBody []byte) ([]byte, http.Header, error) {
+	backends := a.backendsFor(m.Password)
+	if len(backends) == 1 {
+		authRespBody, header, _, err := a.postBackend(ctx, m, backends[0], authRequestBody)
+		return authRespBody, header, err
+	}
+
+	budgetCtx := ctx
+	if a.failoverLimits.budget > 0 {
+		var cancel context.CancelFunc
+		budgetCtx, cancel = context.WithTimeout(ctx, a.failoverLimits.budget)
+		defer cancel()
+	}
+
+	var lastErr error
+	for i, b := range backends {
+		if i >= a.failoverLimits.maxAttempts {
+			log.Warningf("ProvidedUsername=%s Failover limit of %d backends reached, giving up", m.Principal, a.failoverLimits.maxAttempts)
+			return nil, nil, lastErr
+		}
+		if i > 0 {
+			log.Warningf("ProvidedUsername=%s Failing over to backend %s: %v", m.Principal, b.name, lastErr)
+		}
+
+		authRespBody, header, retryable, err := a.postBackend(budgetCtx, m, b, authRequestBody)
+		if err == nil {
+			return authRespBody, header, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+		if budgetCtx.Err() != nil {
+			log.Warningf("ProvidedUsername=%s Failover budget of %v exhausted after %d backends, giving up", m.Principal, a.failoverLimits.budget, i+1)
+			if err == budgetCtx.Err() && lastErr != nil {
+				err = lastErr
+			}
+			return nil, nil, err
+		}
+		if !retryable {
+			return nil, nil, err
+		}
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
+
+// postBackend is post, recording the health of b as the failover sees it: unhealthy when its
+// failure is worth failing over, healthy once it reviews a token. The other errors, e.g. the 401
+// of a rejected token, and the requests the caller gave up on say nothing about it.
+func (a *Auth) postBackend(ctx context.Context, m models.AuthModel, b *backend, authRequestBody []byte) ([]byte, http.Header, bool, error) {
+	authRespBody, header, retryable, err := a.post(ctx, m, b, authRequestBody)
+	switch {
+	case err == nil:
+		a.health.succeeded(endpointHost(b.url))
+	case retryable:
+		a.health.failed(endpointHost(b.url))
+	}
+	return authRespBody, header, retryable, err
+}
@@ -0,0 +1,155 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// failoverEnv configures the default backend and the named ones, failing over to the latter in order
+func failoverEnv(primary *fakeBackend, named map[string]string, order string) map[string]string {
+	env := map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":               primary.URL,
+		"RACKSPACE_MK8S_AUTH_FAILOVER_BACKENDS": order,
+	}
+	backends := ""
+	for name, url := range named {
+		if backends != "" {
+			backends += ","
+		}
+		backends += name
+		env["RACKSPACE_MK8S_AUTH_BACKEND_"+name+"_URL"] = url
+	}
+	env["RACKSPACE_MK8S_AUTH_BACKENDS"] = backends
+	return env
+}
+
+func TestFailover(t *testing.T) {
+	primary, one, two := newFakeBackend(t), newFakeBackend(t), newFakeBackend(t)
+	defer primary.Close()
+	defer one.Close()
+	defer two.Close()
+	primary.status = http.StatusServiceUnavailable
+	one.status = http.StatusBadGateway
+	defer setEnv(t, failoverEnv(primary, map[string]string{"ONE": one.URL, "TWO": two.URL}, "ONE,TWO"))()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Contains(t, configSummary(a), "failover=ONE,TWO,maxAttempts=3")
+
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 1, 1}, []int{primary.requests, one.requests, two.requests})
+
+	// a rejected token isn't sent to the other backends
+	primary.status = http.StatusUnauthorized
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.NotNil(t, err)
+	assert.Equal(t, []int{2, 1, 1}, []int{primary.requests, one.requests, two.requests})
+}
+
+func TestFailoverMaxAttempts(t *testing.T) {
+	primary, one, two := newFakeBackend(t), newFakeBackend(t), newFakeBackend(t)
+	defer primary.Close()
+	defer one.Close()
+	defer two.Close()
+	primary.status = http.StatusServiceUnavailable
+	one.status = http.StatusBadGateway
+	two.status = http.StatusInternalServerError
+	env := failoverEnv(primary, map[string]string{"ONE": one.URL, "TWO": two.URL}, "ONE,TWO")
+	env["RACKSPACE_MK8S_AUTH_FAILOVER_MAX_ATTEMPTS"] = "2"
+	defer setEnv(t, env)()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	if assert.IsType(t, &statusError{}, err) {
+		assert.Equal(t, http.StatusBadGateway, err.(*statusError).code)
+	}
+	assert.Equal(t, []int{1, 1, 0}, []int{primary.requests, one.requests, two.requests})
+}
+
+func TestFailoverBudget(t *testing.T) {
+	primary, two := newFakeBackend(t), newFakeBackend(t)
+	defer primary.Close()
+	defer two.Close()
+	primary.status = http.StatusServiceUnavailable
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	env := failoverEnv(primary, map[string]string{"SLOW": slow.URL, "TWO": two.URL}, "SLOW,TWO")
+	env["RACKSPACE_MK8S_AUTH_FAILOVER_BUDGET"] = "100ms"
+	defer setEnv(t, env)()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	// the budget runs out on the slow backend, the primary's failure is returned
+	start := time.Now()
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.True(t, time.Since(start) < 5*time.Second)
+	if assert.IsType(t, &statusError{}, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, err.(*statusError).code)
+	}
+	assert.Equal(t, 0, two.requests)
+}
+
+func TestFailoverChain(t *testing.T) {
+	one, two := &backend{name: "one"}, &backend{name: "two"}
+	br := &backendRouter{routes: []backendRoute{{prefix: "v2.", backend: two}}, failover: []*backend{one, two, nil}}
+
+	assert.Equal(t, []*backend{nil, one, two}, br.chain("token"))
+	assert.Equal(t, []*backend{two, one, nil}, br.chain("v2.token"))
+
+	var none *backendRouter
+	assert.Equal(t, []*backend{nil}, none.chain("token"))
+}
+
+func TestFailoverLimitsInvalid(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"RACKSPACE_MK8S_AUTH_FAILOVER_MAX_ATTEMPTS": "0"},
+		{"RACKSPACE_MK8S_AUTH_FAILOVER_BUDGET": "-1s"},
+		{"RACKSPACE_MK8S_AUTH_FAILOVER_BUDGET": "soon"},
+	} {
+		restore := setEnv(t, env)
+		_, err := failoverLimitsFromEnv()
+		assert.NotNil(t, err, "%v", env)
+		restore()
+	}
+
+	for _, env := range []map[string]string{
+		{"RACKSPACE_MK8S_AUTH_FAILOVER_BACKENDS": "next"},
+		{"RACKSPACE_MK8S_AUTH_FAILOVER_BACKENDS": "default,default"},
+	} {
+		restore := setEnv(t, env)
+		_, err := backendRouting(clientTimeouts{total: defaultTimeout}, nil, nil)
+		assert.NotNil(t, err, "%v", env)
+		restore()
+	}
+}
@@ -0,0 +1,99 @@
+//go:build rackspacefake
+// +build rackspacefake
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// fakeIdentity is the user a fake token is reviewed as
+type fakeIdentity struct {
+	Username string              `json:"username"`
+	UID      string              `json:"uid"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// fakeReviewer answers the TokenReviews of fixed tokens without contacting any backend, for local
+// development and the api-testing suites. It's only compiled with the rackspacefake build tag.
+type fakeReviewer struct {
+	identities map[string]fakeIdentity
+	hmacKey    []byte
+}
+
+// fakeTransport returns the transport of RACKSPACE_MK8S_AUTH_FAKE, or nil when it isn't set. The
+// identities are read from RACKSPACE_MK8S_AUTH_FAKE_IDENTITIES, a JSON object of token to
+// {"username", "uid", "groups", "extra"}.
+func fakeTransport() (transport, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_FAKE_IDENTITIES"
+
+	on, err := envBool("RACKSPACE_MK8S_AUTH_FAKE", false)
+	if err != nil || !on {
+		return nil, err
+	}
+
+	var identities map[string]fakeIdentity
+	if err := json.Unmarshal([]byte(os.Getenv(envVar)), &identities); err != nil {
+		return nil, fmt.Errorf("The env var %s is not a valid JSON object of token to identity: %v", envVar, err)
+	}
+	for token, id := range identities {
+		if token == "" || id.Username == "" || id.UID == "" {
+			return nil, fmt.Errorf("The env var %s is not valid, every identity needs a token, a username and a uid", envVar)
+		}
+	}
+
+	return &fakeReviewer{identities: identities, hmacKey: responseHMACKey()}, nil
+}
+
+func (f *fakeReviewer) send(ctx context.Context, m models.AuthModel, authRequestBody []byte) ([]byte, http.Header, error) {
+	var req AuthRequest
+	if err := json.Unmarshal(authRequestBody, &req); err != nil {
+		return nil, nil, err
+	}
+
+	resp := AuthResponse{APIVersion: req.APIVersion, Kind: req.Kind}
+	id, ok := f.identities[req.Spec.Token]
+	if !ok {
+		resp.Status.Error = "unknown fake token"
+		body, _ := json.Marshal(resp)
+		return nil, nil, &statusError{code: http.StatusUnauthorized, body: body}
+	}
+
+	resp.Status.Authenticated = true
+	resp.Status.Audiences = req.Spec.Audiences
+	resp.Status.User.Username = id.Username
+	resp.Status.User.UID = id.UID
+	resp.Status.User.Groups = id.Groups
+	resp.Status.User.Extra = id.Extra
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := http.Header{}
+	if f.hmacKey != nil {
+		header.Set(signatureHeader, signBody(f.hmacKey, body))
+	}
+	return body, header, nil
+}
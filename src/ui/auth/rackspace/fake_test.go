@@ -0,0 +1,84 @@
+//go:build rackspacefake
+// +build rackspacefake
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestFakeMode(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		// nothing listens there, the fake tokens never reach it
+		"RACKSPACE_MK8S_AUTH_URL":             "http://127.0.0.1:1",
+		"RACKSPACE_MK8S_AUTH_FAKE":            "1",
+		"RACKSPACE_MK8S_AUTH_FAKE_IDENTITIES": `{"dev-token":{"username":"alice","uid":"uid-alice","groups":["devs"]}}`,
+		"RACKSPACE_MK8S_AUTH_GROUP_SYNC":      "true",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Contains(t, configSummary(a), "fake=on")
+	a.resolver.Store = &fakeStore{}
+	groups := &fakeGroupStore{}
+	a.resolver.Groups = groups
+
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: "dev-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "uid-alice", userUID(user))
+	assert.Len(t, groups.groups, 1)
+	assert.Equal(t, "devs", groups.groups[0].GroupName)
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "bob", Password: "other-token"})
+	assert.Equal(t, conditionUnauthorized, errorCondition(err))
+}
+
+func TestFakeModeNamedBackends(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		// nothing listens there either, named backends are faked too
+		"RACKSPACE_MK8S_AUTH_URL":              "http://127.0.0.1:1",
+		"RACKSPACE_MK8S_AUTH_BACKENDS":         "next",
+		"RACKSPACE_MK8S_AUTH_BACKEND_NEXT_URL": "http://127.0.0.1:2",
+		"RACKSPACE_MK8S_AUTH_BACKEND_ROUTES":   "v2.=next",
+		"RACKSPACE_MK8S_AUTH_FAKE":             "1",
+		"RACKSPACE_MK8S_AUTH_FAKE_IDENTITIES":  `{"v2.dev-token":{"username":"alice","uid":"uid-alice"}}`,
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: "v2.dev-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+}
+
+func TestFakeModeInvalidIdentities(t *testing.T) {
+	for _, identities := range []string{"", "[]", `{"dev-token":{"username":"alice"}}`} {
+		restore := setEnv(t, map[string]string{
+			"RACKSPACE_MK8S_AUTH_FAKE":            "1",
+			"RACKSPACE_MK8S_AUTH_FAKE_IDENTITIES": identities,
+		})
+		_, err := fakeTransport()
+		assert.NotNil(t, err, identities)
+		restore()
+	}
+}
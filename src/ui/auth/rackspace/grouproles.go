@@ -0,0 +1,204 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/vmware/harbor/src/common"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// roleIDs are the Harbor roles a group can be granted, by lowercased role name
+var roleIDs = map[string]int{
+	"projectadmin": common.RoleProjectAdmin,
+	"developer":    common.RoleDeveloper,
+	"guest":        common.RoleGuest,
+}
+
+// groupRole is a role in a project granted to the members of a group
+type groupRole struct {
+	project string
+	role    int
+}
+
+// groupRoleMapping maps the backend's group names to the project roles their Harbor groups are
+// granted, e.g. "devs=library:developer,admins=library:projectAdmin". A group can be mapped to
+// roles in several projects.
+type groupRoleMapping map[string][]groupRole
+
+// groupRoles returns the configured group role mapping, or nil if none is configured.
+// Invalid entries fail the setup unless RACKSPACE_MK8S_AUTH_GROUP_ROLES_STRICT is false,
+// in which case they are logged and ignored.
+func groupRoles() (groupRoleMapping, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_GROUP_ROLES"
+
+	strict, err := envBool("RACKSPACE_MK8S_AUTH_GROUP_ROLES_STRICT", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGroupRoleMapping(os.Getenv(envVar), strict)
+}
+
+func parseGroupRoleMapping(s string, strict bool) (groupRoleMapping, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	grm := groupRoleMapping{}
+	for _, entry := range strings.Split(s, ",") {
+		group, gr, err := parseGroupRole(entry)
+		if err != nil {
+			if strict {
+				return nil, err
+			}
+			log.Errorf("Ignoring %v", err)
+			continue
+		}
+		grm[group] = append(grm[group], gr)
+	}
+
+	return grm, nil
+}
+
+// parseGroupRole parses an entry in the form "group=project:role"
+func parseGroupRole(entry string) (string, groupRole, error) {
+	kv := strings.SplitN(entry, "=", 2)
+	if len(kv) != 2 {
+		return "", groupRole{}, fmt.Errorf("invalid group role %q, expected group=project:role", entry)
+	}
+	pr := strings.SplitN(kv[1], ":", 2)
+	if len(pr) != 2 {
+		return "", groupRole{}, fmt.Errorf("invalid group role %q, expected group=project:role", entry)
+	}
+
+	group, project, roleName := strings.TrimSpace(kv[0]), strings.TrimSpace(pr[0]), strings.TrimSpace(pr[1])
+	if group == "" || project == "" {
+		return "", groupRole{}, fmt.Errorf("invalid group role %q, the group and project must not be empty", entry)
+	}
+	role, ok := roleIDs[strings.ToLower(roleName)]
+	if !ok {
+		return "", groupRole{}, fmt.Errorf("invalid group role %q, unknown role %q, expected projectAdmin, developer or guest", entry, roleName)
+	}
+
+	return group, groupRole{project: project, role: role}, nil
+}
+
+// projects returns the sorted names of the projects the mapping refers to
+func (grm groupRoleMapping) projects() []string {
+	seen := make(map[string]bool)
+	var projects []string
+	for _, roles := range grm {
+		for _, gr := range roles {
+			if !seen[gr.project] {
+				seen[gr.project] = true
+				projects = append(projects, gr.project)
+			}
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// normalized returns the mapping keyed by the group names as normalize returns them, merging the
+// roles of the names which normalize to the same one
+func (grm groupRoleMapping) normalized(normalize func(name string) string) groupRoleMapping {
+	if grm == nil {
+		return nil
+	}
+	groups := make([]string, 0, len(grm))
+	for group := range grm {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	n := groupRoleMapping{}
+	for _, group := range groups {
+		key := normalize(group)
+		n[key] = append(n[key], grm[group]...)
+	}
+	return n
+}
+
+// checkProjects returns the mapping without the roles in projects that don't exist,
+// or an error naming the missing projects when strict
+func (grm groupRoleMapping) checkProjects(exists func(name string) (bool, error), strict bool) (groupRoleMapping, error) {
+	missing := make(map[string]bool)
+	for _, project := range grm.projects() {
+		ok, err := exists(project)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			missing[project] = true
+		}
+	}
+	if len(missing) == 0 {
+		return grm, nil
+	}
+
+	names := make([]string, 0, len(missing))
+	for project := range missing {
+		names = append(names, project)
+	}
+	sort.Strings(names)
+	if strict {
+		return nil, fmt.Errorf("invalid group roles, the projects %s don't exist", strings.Join(names, ", "))
+	}
+	log.Errorf("Ignoring the group roles in the projects %s which don't exist", strings.Join(names, ", "))
+
+	checked := groupRoleMapping{}
+	for group, roles := range grm {
+		for _, gr := range roles {
+			if !missing[gr.project] {
+				checked[group] = append(checked[group], gr)
+			}
+		}
+	}
+	return checked, nil
+}
+
+// projectExists reports whether the project exists in Harbor's database
+func projectExists(name string) (bool, error) {
+	p, err := dao.GetProjectByName(name)
+	if err != nil {
+		return false, err
+	}
+	return p != nil, nil
+}
+
+// CheckGroupRoleProjects checks the projects of the group role mapping exist when
+// RACKSPACE_MK8S_AUTH_GROUP_ROLES_CHECK_PROJECTS is set. It must be called once the database is
+// initialized, which it isn't yet when the authenticator is set up.
+func CheckGroupRoleProjects() error {
+	check, err := envBool("RACKSPACE_MK8S_AUTH_GROUP_ROLES_CHECK_PROJECTS", false)
+	if err != nil || !check || registered == nil {
+		return err
+	}
+
+	strict, err := envBool("RACKSPACE_MK8S_AUTH_GROUP_ROLES_STRICT", true)
+	if err != nil {
+		return err
+	}
+
+	r := registered.resolver
+	r.groupRoles, err = r.groupRoles.checkProjects(projectExists, strict)
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common"
+)
+
+func TestParseGroupRoleMapping(t *testing.T) {
+	grm, err := parseGroupRoleMapping("", true)
+	assert.Nil(t, err)
+	assert.Nil(t, grm)
+
+	grm, err = parseGroupRoleMapping("devs=library:developer, devs=apps:guest,admins=library:projectAdmin", true)
+	assert.Nil(t, err)
+	assert.Equal(t, groupRoleMapping{
+		"devs":   {{project: "library", role: common.RoleDeveloper}, {project: "apps", role: common.RoleGuest}},
+		"admins": {{project: "library", role: common.RoleProjectAdmin}},
+	}, grm)
+}
+
+func TestParseGroupRoleMappingInvalid(t *testing.T) {
+	for _, invalid := range []string{
+		"devs=library:developr",
+		"devs=library:owner",
+		"devs=library",
+		"devs",
+		"=library:guest",
+		"devs=:guest",
+	} {
+		_, err := parseGroupRoleMapping(invalid, true)
+		assert.NotNil(t, err, invalid)
+	}
+
+	// the lenient mode drops the invalid entries only
+	grm, err := parseGroupRoleMapping("devs=library:developr,ops=library:guest", false)
+	assert.Nil(t, err)
+	assert.Equal(t, groupRoleMapping{"ops": {{project: "library", role: common.RoleGuest}}}, grm)
+}
+
+func TestGroupRolesFromEnv(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_GROUP_ROLES": "devs=library:developr"})()
+
+	// strict by default
+	_, err := setupAuth()
+	assert.NotNil(t, err)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_GROUP_ROLES_STRICT": "false"})()
+	_, err = setupAuth()
+	assert.Nil(t, err)
+}
+
+func TestGroupRoleMappingCheckProjects(t *testing.T) {
+	grm := groupRoleMapping{
+		"devs": {{project: "library", role: common.RoleDeveloper}, {project: "typo", role: common.RoleGuest}},
+		"ops":  {{project: "typo", role: common.RoleGuest}},
+	}
+	exists := func(name string) (bool, error) {
+		return name == "library", nil
+	}
+
+	_, err := grm.checkProjects(exists, true)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "typo")
+	}
+
+	checked, err := grm.checkProjects(exists, false)
+	assert.Nil(t, err)
+	assert.Equal(t, groupRoleMapping{"devs": {{project: "library", role: common.RoleDeveloper}}}, checked)
+}
@@ -0,0 +1,289 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/harbor/src/common"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/dao/group"
+	"github.com/vmware/harbor/src/common/dao/project"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// GroupStore is the subset of the dao used to persist group memberships.
+type GroupStore interface {
+	// OnBoardGroup creates g if it doesn't exist yet and sets its ID
+	OnBoardGroup(g *models.UserGroup) error
+	// GetGroup returns the group of kubernetes-auth with the identifier of groupIdentifier, or nil
+	// if there's none
+	GetGroup(identifier string) (*models.UserGroup, error)
+	GetGroupsOfUser(userID int) ([]*models.UserGroup, error)
+	// UpdateGroupMembers removes the user from the removed groups and adds it to the added ones
+	// atomically, leaving its memberships intact when it fails
+	UpdateGroupMembers(userID int, added, removed []int) error
+	// SetProjectRole makes the group a member of the project with the role, unless it's a member
+	// of the project already, so that the roles changed by admins in Harbor aren't overwritten
+	SetProjectRole(groupID int, project string, role int) error
+}
+
+// DAOGroupStore is the GroupStore backed by Harbor's database.
+type DAOGroupStore struct{}
+
+// OnBoardGroup ...
+func (DAOGroupStore) OnBoardGroup(g *models.UserGroup) error {
+	return group.OnBoardUserGroup(g, "LdapGroupDN", "GroupType")
+}
+
+// GetGroup ...
+func (DAOGroupStore) GetGroup(identifier string) (*models.UserGroup, error) {
+	groups, err := group.QueryUserGroup(models.UserGroup{GroupType: common.RackspaceGroupType, LdapGroupDN: identifier})
+	if err != nil || len(groups) == 0 {
+		return nil, err
+	}
+	return groups[0], nil
+}
+
+// GetGroupsOfUser ...
+func (DAOGroupStore) GetGroupsOfUser(userID int) ([]*models.UserGroup, error) {
+	return group.GetGroupsOfUser(userID)
+}
+
+// UpdateGroupMembers ...
+func (DAOGroupStore) UpdateGroupMembers(userID int, added, removed []int) error {
+	return group.UpdateGroupMembers(userID, added, removed)
+}
+
+// SetProjectRole ...
+func (DAOGroupStore) SetProjectRole(groupID int, projectName string, role int) error {
+	p, err := dao.GetProjectByName(projectName)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("project %s not found", projectName)
+	}
+
+	member := models.Member{
+		ProjectID:  p.ProjectID,
+		EntityID:   groupID,
+		EntityType: common.GroupMember,
+	}
+	existing, err := project.GetProjectMember(member)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	member.Role = role
+	_, err = project.AddProjectMember(member)
+	return err
+}
+
+// defaultMaxGroups is the default number of groups synced per user
+const defaultMaxGroups = 500
+
+// GroupLimitPolicy decides what happens when the backend returns more groups than the limit
+type GroupLimitPolicy string
+
+const (
+	// GroupLimitSkip leaves the user's group memberships unchanged
+	GroupLimitSkip GroupLimitPolicy = "skip"
+	// GroupLimitTruncate syncs the first groups in sorted order, up to the limit
+	GroupLimitTruncate GroupLimitPolicy = "truncate"
+)
+
+// groupLimit returns the maximum number of groups synced per user, 0 for no limit, and the
+// policy applied beyond it, skipping the sync by default
+func groupLimit() (int, GroupLimitPolicy, error) {
+	const policyEnvVar = "RACKSPACE_MK8S_AUTH_MAX_GROUPS_POLICY"
+
+	max, err := envInt("RACKSPACE_MK8S_AUTH_MAX_GROUPS", defaultMaxGroups)
+	if err != nil {
+		return 0, "", err
+	}
+	if max < 0 {
+		return 0, "", fmt.Errorf("The env var RACKSPACE_MK8S_AUTH_MAX_GROUPS is not a valid limit, expected 0 or more")
+	}
+
+	policy := GroupLimitPolicy(envOrDefault(policyEnvVar, string(GroupLimitSkip)))
+	if policy != GroupLimitSkip && policy != GroupLimitTruncate {
+		return 0, "", fmt.Errorf("The env var %s is not a valid policy, expected %q or %q", policyEnvVar, GroupLimitSkip, GroupLimitTruncate)
+	}
+	return max, policy, nil
+}
+
+// syncGroups makes the Harbor group memberships of user match the backend's groups of id
+// and publishes a notification when any membership was added or removed.
+// Groups created by other auth providers are left alone. Groups are handled in sorted order
+// so the database changes and the notification don't depend on the order of the backend's groups.
+// The diff is computed with maps and the membership changes are made in one batch each, so users
+// in hundreds of groups don't cost a database round trip per group.
+// Only the membership changes are made in a transaction. The missing groups are created, and
+// granted their roles, before it and are kept when it fails, the next sync of any of their members
+// reuses them.
+func (r *UserResolver) syncGroups(user *models.User, id Identity) error {
+	current, err := r.Groups.GetGroupsOfUser(user.UserID)
+	if err != nil {
+		log.Errorf("UID=%s BackendUsername=%s Error getting groups from database: %v", id.UID, id.Username, err)
+		return err
+	}
+
+	// the groups of kubernetes-auth are keyed by their name in lowercase like canonicalGroups dedupes
+	// them, as Harbor's database compares names case-insensitively
+	have := make(map[string]int)
+	haveNames := make(map[string]string)
+	for _, g := range current {
+		if g.GroupType == common.RackspaceGroupType {
+			name := groupName(g.LdapGroupDN)
+			key := strings.ToLower(name)
+			have[key] = g.ID
+			haveNames[key] = name
+		}
+	}
+
+	want := canonicalGroups(id.Groups)
+	if r.MaxGroups > 0 && len(want) > r.MaxGroups {
+		if r.GroupLimit != GroupLimitTruncate {
+			log.Warningf("UID=%s BackendUsername=%s is in %d groups, more than the limit of %d, skipping group sync", id.UID, id.Username, len(want), r.MaxGroups)
+			return nil
+		}
+		log.Warningf("UID=%s BackendUsername=%s is in %d groups, more than the limit of %d, syncing the first %d", id.UID, id.Username, len(want), r.MaxGroups, r.MaxGroups)
+		want = want[:r.MaxGroups]
+	}
+	wanted := make(map[string]bool, len(want))
+	var added, removed []string
+	var addedIDs, removedIDs []int
+	for _, name := range want {
+		key := strings.ToLower(name)
+		wanted[key] = true
+		if _, ok := have[key]; ok {
+			continue
+		}
+
+		g := &models.UserGroup{
+			GroupName:   name,
+			GroupType:   common.RackspaceGroupType,
+			LdapGroupDN: groupIdentifier(name),
+		}
+		if err := r.Groups.OnBoardGroup(g); err != nil {
+			log.Errorf("UID=%s BackendUsername=%s Error creating group %s: %v", id.UID, id.Username, name, err)
+			return err
+		}
+		for _, gr := range r.groupRoles[name] {
+			if err := r.Groups.SetProjectRole(g.ID, gr.project, gr.role); err != nil {
+				log.Errorf("UID=%s BackendUsername=%s Error granting group %s its role in project %s: %v", id.UID, id.Username, name, gr.project, err)
+				return err
+			}
+		}
+		added = append(added, name)
+		addedIDs = append(addedIDs, g.ID)
+	}
+
+	for _, key := range sortedKeys(have) {
+		if !wanted[key] {
+			removed = append(removed, haveNames[key])
+			removedIDs = append(removedIDs, have[key])
+		}
+	}
+
+	if len(addedIDs) > 0 || len(removedIDs) > 0 {
+		if err := r.Groups.UpdateGroupMembers(user.UserID, addedIDs, removedIDs); err != nil {
+			log.Errorf("UID=%s BackendUsername=%s Error updating group memberships, added=%v removed=%v: %v", id.UID, id.Username, added, removed, err)
+			return err
+		}
+	}
+
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	log.Debugf("UID=%s BackendUsername=%s group memberships changed, added=%v removed=%v", id.UID, id.Username, added, removed)
+
+	r.notify(notifier.GroupMembershipChangedTopic, notifier.GroupMembershipChangedNotification{
+		UserID:  user.UserID,
+		UID:     id.UID,
+		Added:   added,
+		Removed: removed,
+		Reason:  notifier.ReasonGroupChange,
+	})
+	return nil
+}
+
+// groupIdentifier returns the identifier Harbor stores, as the LDAP group DN, for the group of
+// kubernetes-auth with the name. It is the plain name: the groups onboarded so far have it, and
+// the group type already sets them apart from the groups of other auth providers. Groups are
+// only ever referenced through it and groupName, so SearchGroup and the membership sync agree.
+func groupIdentifier(name string) string {
+	return name
+}
+
+// groupName returns the name of the group of kubernetes-auth with the identifier, the inverse of
+// groupIdentifier
+func groupName(identifier string) string {
+	return identifier
+}
+
+// withExtraGroups returns the groups of id merged with the groups some backends put in its
+// Extra field under key instead, without duplicates. The groups are unchanged when key is empty.
+func withExtraGroups(id Identity, key string) []string {
+	if key == "" || len(id.Extra[key]) == 0 {
+		return id.Groups
+	}
+
+	seen := make(map[string]bool, len(id.Groups)+len(id.Extra[key]))
+	var groups []string
+	for _, name := range append(append([]string(nil), id.Groups...), id.Extra[key]...) {
+		if !seen[name] {
+			seen[name] = true
+			groups = append(groups, name)
+		}
+	}
+	return groups
+}
+
+// canonicalGroups returns the sorted, de-duplicated, non-empty group names. Harbor's database
+// compares group names case-insensitively, so names differing only in case are the same group
+// and only the first of them in sorted order is kept. With NormalizeCase the names are already
+// lowercased and this only drops the exact duplicates.
+func canonicalGroups(groups []string) []string {
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+
+	seen := make(map[string]bool, len(sorted))
+	var result []string
+	for _, name := range sorted {
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,575 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+// fakeGroupStore is an in-memory GroupStore
+type fakeGroupStore struct {
+	groups []models.UserGroup
+	// byDN indexes groups by LDAP group DN and type
+	byDN map[string]int
+	// members maps a user ID to the IDs of its groups
+	members map[int]map[int]bool
+	// ops records the membership changes in the order they were made
+	ops []string
+	// writeErr, when set, is returned by every write
+	writeErr error
+	// updateErr, when set, is returned by UpdateGroupMembers only
+	updateErr error
+	// roles maps "groupID project" to the role of the group in the project
+	roles map[string]int
+}
+
+func (fs *fakeGroupStore) OnBoardGroup(g *models.UserGroup) error {
+	if fs.writeErr != nil {
+		return fs.writeErr
+	}
+	key := fmt.Sprintf("%d/%s", g.GroupType, g.LdapGroupDN)
+	if i, ok := fs.byDN[key]; ok {
+		*g = fs.groups[i]
+		return nil
+	}
+	if fs.byDN == nil {
+		fs.byDN = make(map[string]int)
+	}
+	g.ID = len(fs.groups) + 1
+	fs.byDN[key] = len(fs.groups)
+	fs.groups = append(fs.groups, *g)
+	return nil
+}
+
+func (fs *fakeGroupStore) GetGroup(identifier string) (*models.UserGroup, error) {
+	if i, ok := fs.byDN[fmt.Sprintf("%d/%s", common.RackspaceGroupType, identifier)]; ok {
+		g := fs.groups[i]
+		return &g, nil
+	}
+	return nil, nil
+}
+
+func (fs *fakeGroupStore) GetGroupsOfUser(userID int) ([]*models.UserGroup, error) {
+	var groups []*models.UserGroup
+	for i := range fs.groups {
+		if fs.members[userID][fs.groups[i].ID] {
+			g := fs.groups[i]
+			groups = append(groups, &g)
+		}
+	}
+	return groups, nil
+}
+
+// UpdateGroupMembers removes then adds the memberships like the DAO's transaction, changing
+// nothing when it fails
+func (fs *fakeGroupStore) UpdateGroupMembers(userID int, added, removed []int) error {
+	if fs.writeErr != nil {
+		return fs.writeErr
+	}
+	if fs.updateErr != nil {
+		return fs.updateErr
+	}
+	if fs.members == nil {
+		fs.members = make(map[int]map[int]bool)
+	}
+	if fs.members[userID] == nil {
+		fs.members[userID] = make(map[int]bool)
+	}
+	if len(removed) > 0 {
+		for _, groupID := range removed {
+			delete(fs.members[userID], groupID)
+		}
+		fs.ops = append(fs.ops, fmt.Sprintf("delete %v", removed))
+	}
+	if len(added) > 0 {
+		for _, groupID := range added {
+			fs.members[userID][groupID] = true
+		}
+		fs.ops = append(fs.ops, fmt.Sprintf("add %v", added))
+	}
+	return nil
+}
+
+func (fs *fakeGroupStore) SetProjectRole(groupID int, project string, role int) error {
+	key := fmt.Sprintf("%d %s", groupID, project)
+	if _, ok := fs.roles[key]; ok {
+		return nil
+	}
+	if fs.roles == nil {
+		fs.roles = make(map[string]int)
+	}
+	fs.roles[key] = role
+	fs.ops = append(fs.ops, fmt.Sprintf("role %d %s %d", groupID, project, role))
+	return nil
+}
+
+// groupNotifications returns the group membership notifications captured by rec
+func groupNotifications(rec *recorder) []notifier.GroupMembershipChangedNotification {
+	var result []notifier.GroupMembershipChangedNotification
+	for _, n := range rec.notifications {
+		if n.topic == notifier.GroupMembershipChangedTopic {
+			result = append(result, n.value.(notifier.GroupMembershipChangedNotification))
+		}
+	}
+	return result
+}
+
+func TestResolveGroupMembershipChanged(t *testing.T) {
+	rec := &recorder{}
+	groups := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: groups, publish: rec.publish}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs", "admins"}})
+	assert.Nil(t, err)
+
+	// a login with the same groups is a no-op
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"admins", "devs"}})
+	assert.Nil(t, err)
+
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs", "ops", "qa"}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []notifier.GroupMembershipChangedNotification{
+		{
+			UserID: user.UserID,
+			UID:    "uid-alice",
+			Added:  []string{"admins", "devs"},
+			Reason: notifier.ReasonGroupChange,
+		},
+		{
+			UserID:  user.UserID,
+			UID:     "uid-alice",
+			Added:   []string{"ops", "qa"},
+			Removed: []string{"admins"},
+			Reason:  notifier.ReasonGroupChange,
+		},
+	}, groupNotifications(rec))
+
+	current, err := groups.GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	assert.Len(t, current, 3)
+}
+
+func TestResolveGroupMembershipNoop(t *testing.T) {
+	rec := &recorder{}
+	groups := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: groups, publish: rec.publish}
+
+	// no groups at all
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Empty(t, groupNotifications(rec))
+
+	// groups of other auth providers are not removed
+	ldap := &models.UserGroup{GroupName: "ldap-group", GroupType: common.LdapGroupType, LdapGroupDN: "cn=ldap-group"}
+	groups.OnBoardGroup(ldap)
+	groups.UpdateGroupMembers(user.UserID, []int{ldap.ID}, nil)
+
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Empty(t, groupNotifications(rec))
+}
+
+func TestResolveGroupSyncError(t *testing.T) {
+	store := &fakeStore{}
+	groups := &fakeGroupStore{writeErr: errors.New("db is down")}
+	r := &UserResolver{Store: store, Groups: groups}
+
+	// by default the login proceeds with the stale groups
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, "alice", user.Username)
+	}
+	assert.Empty(t, groups.ops)
+
+	r.StrictGroupSync = true
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.EqualError(t, err, "db is down")
+}
+
+func TestResolveGroupMembershipUpdateFailed(t *testing.T) {
+	rec := &recorder{}
+	groups := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: groups, publish: rec.publish, StrictGroupSync: true}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+
+	// the memberships are changed in one update, which leaves them intact when it fails
+	groups.updateErr = errors.New("duplicate key")
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"ops"}})
+	assert.EqualError(t, err, "duplicate key")
+	current, err := groups.GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	if assert.Len(t, current, 1) {
+		assert.Equal(t, "devs", current[0].GroupName)
+	}
+	assert.Len(t, groupNotifications(rec), 1)
+
+	// the group created before the update is kept, and reused once it succeeds
+	assert.Len(t, groups.groups, 2)
+	groups.updateErr = nil
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"ops"}})
+	assert.Nil(t, err)
+	assert.Len(t, groups.groups, 2)
+}
+
+func TestResolveGroupLimit(t *testing.T) {
+	var tooMany []string
+	for i := 0; i < 5; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("group-%d", i))
+	}
+
+	// skipped, the memberships are left unchanged
+	store := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: store, MaxGroups: 3}
+	_, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: tooMany})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"add [1]"}, store.ops)
+
+	// truncated to the first groups in sorted order
+	store = &fakeGroupStore{}
+	r = &UserResolver{Store: &fakeStore{}, Groups: store, MaxGroups: 3, GroupLimit: GroupLimitTruncate}
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: tooMany})
+	assert.Nil(t, err)
+	groups, _ := store.GetGroupsOfUser(user.UserID)
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.GroupName)
+	}
+	assert.Equal(t, []string{"group-0", "group-1", "group-2"}, names)
+}
+
+func TestGroupLimit(t *testing.T) {
+	max, policy, err := groupLimit()
+	assert.Nil(t, err)
+	assert.Equal(t, defaultMaxGroups, max)
+	assert.Equal(t, GroupLimitSkip, policy)
+
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_MAX_GROUPS":        "0",
+		"RACKSPACE_MK8S_AUTH_MAX_GROUPS_POLICY": "truncate",
+	})()
+	max, policy, err = groupLimit()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, max)
+	assert.Equal(t, GroupLimitTruncate, policy)
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_MAX_GROUPS_POLICY", "drop")
+	_, _, err = groupLimit()
+	assert.NotNil(t, err)
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_MAX_GROUPS", "-1")
+	_, _, err = groupLimit()
+	assert.NotNil(t, err)
+}
+
+func TestResolveGroupMembershipOrder(t *testing.T) {
+	// whatever the order of the backend's groups, the same changes are made and notified in the same order
+	for _, groups := range [][]string{
+		{"qa", "ops", "devs", "ops"},
+		{"devs", "ops", "qa"},
+		{"ops", "", "qa", "devs"},
+	} {
+		rec := &recorder{}
+		store := &fakeGroupStore{}
+		r := &UserResolver{Store: &fakeStore{}, Groups: store, publish: rec.publish}
+
+		_, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"zeta", "alpha", "beta"}})
+		assert.Nil(t, err)
+		_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: groups})
+		assert.Nil(t, err)
+
+		// alpha=1, beta=2, zeta=3, then devs=4, ops=5, qa=6
+		assert.Equal(t, []string{"add [1 2 3]", "delete [1 2 3]", "add [4 5 6]"}, store.ops, "%v", groups)
+
+		notifications := groupNotifications(rec)
+		if assert.Len(t, notifications, 2) {
+			assert.Equal(t, []string{"alpha", "beta", "zeta"}, notifications[0].Added)
+			assert.Equal(t, []string{"devs", "ops", "qa"}, notifications[1].Added)
+			assert.Equal(t, []string{"alpha", "beta", "zeta"}, notifications[1].Removed)
+		}
+	}
+}
+
+func TestResolveGroupRoles(t *testing.T) {
+	store := &fakeGroupStore{}
+	r := &UserResolver{
+		Store:  &fakeStore{},
+		Groups: store,
+		groupRoles: groupRoleMapping{
+			"devs": {{project: "library", role: common.RoleDeveloper}, {project: "apps", role: common.RoleGuest}},
+		},
+	}
+
+	_, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs", "ops"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		fmt.Sprintf("role 1 library %d", common.RoleDeveloper),
+		fmt.Sprintf("role 1 apps %d", common.RoleGuest),
+		"add [1 2]",
+	}, store.ops)
+
+	// the role changed by an admin isn't overwritten when another user joins the group
+	store.roles["1 library"] = common.RoleProjectAdmin
+	_, err = r.Resolve(Identity{Username: "bob", UID: "uid-bob", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+	assert.Equal(t, common.RoleProjectAdmin, store.roles["1 library"])
+	assert.Len(t, store.ops, 4)
+}
+
+func TestResolveGroupRolesNormalizeCase(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_GROUP_SYNC":     "true",
+		"RACKSPACE_MK8S_AUTH_NORMALIZE_CASE": "true",
+		"RACKSPACE_MK8S_AUTH_GROUP_ROLES":    "Devs=library:developer,DEVS=apps:guest,Ops=library:guest",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	store := &fakeGroupStore{}
+	a.resolver.Store = &fakeStore{}
+	a.resolver.Groups = store
+
+	// the mapping applies to the lowercased group names of the backend
+	_, err = a.resolver.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"DevS"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		fmt.Sprintf("role 1 apps %d", common.RoleGuest),
+		fmt.Sprintf("role 1 library %d", common.RoleDeveloper),
+		"add [1]",
+	}, store.ops)
+
+	// and the precreated groups are the ones the backend's users join
+	store.ops = nil
+	assert.Nil(t, a.resolver.precreateGroups([]string{"DEVS", "Ops"}))
+	assert.Equal(t, []string{fmt.Sprintf("role 2 library %d", common.RoleGuest)}, store.ops)
+	ops, err := store.GetGroup(groupIdentifier("ops"))
+	assert.Nil(t, err)
+	if assert.NotNil(t, ops) {
+		assert.Equal(t, "ops", ops.GroupName)
+	}
+}
+
+func TestSyncGroupsBatched(t *testing.T) {
+	// the memberships of a user in many groups are changed in one batch each
+	var before, after []string
+	for i := 0; i < 1000; i++ {
+		before = append(before, fmt.Sprintf("group-%04d", i))
+		after = append(after, fmt.Sprintf("group-%04d", i+500))
+	}
+	store := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: store}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: before})
+	assert.Nil(t, err)
+	assert.Len(t, store.ops, 1)
+
+	store.ops = nil
+	assert.Nil(t, r.syncGroups(user, Identity{Username: "alice", UID: "uid-alice", Groups: after}))
+	assert.Len(t, store.ops, 2)
+
+	groups, err := store.GetGroupsOfUser(user.UserID)
+	assert.Nil(t, err)
+	if assert.Len(t, groups, 1000) {
+		assert.Equal(t, "group-0500", groups[0].GroupName)
+		assert.Equal(t, "group-1499", groups[999].GroupName)
+	}
+}
+
+// benchmarkSyncGroups measures replacing half of the n groups of a user, which should grow
+// linearly with n
+func benchmarkSyncGroups(b *testing.B, n int) {
+	before := make([]string, n)
+	after := make([]string, n)
+	for i := 0; i < n; i++ {
+		before[i] = fmt.Sprintf("group-%05d", i)
+		after[i] = fmt.Sprintf("group-%05d", i+n/2)
+	}
+	store := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: store}
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		groups := before
+		if i%2 == 1 {
+			groups = after
+		}
+		if err := r.syncGroups(user, Identity{Username: "alice", UID: "uid-alice", Groups: groups}); err != nil {
+			b.Fatal(err)
+		}
+		store.ops = nil
+	}
+}
+
+func BenchmarkSyncGroups100(b *testing.B)  { benchmarkSyncGroups(b, 100) }
+func BenchmarkSyncGroups1000(b *testing.B) { benchmarkSyncGroups(b, 1000) }
+
+func TestWithExtraGroups(t *testing.T) {
+	for _, c := range []struct {
+		id       Identity
+		expected []string
+	}{
+		// groups in Groups
+		{Identity{Groups: []string{"devs", "ops"}}, []string{"devs", "ops"}},
+		// groups in Extra
+		{Identity{Extra: map[string][]string{"groups": {"devs", "ops"}}}, []string{"devs", "ops"}},
+		// both, merged without duplicates
+		{Identity{Groups: []string{"devs", "ops"}, Extra: map[string][]string{"groups": {"ops", "qa"}}}, []string{"devs", "ops", "qa"}},
+		// neither
+		{Identity{Extra: map[string][]string{"scopes": {"read"}}}, nil},
+	} {
+		assert.Equal(t, c.expected, withExtraGroups(c.id, "groups"), "%+v", c.id)
+	}
+
+	// Extra is ignored unless a key is configured
+	assert.Nil(t, withExtraGroups(Identity{Extra: map[string][]string{"groups": {"devs"}}}, ""))
+}
+
+func TestAuthenticateExtraGroups(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":              fb.URL,
+		"RACKSPACE_MK8S_AUTH_GROUP_SYNC":       "true",
+		"RACKSPACE_MK8S_AUTH_EXTRA_GROUPS_KEY": "teams",
+	})()
+	fb.response.Status.User.Extra = map[string][]string{"teams": {"devs"}}
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	rec := &recorder{}
+	a.resolver.Store = &fakeStore{}
+	a.resolver.Groups = &fakeGroupStore{}
+	a.resolver.publish = rec.publish
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	notifications := groupNotifications(rec)
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, []string{"devs"}, notifications[0].Added)
+	}
+}
+
+func TestResolveDuplicateGroups(t *testing.T) {
+	for _, normalize := range []bool{false, true} {
+		rec := &recorder{}
+		groups := &fakeGroupStore{}
+		r := &UserResolver{Store: &fakeStore{}, Groups: groups, NormalizeCase: normalize, publish: rec.publish}
+
+		user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"a", "a", "A"}})
+		assert.Nil(t, err)
+
+		current, err := groups.GetGroupsOfUser(user.UserID)
+		assert.Nil(t, err)
+		assert.Len(t, current, 1, "normalize=%t", normalize)
+		assert.Len(t, groups.groups, 1, "normalize=%t", normalize)
+		if notifications := groupNotifications(rec); assert.Len(t, notifications, 1) {
+			assert.Len(t, notifications[0].Added, 1)
+		}
+
+		// the same groups in another order are a no-op
+		_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"A", "a"}})
+		assert.Nil(t, err)
+		assert.Len(t, groupNotifications(rec), 1, "normalize=%t", normalize)
+	}
+}
+
+func TestCanonicalGroups(t *testing.T) {
+	assert.Equal(t, []string{"A", "B"}, canonicalGroups([]string{"b", "a", "", "A", "B", "a"}))
+	assert.Nil(t, canonicalGroups(nil))
+}
+
+func TestGroupIdentifierRoundTrip(t *testing.T) {
+	for _, name := range []string{"devs", "Devs", "cn=devs,ou=groups", "team/a b", "mk8s:ops", "émoji-✓"} {
+		id := groupIdentifier(name)
+		assert.Equal(t, name, groupName(id))
+		assert.Equal(t, id, groupIdentifier(groupName(id)))
+	}
+}
+
+func TestSearchGroupFindsOnboardedGroups(t *testing.T) {
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	groups := &fakeGroupStore{}
+	a.resolver.Store = &fakeStore{}
+	a.resolver.Groups = groups
+
+	_, err = a.resolver.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+
+	g, err := a.SearchGroup(groupIdentifier("devs"))
+	assert.Nil(t, err)
+	if assert.NotNil(t, g) {
+		assert.Equal(t, "devs", g.GroupName)
+		assert.Equal(t, common.RackspaceGroupType, g.GroupType)
+	}
+
+	g, err = a.SearchGroup(groupIdentifier("ops"))
+	assert.Nil(t, err)
+	assert.Nil(t, g)
+}
+
+func TestResolveGroupRenamedInHarbor(t *testing.T) {
+	rec := &recorder{}
+	groups := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: groups, publish: rec.publish}
+
+	_, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+
+	// the memberships are reconciled by identifier, a group renamed by an admin is still the same
+	groups.groups[0].GroupName = "Developers"
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+	assert.Len(t, groupNotifications(rec), 1)
+}
+
+func TestResolveGroupCaseChanged(t *testing.T) {
+	rec := &recorder{}
+	groups := &fakeGroupStore{}
+	r := &UserResolver{Store: &fakeStore{}, Groups: groups, publish: rec.publish}
+
+	_, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"Devs"}})
+	assert.Nil(t, err)
+
+	// the database compares names case-insensitively, the membership is kept
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice", Groups: []string{"devs"}})
+	assert.Nil(t, err)
+	assert.Len(t, groupNotifications(rec), 1)
+	assert.Equal(t, []string{"add [1]"}, groups.ops)
+
+	// and removed under its stored name
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	if notifications := groupNotifications(rec); assert.Len(t, notifications, 2) {
+		assert.Equal(t, []string{"Devs"}, notifications[1].Removed)
+	}
+}
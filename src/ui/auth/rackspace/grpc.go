@@ -0,0 +1,406 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"golang.org/x/net/http2"
+)
+
+// defaultGRPCMethod is the Review method of the TokenReviewService of tokenreview.proto
+const defaultGRPCMethod = "/rackspace.mk8s.auth.v1.TokenReviewService/Review"
+
+// The field numbers of the messages of tokenreview.proto, which are those of
+// k8s.io/api/authentication/v1
+const (
+	fieldReviewSpec   = 2
+	fieldReviewStatus = 3
+
+	fieldSpecToken     = 1
+	fieldSpecAudiences = 2
+
+	fieldStatusAuthenticated = 1
+	fieldStatusUser          = 2
+	fieldStatusError         = 3
+	fieldStatusAudiences     = 4
+
+	fieldUserUsername = 1
+	fieldUserUID      = 2
+	fieldUserGroups   = 3
+	fieldUserExtra    = 4
+
+	// a map field is a repeated entry message of its key and value
+	fieldMapKey   = 1
+	fieldMapValue = 2
+
+	fieldExtraItems = 1
+)
+
+// gRPC status codes the backend's errors are mapped from
+const (
+	grpcOK                = 0
+	grpcDeadlineExceeded  = 4
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// grpcTransport calls the gRPC TokenReviewService of tokenreview.proto, whose TokenReviews are
+// wire compatible with the protobuf messages of k8s.io/api/authentication/v1. The gRPC framing is
+// done directly over HTTP/2, which is h2c for http URLs. The responses are converted to JSON
+// TokenReviews so the rest of the review is shared with the HTTP protocol, and gRPC errors are
+// converted to the equivalent HTTP status.
+type grpcTransport struct {
+	client  *http.Client
+	url     string
+	headers http.Header
+}
+
+func newGRPCTransport(authURL, caPath string, timeouts clientTimeouts, headers http.Header) (*grpcTransport, error) {
+	if responseHMACKey() != nil {
+		return nil, errors.New("RACKSPACE_MK8S_AUTH_RESPONSE_HMAC_KEY is only supported with the http protocol")
+	}
+
+	method := envOrDefault("RACKSPACE_MK8S_AUTH_GRPC_METHOD", defaultGRPCMethod)
+	if !strings.HasPrefix(method, "/") {
+		return nil, fmt.Errorf("The env var RACKSPACE_MK8S_AUTH_GRPC_METHOD is not a valid method, expected /package.Service/Method")
+	}
+
+	client, err := getClient(authURL, caPath, timeouts)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(authURL, "https") {
+		client.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+	} else {
+		dialer := &net.Dialer{Timeout: timeouts.connect}
+		var h2c http.RoundTripper = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			},
+		}
+		if timeouts.responseHeader > 0 {
+			h2c = &responseHeaderTimeout{transport: h2c, timeout: timeouts.responseHeader}
+		}
+		client.Transport = h2c
+	}
+
+	return &grpcTransport{client: client, url: authURL + method, headers: headers}, nil
+}
+
+func (t *grpcTransport) send(ctx context.Context, m models.AuthModel, authRequestBody []byte) ([]byte, http.Header, error) {
+	authRequest := AuthRequest{}
+	if err := json.Unmarshal(authRequestBody, &authRequest); err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(grpcFrame(encodeTokenReview(authRequest))))
+	if err != nil {
+		return nil, nil, err
+	}
+	requestHeaders(req, m, t.headers)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &statusError{code: resp.StatusCode, body: body}
+	}
+
+	// the status is in the trailers, or in the headers of a response without a message
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != fmt.Sprint(grpcOK) {
+		return nil, nil, &statusError{code: grpcHTTPStatus(status), body: []byte(fmt.Sprintf("grpc-status=%s grpc-message=%s", status, message))}
+	}
+
+	msg, err := grpcMessage(body)
+	if err != nil {
+		return nil, nil, newBackendProtocolError(resp.Header.Get("Content-Type"), body, err)
+	}
+	authResp, err := decodeTokenReview(msg)
+	if err != nil {
+		return nil, nil, newBackendProtocolError(resp.Header.Get("Content-Type"), body, err)
+	}
+	// protobuf TokenReviews carry no type metadata, they are always of the requested version
+	authResp.APIVersion, authResp.Kind = authRequest.APIVersion, authRequest.Kind
+
+	authRespBody, err := json.Marshal(authResp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return authRespBody, resp.Header, nil
+}
+
+// grpcHTTPStatus maps a gRPC status code to the HTTP status the backend would answer with
+func grpcHTTPStatus(status string) int {
+	switch status {
+	case fmt.Sprint(grpcUnauthenticated):
+		return http.StatusUnauthorized
+	case fmt.Sprint(grpcPermissionDenied):
+		return http.StatusForbidden
+	case fmt.Sprint(grpcResourceExhausted):
+		return http.StatusTooManyRequests
+	case fmt.Sprint(grpcUnavailable):
+		return http.StatusServiceUnavailable
+	case fmt.Sprint(grpcDeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// grpcFrame prefixes an uncompressed message with its length
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// grpcMessage returns the single message of a unary response body
+func grpcMessage(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, errors.New("grpc response without a message")
+	}
+	if body[0] != 0 {
+		return nil, errors.New("compressed grpc responses are not supported")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < n {
+		return nil, errors.New("truncated grpc response")
+	}
+	return body[5 : 5+n], nil
+}
+
+// protobuf wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func appendBytesField(b []byte, field int, value []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|wireBytes))
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// encodeTokenReview encodes the TokenReview{spec: TokenReviewSpec{token, audiences}} of r
+func encodeTokenReview(r AuthRequest) []byte {
+	spec := appendBytesField(nil, fieldSpecToken, []byte(r.Spec.Token))
+	for _, aud := range r.Spec.Audiences {
+		spec = appendBytesField(spec, fieldSpecAudiences, []byte(aud))
+	}
+	return appendBytesField(nil, fieldReviewSpec, spec)
+}
+
+// protoField is a decoded protobuf field, value is set for varints and data for length-delimited fields
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+// decodeFields splits a protobuf message into its fields, skipping fixed-size ones
+func decodeFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf field key")
+		}
+		b = b[n:]
+
+		f := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("invalid protobuf varint")
+			}
+			b = b[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errors.New("invalid protobuf length")
+			}
+			f.data, b = b[n:n+int(size)], b[n+int(size):]
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return nil, errors.New("invalid protobuf fixed64")
+			}
+			b = b[8:]
+			continue
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return nil, errors.New("invalid protobuf fixed32")
+			}
+			b = b[4:]
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// decodeTokenReview decodes the status of a TokenReview
+func decodeTokenReview(msg []byte) (*AuthResponse, error) {
+	resp := &AuthResponse{}
+	review, err := decodeFields(msg)
+	if err != nil {
+		return nil, err
+	}
+	for _, rf := range review {
+		if rf.number != fieldReviewStatus {
+			continue
+		}
+		status, err := decodeFields(rf.data)
+		if err != nil {
+			return nil, err
+		}
+		for _, sf := range status {
+			switch sf.number {
+			case fieldStatusAuthenticated:
+				resp.Status.Authenticated = sf.value != 0
+			case fieldStatusUser:
+				if err := decodeUserInfo(sf.data, resp); err != nil {
+					return nil, err
+				}
+			case fieldStatusError:
+				resp.Status.Error = string(sf.data)
+			case fieldStatusAudiences:
+				resp.Status.Audiences = append(resp.Status.Audiences, string(sf.data))
+			}
+		}
+	}
+	return resp, nil
+}
+
+func decodeUserInfo(msg []byte, resp *AuthResponse) error {
+	user := &resp.Status.User
+	fields, err := decodeFields(msg)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		switch f.number {
+		case fieldUserUsername:
+			user.Username = string(f.data)
+		case fieldUserUID:
+			user.UID = string(f.data)
+		case fieldUserGroups:
+			user.Groups = append(user.Groups, string(f.data))
+		case fieldUserExtra:
+			entry, err := decodeFields(f.data)
+			if err != nil {
+				return err
+			}
+			key, items := "", []string(nil)
+			for _, ef := range entry {
+				switch ef.number {
+				case fieldMapKey:
+					key = string(ef.data)
+				case fieldMapValue:
+					values, err := decodeFields(ef.data)
+					if err != nil {
+						return err
+					}
+					for _, v := range values {
+						if v.number == fieldExtraItems {
+							items = append(items, string(v.data))
+						}
+					}
+				}
+			}
+			if user.Extra == nil {
+				user.Extra = make(map[string][]string)
+			}
+			user.Extra[key] = append(user.Extra[key], items...)
+		}
+	}
+	return nil
+}
+
+// responseHeaderTimeout bounds the wait for the response headers of the transport, like the
+// ResponseHeaderTimeout of an http.Transport, which the h2c transport doesn't have
+type responseHeaderTimeout struct {
+	transport http.RoundTripper
+	timeout   time.Duration
+}
+
+func (t *responseHeaderTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+	resp, err := t.transport.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, errResponseHeaderTimeout{}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the context of a response once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// errResponseHeaderTimeout is the net.Error timeout of the headers, as the http.Transport's
+type errResponseHeaderTimeout struct{}
+
+func (errResponseHeaderTimeout) Error() string   { return "timeout awaiting response headers" }
+func (errResponseHeaderTimeout) Timeout() bool   { return true }
+func (errResponseHeaderTimeout) Temporary() bool { return true }
@@ -0,0 +1,301 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+	"golang.org/x/net/http2"
+)
+
+// fakeGRPCBackend is a gRPC TokenReview service served over h2c. It authenticates the token
+// "token" as alice and rejects any other as unauthenticated.
+type fakeGRPCBackend struct {
+	net.Listener
+	URL        string
+	requests   int
+	lastMethod string
+	lastHeader http.Header
+	// response, when set, is the framed response of any token
+	response []byte
+	// delay, when set, is waited before answering
+	delay time.Duration
+}
+
+func newFakeGRPCBackend(t *testing.T) *fakeGRPCBackend {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb := &fakeGRPCBackend{Listener: l, URL: "http://" + l.Addr().String()}
+
+	server := &http2.Server{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fb.requests++
+		fb.lastMethod = r.URL.Path
+		fb.lastHeader = r.Header
+		body, _ := ioutil.ReadAll(r.Body)
+		time.Sleep(fb.delay)
+
+		token := ""
+		if msg, err := grpcMessage(body); err == nil {
+			review, _ := decodeFields(msg)
+			for _, f := range review {
+				if f.number == fieldReviewSpec {
+					spec, _ := decodeFields(f.data)
+					for _, sf := range spec {
+						if sf.number == fieldSpecToken {
+							token = string(sf.data)
+						}
+					}
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		if fb.response != nil {
+			w.Write(fb.response)
+			w.Header().Set("Grpc-Status", "0")
+			return
+		}
+		if token != "token" {
+			w.Header().Set("Grpc-Status", "16")
+			w.Header().Set("Grpc-Message", "invalid token")
+			return
+		}
+
+		w.Write(grpcFrame(encodeTestReviewStatus()))
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+	return fb
+}
+
+// encodeTestReviewStatus encodes an authenticated TokenReview of alice in the groups devs and ops
+func encodeTestReviewStatus() []byte {
+	extraValue := appendBytesField(nil, 1, []byte("read"))
+	extra := appendBytesField(appendBytesField(nil, 1, []byte("scopes")), 2, extraValue)
+
+	user := appendBytesField(nil, 1, []byte("alice"))
+	user = appendBytesField(user, 2, []byte("uid-alice"))
+	user = appendBytesField(user, 3, []byte("devs"))
+	user = appendBytesField(user, 3, []byte("ops"))
+	user = appendBytesField(user, 4, extra)
+
+	status := binary.AppendUvarint(nil, 1<<3|wireVarint)
+	status = binary.AppendUvarint(status, 1)
+	status = appendBytesField(status, 2, user)
+
+	return appendBytesField(nil, 3, status)
+}
+
+func TestDecodeTokenReview(t *testing.T) {
+	resp, err := decodeTokenReview(encodeTestReviewStatus())
+	assert.Nil(t, err)
+	assert.True(t, resp.Status.Authenticated)
+	assert.Equal(t, Identity{
+		Username: "alice",
+		UID:      "uid-alice",
+		Groups:   []string{"devs", "ops"},
+		Extra:    map[string][]string{"scopes": {"read"}},
+	}, resp.identity())
+
+	_, err = decodeTokenReview([]byte{0x1a, 0x05, 0x01})
+	assert.NotNil(t, err)
+}
+
+// TestTokenReviewProto checks the codec against the contract of tokenreview.proto
+func TestTokenReviewProto(t *testing.T) {
+	proto, err := ioutil.ReadFile("tokenreview.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := regexp.MustCompile(`(?m)^package ([\w.]+);`).FindSubmatch(proto)
+	service := regexp.MustCompile(`(?m)^service (\w+) \{\s+(?://.*\s+)*rpc (\w+)\(`).FindSubmatch(proto)
+	if assert.NotNil(t, pkg) && assert.NotNil(t, service) {
+		assert.Equal(t, fmt.Sprintf("/%s.%s/%s", pkg[1], service[1], service[2]), defaultGRPCMethod)
+	}
+
+	numbers := make(map[string]int)
+	for _, message := range regexp.MustCompile(`(?m)^message (\w+) \{([^}]*)\}`).FindAllSubmatch(proto, -1) {
+		for _, field := range regexp.MustCompile(`(\w+) = (\d+);`).FindAllSubmatch(message[2], -1) {
+			var n int
+			fmt.Sscan(string(field[2]), &n)
+			numbers[string(message[1])+"."+string(field[1])] = n
+		}
+	}
+	assert.Equal(t, map[string]int{
+		"TokenReview.spec":                fieldReviewSpec,
+		"TokenReview.status":              fieldReviewStatus,
+		"TokenReviewSpec.token":           fieldSpecToken,
+		"TokenReviewSpec.audiences":       fieldSpecAudiences,
+		"TokenReviewStatus.authenticated": fieldStatusAuthenticated,
+		"TokenReviewStatus.user":          fieldStatusUser,
+		"TokenReviewStatus.error":         fieldStatusError,
+		"TokenReviewStatus.audiences":     fieldStatusAudiences,
+		"UserInfo.username":               fieldUserUsername,
+		"UserInfo.uid":                    fieldUserUID,
+		"UserInfo.groups":                 fieldUserGroups,
+		"UserInfo.extra":                  fieldUserExtra,
+		"ExtraValue.items":                fieldExtraItems,
+	}, numbers)
+
+	// TokenReview{spec: {token: "t", audiences: ["a"]}} as protoc encodes it
+	r := AuthRequest{}
+	r.Spec.Token = "t"
+	r.Spec.Audiences = []string{"a"}
+	assert.Equal(t, []byte{0x12, 0x06, 0x0a, 0x01, 't', 0x12, 0x01, 'a'}, encodeTokenReview(r))
+}
+
+func TestGRPCAudiences(t *testing.T) {
+	r := AuthRequest{}
+	r.Spec.Token = "token"
+	r.Spec.Audiences = []string{"harbor", "registry"}
+	review, err := decodeFields(encodeTokenReview(r))
+	assert.Nil(t, err)
+	spec, err := decodeFields(review[0].data)
+	assert.Nil(t, err)
+	var audiences []string
+	for _, f := range spec {
+		if f.number == 2 {
+			audiences = append(audiences, string(f.data))
+		}
+	}
+	assert.Equal(t, r.Spec.Audiences, audiences)
+
+	status := appendBytesField(nil, 4, []byte("harbor"))
+	resp, err := decodeTokenReview(appendBytesField(nil, 3, status))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"harbor"}, resp.identity().Audiences)
+}
+
+func TestAuthenticateGRPC(t *testing.T) {
+	fb := newFakeGRPCBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":           fb.URL,
+		"RACKSPACE_MK8S_AUTH_PROTOCOL":      "grpc",
+		"RACKSPACE_MK8S_AUTH_EXTRA_HEADERS": "X-Tenant:acme",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, "uid-alice", user.ExternalID)
+	}
+	assert.Equal(t, defaultGRPCMethod, fb.lastMethod)
+	assert.Equal(t, "application/grpc", fb.lastHeader.Get("Content-Type"))
+	assert.Equal(t, "acme", fb.lastHeader.Get("X-Tenant"))
+
+	// gRPC errors are reported like the equivalent HTTP status
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "expired"})
+	if assert.IsType(t, &statusError{}, err) {
+		assert.Equal(t, http.StatusUnauthorized, err.(*statusError).code)
+		assert.Contains(t, err.Error(), "invalid token")
+	}
+	assert.Equal(t, 2, fb.requests)
+}
+
+func TestBackendTransportProtocol(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_PROTOCOL": "soap"})()
+	_, err := setupAuth()
+	assert.NotNil(t, err)
+
+	// responses can't be signed over gRPC
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_PROTOCOL":          "grpc",
+		"RACKSPACE_MK8S_AUTH_RESPONSE_HMAC_KEY": "secret",
+	})()
+	_, err = setupAuth()
+	assert.NotNil(t, err)
+}
+
+func TestGRPCInvalidResponse(t *testing.T) {
+	fb := newFakeGRPCBackend(t)
+	defer fb.Close()
+	fb.response = grpcFrame([]byte{0x1a, 0x05, 0x01})
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":      fb.URL,
+		"RACKSPACE_MK8S_AUTH_PROTOCOL": "grpc",
+		"RACKSPACE_MK8S_AUTH_RETRIES":  "2",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	// a malformed message is a protocol error, which isn't retried
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	var protocolErr *BackendProtocolError
+	if assert.True(t, errors.As(err, &protocolErr), "%v", err) {
+		assert.Equal(t, "application/grpc", protocolErr.ContentType)
+	}
+	assert.Equal(t, 1, fb.requests)
+
+	fb.response = []byte{0, 0, 0, 0, 9, 0x0a}
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.True(t, errors.As(err, &protocolErr), "%v", err)
+}
+
+func TestGRPCResponseHeaderTimeout(t *testing.T) {
+	fb := newFakeGRPCBackend(t)
+	defer fb.Close()
+	fb.delay = 300 * time.Millisecond
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                     fb.URL,
+		"RACKSPACE_MK8S_AUTH_PROTOCOL":                "grpc",
+		"RACKSPACE_MK8S_AUTH_TIMEOUT":                 "5s",
+		"RACKSPACE_MK8S_AUTH_RESPONSE_HEADER_TIMEOUT": "50ms",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	start := time.Now()
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.True(t, errors.Is(err, ErrBackendUnavailable), "%v", err)
+	assert.True(t, time.Since(start) < fb.delay, "waited %v", time.Since(start))
+
+	// a backend answering in time isn't affected
+	fb.delay = 0
+	resp, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.Status.User.Username)
+}
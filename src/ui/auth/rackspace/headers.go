@@ -0,0 +1,147 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// headers that the extra headers can't override because the request depends on them
+var reservedHeaders = map[string]bool{
+	"Content-Type":      true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+}
+
+// extraHeaders returns the headers attached to every backend request, e.g. the API key of a
+// gateway in front of kubernetes-auth, or nil if none are configured
+func extraHeaders() (http.Header, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_EXTRA_HEADERS"
+
+	return parseExtraHeaders(os.Getenv(envVar))
+}
+
+// parseExtraHeaders parses headers in the form "name1:value1,name2:value2"
+func parseExtraHeaders(s string) (http.Header, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	h := http.Header{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid extra header %q, expected name:value", pair)
+		}
+
+		name, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("invalid extra header %q, %q is not a valid header name", pair, name)
+		}
+		name = http.CanonicalHeaderKey(name)
+		if reservedHeaders[name] {
+			return nil, fmt.Errorf("invalid extra header %q, %s can't be overridden", pair, name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid extra header %q, the value contains a line break", pair)
+		}
+
+		h.Add(name, value)
+	}
+
+	return h, nil
+}
+
+// validHeaderName reports whether name is a non-empty RFC 7230 token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// sensitiveHeaders are the response headers always redacted from the logs
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Www-Authenticate",
+	"Proxy-Authenticate",
+	"X-Auth-Token",
+	"X-Subject-Token",
+}
+
+// headerRedactor holds the canonical names of the response headers whose values are redacted
+// when a failed response is logged
+type headerRedactor map[string]bool
+
+// redactedHeaders returns the sensitive headers plus the ones of RACKSPACE_MK8S_AUTH_REDACTED_HEADERS,
+// a comma separated list of header names
+func redactedHeaders() (headerRedactor, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_REDACTED_HEADERS"
+
+	hr := headerRedactor{}
+	for _, name := range sensitiveHeaders {
+		hr[name] = true
+	}
+
+	for _, name := range strings.Split(os.Getenv(envVar), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("The env var %s is not a valid header list, %q is not a valid header name", envVar, name)
+		}
+		hr[http.CanonicalHeaderKey(name)] = true
+	}
+
+	return hr, nil
+}
+
+// format returns the headers of h sorted by name as name="value" pairs, with the values of the
+// redacted headers replaced
+func (hr headerRedactor) format(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		if hr[http.CanonicalHeaderKey(name)] {
+			value = "[REDACTED]"
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,91 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestParseExtraHeaders(t *testing.T) {
+	h, err := parseExtraHeaders("")
+	assert.Nil(t, err)
+	assert.Nil(t, h)
+
+	h, err = parseExtraHeaders("x-api-key: secret:1, X-Tenant:acme")
+	assert.Nil(t, err)
+	assert.Equal(t, http.Header{"X-Api-Key": {"secret:1"}, "X-Tenant": {"acme"}}, h)
+
+	for _, invalid := range []string{
+		"X-Api-Key",
+		"X Api Key:secret",
+		":secret",
+		"content-type:text/plain",
+		"Host:evil.example.com",
+	} {
+		_, err = parseExtraHeaders(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestReviewExtraHeaders(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":           fb.URL,
+		"RACKSPACE_MK8S_AUTH_EXTRA_HEADERS": "X-Api-Key:secret,X-Tenant:acme",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", fb.lastHeader.Get("X-Api-Key"))
+	assert.Equal(t, "acme", fb.lastHeader.Get("X-Tenant"))
+	assert.Equal(t, "application/json", fb.lastHeader.Get("Content-Type"))
+}
+
+func TestRedactedHeaders(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_REDACTED_HEADERS": "x-gateway-session, X-Request-Signature"})()
+
+	hr, err := redactedHeaders()
+	assert.Nil(t, err)
+
+	h := http.Header{}
+	h.Set("Content-Type", "text/html")
+	h.Set("X-Request-Id", "req-1")
+	h.Add("Set-Cookie", "session=secret-1")
+	h.Add("Set-Cookie", "other=secret-2")
+	h.Set("X-Subject-Token", "secret-3")
+	h.Set("X-Gateway-Session", "secret-4")
+	h.Set("X-Request-Signature", "secret-5")
+
+	formatted := hr.format(h)
+	assert.Equal(t, `Content-Type="text/html" Set-Cookie="[REDACTED]" X-Gateway-Session="[REDACTED]" `+
+		`X-Request-Id="req-1" X-Request-Signature="[REDACTED]" X-Subject-Token="[REDACTED]"`, formatted)
+	assert.NotContains(t, formatted, "secret")
+	assert.Equal(t, "", hr.format(nil))
+}
+
+func TestRedactedHeadersInvalid(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_REDACTED_HEADERS": "X-Ok,bad header"})()
+
+	_, err := redactedHeaders()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,163 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/notifier"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// defaultHealthEventInterval is the default minimum interval between two events of a backend
+const defaultHealthEventInterval = time.Minute
+
+// backendHealth follows the health of each backend host, as the failover sees it, and publishes a
+// BackendHealthChangedTopic notification when it changes: a backend is unhealthy once a request
+// to it failed in a way worth failing over to the next backend, retries included, and healthy
+// again once it reviews a token. The notifications of a host are at least `interval` apart
+// so that a flapping backend doesn't flood the subscribers: a change within the interval is only
+// published once it has passed, by a timer if no other request comes, and if the backend didn't
+// change back meanwhile.
+// A nil backendHealth follows nothing.
+type backendHealth struct {
+	sync.Mutex
+	interval time.Duration
+	now      func() time.Time
+	notify   func(topic string, value interface{})
+	// after calls f once d has passed, time.AfterFunc when nil
+	after func(d time.Duration, f func())
+	hosts map[string]*hostHealth
+}
+
+// hostHealth is the health of a backend host
+type hostHealth struct {
+	unhealthy bool
+	// reported is the last published state, published at
+	reported  bool
+	published time.Time
+	// deferred is set while a timer is to publish a change suppressed within the interval
+	deferred bool
+}
+
+// backendHealthFromEnv returns the health tracking of RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENTS, off
+// by default, with the interval of RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENT_INTERVAL
+func backendHealthFromEnv(notify func(topic string, value interface{})) (*backendHealth, error) {
+	const intervalEnvVar = "RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENT_INTERVAL"
+
+	on, err := envBool("RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	interval, err := envDuration(intervalEnvVar, defaultHealthEventInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval < 0 {
+		return nil, fmt.Errorf("The env var %s is not a valid interval, expected 0 or more", intervalEnvVar)
+	}
+
+	if !on {
+		return nil, nil
+	}
+	return &backendHealth{
+		interval: interval,
+		now:      time.Now,
+		notify:   notify,
+		hosts:    make(map[string]*hostHealth),
+	}, nil
+}
+
+// failed records that the failover gave up on the backend host
+func (bh *backendHealth) failed(host string) {
+	bh.record(host, false)
+}
+
+// succeeded records that the backend host reviewed a token
+func (bh *backendHealth) succeeded(host string) {
+	bh.record(host, true)
+}
+
+// record sets the health of host, and publishes it once the lock is released when it's due
+func (bh *backendHealth) record(host string, healthy bool) {
+	if bh == nil {
+		return
+	}
+
+	bh.Lock()
+	h, ok := bh.hosts[host]
+	if !ok {
+		h = &hostHealth{}
+		bh.hosts[host] = h
+	}
+	if h.unhealthy == healthy {
+		h.unhealthy = !healthy
+		if healthy {
+			log.Infof("Backend %s is healthy again", host)
+		} else {
+			log.Warningf("Backend %s is unhealthy, failing over from it", host)
+		}
+	}
+	event, due := bh.due(host, h)
+	bh.Unlock()
+
+	if due && bh.notify != nil {
+		bh.notify(notifier.BackendHealthChangedTopic, event)
+	}
+}
+
+// publishDeferred publishes the change of host suppressed within the interval, if it's still due
+func (bh *backendHealth) publishDeferred(host string) {
+	bh.Lock()
+	h := bh.hosts[host]
+	h.deferred = false
+	event, due := bh.due(host, h)
+	bh.Unlock()
+
+	if due && bh.notify != nil {
+		bh.notify(notifier.BackendHealthChangedTopic, event)
+	}
+}
+
+// due returns the event of host, and whether it's due: its state isn't the last published one and
+// the interval has passed since. It's then considered published. A change within the interval is
+// deferred to publishDeferred once it has passed. The lock must be held.
+func (bh *backendHealth) due(host string, h *hostHealth) (notifier.BackendHealthChangedNotification, bool) {
+	if h.unhealthy == h.reported {
+		return notifier.BackendHealthChangedNotification{}, false
+	}
+	now := bh.now()
+	if wait := bh.interval - now.Sub(h.published); !h.published.IsZero() && wait > 0 {
+		if !h.deferred {
+			h.deferred = true
+			after := bh.after
+			if after == nil {
+				after = func(d time.Duration, f func()) { time.AfterFunc(d, f) }
+			}
+			after(wait, func() { bh.publishDeferred(host) })
+		}
+		return notifier.BackendHealthChangedNotification{}, false
+	}
+
+	h.reported, h.published = h.unhealthy, now
+	state := notifier.BackendHealthy
+	if h.unhealthy {
+		state = notifier.BackendUnhealthy
+	}
+	return notifier.BackendHealthChangedNotification{Host: host, State: state}, true
+}
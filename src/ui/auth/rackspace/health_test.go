@@ -0,0 +1,203 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+// healthEvents returns the backend health notifications captured by rec
+func healthEvents(rec *recorder) []notifier.BackendHealthChangedNotification {
+	var result []notifier.BackendHealthChangedNotification
+	for _, n := range rec.notifications {
+		if n.topic == notifier.BackendHealthChangedTopic {
+			result = append(result, n.value.(notifier.BackendHealthChangedNotification))
+		}
+	}
+	return result
+}
+
+func TestBackendHealthTransitions(t *testing.T) {
+	rec := &recorder{}
+	clock := &fakeClock{t: time.Now()}
+	r := &UserResolver{publish: rec.publish}
+	bh := &backendHealth{interval: time.Minute, now: clock.now, notify: r.notify, hosts: make(map[string]*hostHealth)}
+	unhealthy := notifier.BackendHealthChangedNotification{Host: "auth:8080", State: notifier.BackendUnhealthy}
+	healthy := notifier.BackendHealthChangedNotification{Host: "auth:8080", State: notifier.BackendHealthy}
+
+	// only the transitions are events, not every failure
+	for i := 0; i < 5; i++ {
+		bh.failed("auth:8080")
+	}
+	assert.Equal(t, []notifier.BackendHealthChangedNotification{unhealthy}, healthEvents(rec))
+
+	clock.t = clock.t.Add(time.Minute)
+	bh.succeeded("auth:8080")
+	bh.succeeded("auth:8080")
+	assert.Equal(t, []notifier.BackendHealthChangedNotification{unhealthy, healthy}, healthEvents(rec))
+
+	// flapping within the interval is suppressed
+	bh.failed("auth:8080")
+	bh.succeeded("auth:8080")
+	bh.failed("auth:8080")
+	assert.Len(t, healthEvents(rec), 2)
+
+	// and the state it settled on is published once the interval has passed
+	clock.t = clock.t.Add(time.Minute)
+	bh.failed("auth:8080")
+	assert.Equal(t, []notifier.BackendHealthChangedNotification{unhealthy, healthy, unhealthy}, healthEvents(rec))
+
+	// each host has its own health
+	bh.failed("other:8080")
+	assert.Equal(t, notifier.BackendHealthChangedNotification{Host: "other:8080", State: notifier.BackendUnhealthy}, healthEvents(rec)[3])
+
+	var disabled *backendHealth
+	disabled.failed("auth:8080")
+	disabled.succeeded("auth:8080")
+}
+
+func TestBackendHealthDeferredPublish(t *testing.T) {
+	rec := &recorder{}
+	clock := &fakeClock{t: time.Now()}
+	r := &UserResolver{publish: rec.publish}
+	var timers []func()
+	var waits []time.Duration
+	bh := &backendHealth{interval: time.Minute, now: clock.now, notify: r.notify, hosts: make(map[string]*hostHealth)}
+	bh.after = func(d time.Duration, f func()) {
+		waits = append(waits, d)
+		timers = append(timers, f)
+	}
+	unhealthy := notifier.BackendHealthChangedNotification{Host: "auth:8080", State: notifier.BackendUnhealthy}
+	healthy := notifier.BackendHealthChangedNotification{Host: "auth:8080", State: notifier.BackendHealthy}
+
+	bh.failed("auth:8080")
+	clock.t = clock.t.Add(20 * time.Second)
+	bh.succeeded("auth:8080")
+	bh.failed("auth:8080")
+	bh.succeeded("auth:8080")
+	assert.Equal(t, []notifier.BackendHealthChangedNotification{unhealthy}, healthEvents(rec))
+	// one timer for the rest of the interval, however often it flaps
+	assert.Equal(t, []time.Duration{40 * time.Second}, waits)
+
+	// the change is published without any further request
+	clock.t = clock.t.Add(40 * time.Second)
+	timers[0]()
+	assert.Equal(t, []notifier.BackendHealthChangedNotification{unhealthy, healthy}, healthEvents(rec))
+
+	// but not when the backend changed back meanwhile
+	clock.t = clock.t.Add(10 * time.Second)
+	bh.failed("auth:8080")
+	bh.succeeded("auth:8080")
+	clock.t = clock.t.Add(50 * time.Second)
+	timers[1]()
+	assert.Len(t, healthEvents(rec), 2)
+
+	// a new change is deferred again once the timer is done
+	bh.failed("auth:8080")
+	assert.Len(t, healthEvents(rec), 3)
+	bh.succeeded("auth:8080")
+	assert.Len(t, timers, 3)
+}
+
+func TestBackendHealthNotifiesUnlocked(t *testing.T) {
+	bh := &backendHealth{now: time.Now, hosts: make(map[string]*hostHealth)}
+	notified := 0
+	bh.notify = func(topic string, value interface{}) {
+		// a subscriber calling back into the health tracking mustn't deadlock
+		bh.succeeded("other:8080")
+		notified++
+	}
+
+	bh.failed("auth:8080")
+	assert.Equal(t, 1, notified)
+}
+
+func TestAuthenticateBackendHealthEvents(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	fb.status = http.StatusInternalServerError
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                   fb.URL,
+		"RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENTS": "true",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Contains(t, configSummary(a), "backendHealth=interval=1m0s")
+	rec := &recorder{}
+	a.resolver.publish = rec.publish
+	a.resolver.Store = &fakeStore{}
+
+	for _, token := range []string{"token-1", "token-2", "token-3"} {
+		_, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: token})
+		assert.NotNil(t, err)
+	}
+	host := endpointHost(fb.URL)
+	assert.Equal(t, []notifier.BackendHealthChangedNotification{{Host: host, State: notifier.BackendUnhealthy}}, healthEvents(rec))
+
+	// a rejected token says nothing about the backend's health
+	fb.status = http.StatusUnauthorized
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token-4"})
+	assert.NotNil(t, err)
+	assert.Len(t, healthEvents(rec), 1)
+}
+
+func TestFailoverBackendHealthEvents(t *testing.T) {
+	primary, one := newFakeBackend(t), newFakeBackend(t)
+	defer primary.Close()
+	defer one.Close()
+	primary.status = http.StatusServiceUnavailable
+	env := failoverEnv(primary, map[string]string{"ONE": one.URL}, "ONE")
+	env["RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENTS"] = "true"
+	defer setEnv(t, env)()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	rec := &recorder{}
+	a.resolver.publish = rec.publish
+
+	// the backend the failover moved away from is the unhealthy one
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, []notifier.BackendHealthChangedNotification{{Host: endpointHost(primary.URL), State: notifier.BackendUnhealthy}}, healthEvents(rec))
+}
+
+func TestBackendHealthFromEnv(t *testing.T) {
+	bh, err := backendHealthFromEnv(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, bh)
+
+	restore := setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENTS": "true"})
+	bh, err = backendHealthFromEnv(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultHealthEventInterval, bh.interval)
+	restore()
+
+	for _, env := range []map[string]string{
+		{"RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENTS": "maybe"},
+		{"RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENT_INTERVAL": "-1s"},
+	} {
+		restore := setEnv(t, env)
+		_, err := backendHealthFromEnv(nil)
+		assert.NotNil(t, err, "%v", env)
+		restore()
+	}
+}
@@ -0,0 +1,677 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// Identity is a user as authenticated by an identity backend, normalized so that
+// any backend can be mapped to a Harbor user by a UserResolver.
+type Identity struct {
+	// Username is the backend's current (possibly changing) name of the user
+	Username string
+	// UID is the backend's static ID of the user
+	UID    string
+	Groups []string
+	Extra  map[string][]string
+	// Audiences are the audiences the token is valid for, as returned by the backend
+	Audiences []string
+}
+
+// UserStore is the subset of the dao used to persist users.
+type UserStore interface {
+	GetUser(query models.User) (*models.User, error)
+	Register(user models.User) (int64, error)
+	ChangeUserProfile(user models.User, cols ...string) error
+	// ChangeUserPassword sets the user's password, hashed with a new salt
+	ChangeUserPassword(user models.User) error
+	// GetDeletedUserByRealname returns the most recently soft-deleted user with the realname
+	GetDeletedUserByRealname(realname string) (*models.User, error)
+	// GetDeletedUserByExternalID returns the most recently soft-deleted user with the external ID
+	GetDeletedUserByExternalID(externalID string) (*models.User, error)
+}
+
+// DAOUserStore is the UserStore backed by Harbor's database.
+type DAOUserStore struct{}
+
+// GetUser ...
+func (DAOUserStore) GetUser(query models.User) (*models.User, error) {
+	return dao.GetUser(query)
+}
+
+// Register ...
+func (DAOUserStore) Register(user models.User) (int64, error) {
+	return dao.Register(user)
+}
+
+// ChangeUserProfile ...
+func (DAOUserStore) ChangeUserProfile(user models.User, cols ...string) error {
+	return dao.ChangeUserProfile(user, cols...)
+}
+
+// ChangeUserPassword ...
+func (DAOUserStore) ChangeUserPassword(user models.User) error {
+	return dao.ChangeUserPassword(user)
+}
+
+// GetDeletedUserByRealname ...
+func (DAOUserStore) GetDeletedUserByRealname(realname string) (*models.User, error) {
+	return dao.GetDeletedUserByRealname(realname)
+}
+
+// GetDeletedUserByExternalID ...
+func (DAOUserStore) GetDeletedUserByExternalID(externalID string) (*models.User, error) {
+	return dao.GetDeletedUserByExternalID(externalID)
+}
+
+// UIDField is the field of the Harbor user holding the backend's UID
+type UIDField string
+
+const (
+	// UIDFieldExternalID stores the UID in the dedicated external ID, leaving the Realname to the
+	// username for display. Users created with the UID in the Realname are moved on their next login.
+	UIDFieldExternalID UIDField = "external_id"
+	// UIDFieldRealname stores the UID in the Realname, as it was before the external ID existed
+	UIDFieldRealname UIDField = "realname"
+)
+
+// uidField returns the configured field of the UID, UIDFieldExternalID by default
+func uidField() (UIDField, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_UID_FIELD"
+
+	field := UIDField(envOrDefault(envVar, string(UIDFieldExternalID)))
+	if field != UIDFieldExternalID && field != UIDFieldRealname {
+		return "", fmt.Errorf("The env var %s is not a valid field, expected %q or %q", envVar, UIDFieldExternalID, UIDFieldRealname)
+	}
+	return field, nil
+}
+
+// userUID returns the backend's UID of a Harbor user, wherever it's stored
+func userUID(u *models.User) string {
+	if u.ExternalID != "" {
+		return u.ExternalID
+	}
+	return u.Realname
+}
+
+// DeletedUserPolicy decides what happens when a user who was deleted in Harbor logs in again
+type DeletedUserPolicy string
+
+const (
+	// DeletedUserReject rejects the login with ErrUserDeleted
+	DeletedUserReject DeletedUserPolicy = "reject"
+	// DeletedUserReactivate restores the deleted user
+	DeletedUserReactivate DeletedUserPolicy = "reactivate"
+)
+
+// deletedUserPolicy returns the configured policy for deleted users, rejecting them by default
+func deletedUserPolicy() (DeletedUserPolicy, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_DELETED_USER_POLICY"
+
+	policy := DeletedUserPolicy(envOrDefault(envVar, string(DeletedUserReject)))
+	if policy != DeletedUserReject && policy != DeletedUserReactivate {
+		return "", fmt.Errorf("The env var %s is not a valid policy, expected %q or %q", envVar, DeletedUserReject, DeletedUserReactivate)
+	}
+	return policy, nil
+}
+
+// PasswordPolicy decides what happens to the unused password of existing users when they log in
+type PasswordPolicy string
+
+const (
+	// PasswordLeave keeps the password set when the user was created
+	PasswordLeave PasswordPolicy = "leave"
+	// PasswordRotate replaces the password with a new sentinel password on each login, so
+	// passwords made under older policies don't trip the current password validators
+	PasswordRotate PasswordPolicy = "rotate"
+)
+
+// passwordPolicy returns the configured policy for the passwords of existing users, leaving them by default
+func passwordPolicy() (PasswordPolicy, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_PASSWORD_POLICY"
+
+	policy := PasswordPolicy(envOrDefault(envVar, string(PasswordLeave)))
+	if policy != PasswordLeave && policy != PasswordRotate {
+		return "", fmt.Errorf("The env var %s is not a valid policy, expected %q or %q", envVar, PasswordLeave, PasswordRotate)
+	}
+	return policy, nil
+}
+
+// UsernameConflictPolicy decides what happens when a user found by its UID is renamed to a
+// username another user already holds. The user found by its UID always stays the one logging in.
+type UsernameConflictPolicy string
+
+const (
+	// UsernameConflictKeep skips the rename, the user keeps its old username until the other
+	// user is renamed or deleted
+	UsernameConflictKeep UsernameConflictPolicy = "keep"
+	// UsernameConflictFlag renames the other user to "<username>#conflict-<user id>" so the
+	// username is freed, flagging it for an admin to review
+	UsernameConflictFlag UsernameConflictPolicy = "flag"
+)
+
+// usernameConflictPolicy returns the configured policy for username conflicts, keeping the old username by default
+func usernameConflictPolicy() (UsernameConflictPolicy, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_USERNAME_CONFLICT_POLICY"
+
+	policy := UsernameConflictPolicy(envOrDefault(envVar, string(UsernameConflictKeep)))
+	if policy != UsernameConflictKeep && policy != UsernameConflictFlag {
+		return "", fmt.Errorf("The env var %s is not a valid policy, expected %q or %q", envVar, UsernameConflictKeep, UsernameConflictFlag)
+	}
+	return policy, nil
+}
+
+// RenameEmailPolicy decides whether a user's email is recomputed from the new username when the
+// username changes in the backend
+type RenameEmailPolicy string
+
+const (
+	// RenameEmailSynthetic recomputes the email only when it's the synthetic address derived from
+	// the username, preserving a real email set by an admin
+	RenameEmailSynthetic RenameEmailPolicy = "synthetic"
+	// RenameEmailAlways always recomputes the email, replacing a real email with a synthetic one
+	RenameEmailAlways RenameEmailPolicy = "always"
+	// RenameEmailNever keeps the email unchanged
+	RenameEmailNever RenameEmailPolicy = "never"
+)
+
+// renameEmailPolicy returns the configured policy for emails on rename, RenameEmailSynthetic by default
+func renameEmailPolicy() (RenameEmailPolicy, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_RENAME_EMAIL_POLICY"
+
+	policy := RenameEmailPolicy(envOrDefault(envVar, string(RenameEmailSynthetic)))
+	switch policy {
+	case RenameEmailSynthetic, RenameEmailAlways, RenameEmailNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("The env var %s is not a valid policy, expected %q, %q or %q", envVar, RenameEmailSynthetic, RenameEmailAlways, RenameEmailNever)
+}
+
+// recompute reports whether email is to be recomputed on rename
+func (p RenameEmailPolicy) recompute(email string, domains emailDomainMapping) bool {
+	switch p {
+	case RenameEmailAlways:
+		return true
+	case RenameEmailNever:
+		return false
+	}
+	return email == "" || domains.isSynthetic(email)
+}
+
+// defaultAdminUsername is the username of Harbor's admin
+const defaultAdminUsername = "admin"
+
+// isAdmin reports whether username is the admin's. Usernames are compared ignoring case, as the
+// database does.
+func (r *UserResolver) isAdmin(username string) bool {
+	admin := r.AdminUsername
+	if admin == "" {
+		admin = defaultAdminUsername
+	}
+	return strings.EqualFold(username, admin)
+}
+
+// usernamePrefix returns RACKSPACE_MK8S_AUTH_USERNAME_PREFIX, none by default. It can't contain an
+// "@" or whitespace as it ends up in the synthetic emails.
+func usernamePrefix() (string, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_USERNAME_PREFIX"
+
+	prefix := envOrDefault(envVar, "")
+	if strings.ContainsAny(prefix, "@ \t\r\n") {
+		return "", fmt.Errorf("The env var %s is not a valid prefix %s, it must not contain \"@\" or whitespace", envVar, prefix)
+	}
+	return prefix, nil
+}
+
+// UserResolver maps an authenticated Identity to a Harbor user, creating the user on first login
+// and keeping the Harbor record up to date with the backend afterwards.
+type UserResolver struct {
+	Store UserStore
+	// Groups, when set, is used to keep the user's group memberships in sync with the backend.
+	// A failed sync is only logged and the login proceeds with the stale memberships, unless
+	// StrictGroupSync is set, which fails the login.
+	Groups          GroupStore
+	StrictGroupSync bool
+	// MaxGroups, when positive, is the number of groups beyond which the GroupLimit policy applies,
+	// protecting the database from backends returning huge group lists
+	MaxGroups  int
+	GroupLimit GroupLimitPolicy
+	// DeletedUsers is the policy for users deleted in Harbor, they are rejected unless it's DeletedUserReactivate
+	DeletedUsers DeletedUserPolicy
+	// OnboardHook, when set, is called with each user created on first login, e.g. to provision
+	// a personal project. Its errors are only logged unless StrictOnboardHook is set, which fails
+	// the login. The created user is kept either way, so the hook isn't retried on later logins.
+	OnboardHook       func(*models.User) error
+	StrictOnboardHook bool
+	// NormalizeCase lowercases the usernames and group names of the backend, so identities
+	// differing only by case map to the same Harbor user and groups. Synthetic emails follow the
+	// lowercased usernames.
+	NormalizeCase bool
+	// NormalizeUnicode composes the usernames and group names of the backend as by NFC, so the
+	// decomposed and precomposed spellings of a name map to the same Harbor user and groups
+	NormalizeUnicode bool
+	// RenameEmails is the policy for the email of renamed users, the zero value is RenameEmailSynthetic
+	RenameEmails RenameEmailPolicy
+	// Passwords is the policy for the passwords of existing users, the zero value is PasswordLeave
+	Passwords PasswordPolicy
+	// UsernameConflicts is the policy for renames to a username held by another user, the zero
+	// value is UsernameConflictKeep
+	UsernameConflicts UsernameConflictPolicy
+	// UIDField is the field holding the backend's UID, the zero value is UIDFieldExternalID
+	UIDField UIDField
+	// AdminUsername is the username of Harbor's admin, which is never created, updated or renamed
+	// by the resolver. The zero value is defaultAdminUsername.
+	AdminUsername string
+	// UsernamePrefix is prepended to the backend's usernames, e.g. "mk8s:" for "mk8s:alice", so they
+	// don't collide with the users of other auth backends feeding the same Harbor
+	UsernamePrefix string
+
+	// groupRoles are the project roles granted to the groups when a user joins them
+	groupRoles groupRoleMapping
+	// emailDomains are the domains of the synthetic emails of the groups' members
+	emailDomains emailDomainMapping
+
+	// publish sends the onboarding notifications, they are dropped when it is nil
+	publish func(topic string, value interface{}) error
+}
+
+// NewUserResolver returns a UserResolver persisting users in Harbor's database.
+func NewUserResolver() *UserResolver {
+	return &UserResolver{
+		Store:   DAOUserStore{},
+		publish: notifier.Publish,
+	}
+}
+
+// notify publishes a notification. Failures, e.g. nobody subscribed to the topic, are only logged.
+func (r *UserResolver) notify(topic string, value interface{}) {
+	if r.publish == nil {
+		return
+	}
+	if err := r.publish(topic, value); err != nil {
+		log.Debugf("Notification %s was not published: %v", topic, err)
+	}
+}
+
+// Resolve returns the Harbor user for id, creating or updating the database record as needed.
+func (r *UserResolver) Resolve(id Identity) (*models.User, error) {
+	id = r.harborIdentity(id)
+
+	if r.isAdmin(id.Username) {
+		log.Warningf("UID=%s BackendUsername=%s Rejected, the username is reserved for Harbor's admin", id.UID, id.Username)
+		return nil, ErrReservedUsername
+	}
+
+	log.Debugf("UID=%s BackendUsername=%s Getting user from database", id.UID, id.Username)
+
+	user, err := r.lookup(id)
+	if err != nil {
+		log.Errorf("UID=%s BackendUsername=%s Error getting user from database: %v", id.UID, id.Username, err)
+		return nil, err
+	}
+
+	// a user deleted in Harbor is either rejected or reactivated, never silently created again
+	if user == nil {
+		user, err = r.deleted(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the admin is managed by Harbor alone, even when the backend's UID somehow resolves to it
+	if user != nil && r.isAdmin(user.Username) {
+		log.Warningf("UID=%s BackendUsername=%s Rejected, the user resolves to Harbor's admin", id.UID, id.Username)
+		return nil, ErrReservedUsername
+	}
+
+	// check if the user already exists in the database. if the user doesn't exist, create it.
+	if user != nil {
+		log.Debugf("UID=%s BackendUsername=%s exists in database", id.UID, id.Username)
+
+		// if the username changed in the backend, update it in the database
+		rename := user.Username != id.Username
+		if rename {
+			if rename, err = r.resolveUsernameConflict(user, id); err != nil {
+				return nil, err
+			}
+		}
+		if rename {
+			log.Debugf("UID=%s BackendUsername=%s backend username changed so updating database", id.UID, id.Username)
+
+			// the user is only changed once the database is, a failed update returns nothing half-renamed
+			oldUsername := user.Username
+			renamed := *user
+			renamed.Username = id.Username
+			if renamed.ExternalID != "" && renamed.Realname == oldUsername {
+				renamed.Realname = id.Username
+			}
+			if r.RenameEmails.recompute(renamed.Email, r.emailDomains) {
+				renamed.Email = ""
+				renamed.Email = limitEmail(emailAddress(&renamed, r.emailDomains.domain(id.Groups)))
+			}
+
+			err = r.changeUserProfile(renamed, id)
+			if err != nil {
+				log.Errorf("UID=%s BackendUsername=%s Error updating user profile: %v", id.UID, id.Username, err)
+				return nil, err
+			}
+			user = &renamed
+
+			r.notify(notifier.UserRenamedTopic, notifier.UserRenamedNotification{
+				UserID:      user.UserID,
+				OldUsername: oldUsername,
+				NewUsername: user.Username,
+				UID:         id.UID,
+				Reason:      notifier.ReasonUsernameChange,
+			})
+		}
+
+		if r.Passwords == PasswordRotate {
+			r.rotatePassword(user, id)
+		}
+	} else {
+		log.Debugf("UID=%s BackendUsername=%s does not exist in database so creating new user", id.UID, id.Username)
+
+		// store the backend's UID because the UID is a static ID whereas the backend's Username
+		// can change (so put it in the Harbor Username field for convenience)
+		// the Password field is required but unused so we set it to a random sentinel
+		user = new(models.User)
+		if r.UIDField == UIDFieldRealname {
+			user.Realname = id.UID
+		} else {
+			user.ExternalID = id.UID
+			user.Realname = id.Username
+		}
+		user.Username = id.Username
+		user.Password = sentinelPassword()
+		user.Comment = "Do not edit this user"
+		user.Email = limitEmail(emailAddress(user, r.emailDomains.domain(id.Groups)))
+
+		userID, err := r.Store.Register(*user)
+		if err != nil {
+			log.Errorf("UID=%s BackendUsername=%s Error creating new user: %v", id.UID, id.Username, err)
+			return nil, err
+		}
+
+		user.UserID = int(userID)
+
+		if r.OnboardHook != nil {
+			if err := r.OnboardHook(user); err != nil {
+				log.Errorf("UID=%s BackendUsername=%s Error running onboard hook: %v", id.UID, id.Username, err)
+				if r.StrictOnboardHook {
+					return nil, err
+				}
+			}
+		}
+
+		r.notify(notifier.UserOnboardedTopic, notifier.UserOnboardedNotification{
+			UserID:   user.UserID,
+			Username: user.Username,
+			UID:      id.UID,
+			Reason:   notifier.ReasonFirstLogin,
+		})
+	}
+
+	if r.Groups != nil {
+		if err := r.syncGroups(user, id); err != nil {
+			if r.StrictGroupSync {
+				return nil, err
+			}
+			log.Warningf("UID=%s BackendUsername=%s Proceeding with the previous group memberships", id.UID, id.Username)
+		}
+	}
+
+	return user, nil
+}
+
+// rotatePassword replaces the unused password of user with a new sentinel password. Failures are
+// only logged, the password isn't used to log in anyway.
+func (r *UserResolver) rotatePassword(user *models.User, id Identity) {
+	rotated := *user
+	rotated.Password = sentinelPassword()
+	if err := r.Store.ChangeUserPassword(rotated); err != nil {
+		log.Warningf("UID=%s BackendUsername=%s Error rotating the user's password: %v", id.UID, id.Username, err)
+	}
+}
+
+// profileUpdateAttempts is the number of times a profile update failing with a transient error is tried
+const profileUpdateAttempts = 3
+
+// profileUpdateBackoff is the wait before retrying a profile update, multiplied by the attempt number
+var profileUpdateBackoff = 100 * time.Millisecond
+
+// changeUserProfile updates the user in the database, retrying transient errors
+func (r *UserResolver) changeUserProfile(user models.User, id Identity, cols ...string) error {
+	for attempt := 1; ; attempt++ {
+		err := r.Store.ChangeUserProfile(user, cols...)
+		if err == nil || attempt >= profileUpdateAttempts || !isTransientDBError(err) {
+			return err
+		}
+		log.Warningf("UID=%s BackendUsername=%s Retrying user profile update after transient error, attempt %d of %d: %v", id.UID, id.Username, attempt+1, profileUpdateAttempts, err)
+		time.Sleep(time.Duration(attempt) * profileUpdateBackoff)
+	}
+}
+
+// isTransientDBError reports whether err may not happen again: a lost connection, a deadlock
+// or a lock wait timeout
+func isTransientDBError(err error) bool {
+	if err == driver.ErrBadConn || err == mysql.ErrInvalidConn {
+		return true
+	}
+	if e, ok := err.(*mysql.MySQLError); ok {
+		switch e.Number {
+		case mysqlLockWaitTimeout, mysqlDeadlock:
+			return true
+		}
+	}
+	return false
+}
+
+// the MySQL error numbers of transient errors
+const (
+	mysqlLockWaitTimeout = 1205
+	mysqlDeadlock        = 1213
+)
+
+// harborIdentity returns id with the username and groups Harbor knows the user by: normalized
+// when NormalizeUnicode or NormalizeCase is set, and the username prefixed and limited to the user
+// table's length
+func (r *UserResolver) harborIdentity(id Identity) Identity {
+	id.Username = limitUsername(r.UsernamePrefix + r.normalizeName(id.Username))
+	if id.Groups != nil {
+		groups := make([]string, len(id.Groups))
+		for i, name := range id.Groups {
+			groups[i] = r.normalizeName(name)
+		}
+		id.Groups = groups
+	}
+	return id
+}
+
+// normalizeName returns a username or group name of the backend as Harbor knows it: composed as by
+// NFC when NormalizeUnicode is set, then lowercased when NormalizeCase is set. The configured group
+// names are normalized the same way, so they match the backend's.
+func (r *UserResolver) normalizeName(name string) string {
+	if r.NormalizeUnicode {
+		name = composeNFC(name)
+	}
+	if r.NormalizeCase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// lookup finds the Harbor user of id. The static UID is tried first so that a user renamed in the
+// backend is still found, then the username. Users with the UID still in the Realname are found
+// too and, unless UIDField is UIDFieldRealname, moved to the external ID.
+func (r *UserResolver) lookup(id Identity) (*models.User, error) {
+	if id.UID != "" {
+		if r.UIDField != UIDFieldRealname {
+			user, err := r.Store.GetUser(models.User{ExternalID: id.UID})
+			if err != nil || user != nil {
+				return user, err
+			}
+		}
+
+		user, err := r.Store.GetUser(models.User{Realname: id.UID})
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && user.ExternalID == "" {
+			// the admin is returned unchanged, for Resolve to reject
+			if r.isAdmin(user.Username) {
+				return user, nil
+			}
+			return r.migrateUID(user, id)
+		}
+	}
+
+	return r.Store.GetUser(models.User{Username: id.Username})
+}
+
+// migrateUID moves the UID of a user found by its Realname to the external ID, the Realname
+// becoming the username. The user is returned unchanged when UIDField is UIDFieldRealname.
+func (r *UserResolver) migrateUID(user *models.User, id Identity) (*models.User, error) {
+	if r.UIDField == UIDFieldRealname {
+		return user, nil
+	}
+
+	migrated := *user
+	migrated.ExternalID = id.UID
+	migrated.Realname = migrated.Username
+	if err := r.changeUserProfile(migrated, id, "Realname", "ExternalID"); err != nil {
+		log.Errorf("UID=%s BackendUsername=%s Error moving the UID to the external ID: %v", id.UID, id.Username, err)
+		return nil, err
+	}
+
+	log.Infof("UID=%s BackendUsername=%s UserID=%d moved the UID from the realname to the external ID", id.UID, id.Username, user.UserID)
+	return &migrated, nil
+}
+
+// resolveUsernameConflict handles another user holding the username user is to be renamed to,
+// according to the UsernameConflicts policy. It returns whether the rename can go ahead.
+func (r *UserResolver) resolveUsernameConflict(user *models.User, id Identity) (bool, error) {
+	other, err := r.Store.GetUser(models.User{Username: id.Username})
+	if err != nil {
+		log.Errorf("UID=%s BackendUsername=%s Error getting the user holding the username: %v", id.UID, id.Username, err)
+		return false, err
+	}
+	if other == nil || other.UserID == user.UserID {
+		return true, nil
+	}
+
+	if r.UsernameConflicts != UsernameConflictFlag {
+		log.Warningf("UID=%s BackendUsername=%s UserID=%d the username is held by UserID=%d, keeping the username %s", id.UID, id.Username, user.UserID, other.UserID, user.Username)
+		return false, nil
+	}
+
+	suffix := fmt.Sprintf("#conflict-%d", other.UserID)
+	flagged := *other
+	flagged.Username = truncateWithHash(other.Username, maxUsernameLength-len(suffix)) + suffix
+	if r.emailDomains.isSynthetic(other.Email) {
+		flagged.Email = limitEmail(flagged.Username + other.Email[strings.LastIndex(other.Email, "@"):])
+	}
+	if err := r.changeUserProfile(flagged, id, "Username", "Email"); err != nil {
+		log.Errorf("UID=%s BackendUsername=%s Error flagging UserID=%d holding the username: %v", id.UID, id.Username, other.UserID, err)
+		return false, err
+	}
+
+	log.Warningf("UID=%s BackendUsername=%s UserID=%d the username was held by UserID=%d, renamed it to %s", id.UID, id.Username, user.UserID, other.UserID, flagged.Username)
+	r.notify(notifier.UserRenamedTopic, notifier.UserRenamedNotification{
+		UserID:      other.UserID,
+		OldUsername: other.Username,
+		NewUsername: flagged.Username,
+		UID:         other.ExternalID,
+		Reason:      notifier.ReasonUsernameConflict,
+	})
+	return true, nil
+}
+
+// getDeletedUser returns the most recently deleted user with the UID, in its external ID or,
+// for users deleted before it existed, in its Realname
+func (r *UserResolver) getDeletedUser(uid string) (*models.User, error) {
+	if r.UIDField != UIDFieldRealname {
+		user, err := r.Store.GetDeletedUserByExternalID(uid)
+		if err != nil || user != nil {
+			return user, err
+		}
+	}
+
+	user, err := r.Store.GetDeletedUserByRealname(uid)
+	if err != nil || user == nil || user.ExternalID != "" {
+		return nil, err
+	}
+	return user, nil
+}
+
+// deleted applies the DeletedUsers policy when id belongs to a user deleted in Harbor. It returns
+// the reactivated user, ErrUserDeleted when the login is rejected, or nil if id was never deleted.
+func (r *UserResolver) deleted(id Identity) (*models.User, error) {
+	if id.UID == "" {
+		return nil, nil
+	}
+
+	user, err := r.getDeletedUser(id.UID)
+	if err != nil {
+		log.Errorf("UID=%s BackendUsername=%s Error getting deleted user from database: %v", id.UID, id.Username, err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	if r.DeletedUsers != DeletedUserReactivate {
+		log.Warningf("UID=%s BackendUsername=%s UserID=%d was deleted in Harbor, rejecting login", id.UID, id.Username, user.UserID)
+		return nil, ErrUserDeleted
+	}
+
+	log.Warningf("UID=%s BackendUsername=%s UserID=%d was deleted in Harbor, reactivating it", id.UID, id.Username, user.UserID)
+
+	// deleting a user suffixes its username and email with "#<user id>", so both are set afresh
+	user.Deleted = 0
+	user.Username = id.Username
+	user.Email = ""
+	user.Email = limitEmail(emailAddress(user, r.emailDomains.domain(id.Groups)))
+	cols := []string{"Username", "Email", "Deleted"}
+	if r.UIDField != UIDFieldRealname {
+		user.ExternalID = id.UID
+		user.Realname = id.Username
+		cols = append(cols, "Realname", "ExternalID")
+	}
+
+	if err := r.Store.ChangeUserProfile(*user, cols...); err != nil {
+		log.Errorf("UID=%s BackendUsername=%s Error reactivating user: %v", id.UID, id.Username, err)
+		return nil, err
+	}
+
+	r.notify(notifier.UserOnboardedTopic, notifier.UserOnboardedNotification{
+		UserID:   user.UserID,
+		Username: user.Username,
+		UID:      id.UID,
+		Reason:   notifier.ReasonReactivated,
+	})
+
+	return user, nil
+}
@@ -0,0 +1,706 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+// fakeStore is an in-memory UserStore
+type fakeStore struct {
+	users     []models.User
+	registers int
+	updates   int
+	// err, when set, is returned by every call
+	err error
+	// updateErrs are returned by the next profile updates, which don't change the user
+	updateErrs []error
+	// passwordChanges counts the password updates
+	passwordChanges int
+}
+
+func (fs *fakeStore) GetUser(query models.User) (*models.User, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	for _, u := range fs.users {
+		if u.Deleted != 0 {
+			continue
+		}
+		if (query.UserID == 0 || query.UserID == u.UserID) &&
+			(query.Username == "" || query.Username == u.Username) &&
+			(query.Email == "" || query.Email == u.Email) &&
+			(query.Realname == "" || query.Realname == u.Realname) &&
+			(query.ExternalID == "" || query.ExternalID == u.ExternalID) {
+			found := u
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *fakeStore) Register(user models.User) (int64, error) {
+	if fs.err != nil {
+		return 0, fs.err
+	}
+	fs.registers++
+	user.UserID = len(fs.users) + 1
+	fs.users = append(fs.users, user)
+	return int64(user.UserID), nil
+}
+
+func (fs *fakeStore) ChangeUserProfile(user models.User, cols ...string) error {
+	if fs.err != nil {
+		return fs.err
+	}
+	fs.updates++
+	if len(fs.updateErrs) > 0 {
+		err := fs.updateErrs[0]
+		fs.updateErrs = fs.updateErrs[1:]
+		return err
+	}
+	for i, u := range fs.users {
+		if u.UserID == user.UserID {
+			fs.users[i] = user
+			return nil
+		}
+	}
+	return errors.New("user not found")
+}
+
+func (fs *fakeStore) ChangeUserPassword(user models.User) error {
+	if fs.err != nil {
+		return fs.err
+	}
+	fs.passwordChanges++
+	for i, u := range fs.users {
+		if u.UserID == user.UserID {
+			fs.users[i].Password = user.Password
+			return nil
+		}
+	}
+	return errors.New("user not found")
+}
+
+func (fs *fakeStore) GetDeletedUserByRealname(realname string) (*models.User, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	for i := len(fs.users) - 1; i >= 0; i-- {
+		if u := fs.users[i]; u.Deleted != 0 && u.Realname == realname {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *fakeStore) GetDeletedUserByExternalID(externalID string) (*models.User, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	for i := len(fs.users) - 1; i >= 0; i-- {
+		if u := fs.users[i]; u.Deleted != 0 && u.ExternalID == externalID {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestResolveCreatesUser(t *testing.T) {
+	store := &fakeStore{}
+	r := &UserResolver{Store: store}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "uid-alice", user.ExternalID)
+	assert.Equal(t, "alice", user.Realname)
+	assert.Equal(t, "alice@rackspace-mk8s.invalid", user.Email)
+	assert.NotEmpty(t, user.Password)
+	assert.Equal(t, 1, store.registers)
+
+	// a second login finds the existing user
+	user, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, 1, store.registers)
+	assert.Equal(t, 0, store.updates)
+}
+
+func TestResolveStoreError(t *testing.T) {
+	store := &fakeStore{err: errors.New("db is down")}
+	r := &UserResolver{Store: store}
+
+	_, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Equal(t, store.err, err)
+}
+
+// recordedNotification is a notification captured by a recorder
+type recordedNotification struct {
+	topic string
+	value interface{}
+}
+
+// recorder captures the notifications published by a UserResolver
+type recorder struct {
+	notifications []recordedNotification
+}
+
+func (rec *recorder) publish(topic string, value interface{}) error {
+	rec.notifications = append(rec.notifications, recordedNotification{topic: topic, value: value})
+	return nil
+}
+
+func TestResolveRenamedUser(t *testing.T) {
+	store := &fakeStore{}
+	r := &UserResolver{Store: store}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+
+	renamed, err := r.Resolve(Identity{Username: "alicia", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, renamed.UserID)
+	assert.Equal(t, "alicia", renamed.Username)
+	assert.Equal(t, 1, store.registers)
+	assert.Equal(t, 1, store.updates)
+}
+
+func TestResolveUsernameConflict(t *testing.T) {
+	conflicting := func() *fakeStore {
+		return &fakeStore{users: []models.User{
+			{UserID: 1, Username: "alice", ExternalID: "uid-alice", Realname: "alice", Email: "alice@rackspace-mk8s.invalid"},
+			{UserID: 2, Username: "alicia", ExternalID: "uid-other", Realname: "alicia", Email: "alicia@rackspace-mk8s.invalid"},
+		}}
+	}
+
+	// the UID-matched user wins and keeps its username by default
+	store := conflicting()
+	r := &UserResolver{Store: store}
+	user, err := r.Resolve(Identity{Username: "alicia", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, 0, store.updates)
+
+	// or the other user is flagged to free the username
+	store = conflicting()
+	rec := &recorder{}
+	r = &UserResolver{Store: store, UsernameConflicts: UsernameConflictFlag, publish: rec.publish}
+	user, err = r.Resolve(Identity{Username: "alicia", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, "alicia", user.Username)
+	assert.Equal(t, "alicia@rackspace-mk8s.invalid", user.Email)
+	assert.Equal(t, "alicia#conflict-2", store.users[1].Username)
+	assert.Equal(t, "alicia#conflict-2@rackspace-mk8s.invalid", store.users[1].Email)
+	assert.Equal(t, "uid-other", store.users[1].ExternalID)
+	assert.Contains(t, rec.notifications, recordedNotification{
+		topic: notifier.UserRenamedTopic,
+		value: notifier.UserRenamedNotification{UserID: 2, OldUsername: "alicia", NewUsername: "alicia#conflict-2", UID: "uid-other", Reason: notifier.ReasonUsernameConflict},
+	})
+}
+
+func TestUsernameConflictPolicy(t *testing.T) {
+	policy, err := usernameConflictPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, UsernameConflictKeep, policy)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_USERNAME_CONFLICT_POLICY": "merge"})()
+	_, err = usernameConflictPolicy()
+	assert.NotNil(t, err)
+}
+
+func TestResolveRenamedUserEmail(t *testing.T) {
+	store := &fakeStore{users: []models.User{
+		{UserID: 1, Username: "alice", Realname: "uid-alice", Email: "alice@rackspace-mk8s.invalid"},
+		{UserID: 2, Username: "bob", Realname: "uid-bob", Email: "bob@example.com"},
+	}}
+	r := &UserResolver{Store: store}
+
+	// a synthetic email follows the username
+	renamed, err := r.Resolve(Identity{Username: "alicia", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alicia@rackspace-mk8s.invalid", renamed.Email)
+
+	// an email set by an admin is preserved
+	renamed, err = r.Resolve(Identity{Username: "robert", UID: "uid-bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, "robert", renamed.Username)
+	assert.Equal(t, "bob@example.com", renamed.Email)
+
+	r.RenameEmails = RenameEmailAlways
+	renamed, err = r.Resolve(Identity{Username: "bobby", UID: "uid-bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, "bobby@rackspace-mk8s.invalid", renamed.Email)
+
+	r.RenameEmails = RenameEmailNever
+	renamed, err = r.Resolve(Identity{Username: "ally", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alicia@rackspace-mk8s.invalid", renamed.Email)
+}
+
+func TestResolveRenamedUserTransientError(t *testing.T) {
+	defer func(backoff time.Duration) { profileUpdateBackoff = backoff }(profileUpdateBackoff)
+	profileUpdateBackoff = time.Millisecond
+
+	store := &fakeStore{users: []models.User{{UserID: 1, Username: "alice", Realname: "alice", ExternalID: "uid-alice", Email: "alice@rackspace-mk8s.invalid"}}}
+	r := &UserResolver{Store: store}
+
+	// the first attempt fails with a deadlock, the second succeeds
+	store.updateErrs = []error{&mysql.MySQLError{Number: mysqlDeadlock, Message: "Deadlock found"}}
+	user, err := r.Resolve(Identity{Username: "alice2", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice2", user.Username)
+	assert.Equal(t, 2, store.updates)
+	assert.Equal(t, "alice2", store.users[0].Username)
+
+	// a persistent error fails the login and leaves the database unchanged
+	store.updates = 0
+	store.updateErrs = []error{errors.New("duplicate entry"), nil}
+	_, err = r.Resolve(Identity{Username: "alice3", UID: "uid-alice"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, store.updates, "only transient errors are retried")
+	assert.Equal(t, "alice2", store.users[0].Username)
+	assert.Equal(t, "alice2@rackspace-mk8s.invalid", store.users[0].Email)
+}
+
+func TestResolveMigratesUIDToExternalID(t *testing.T) {
+	// alice was created with the UID in the Realname
+	store := &fakeStore{users: []models.User{{UserID: 1, Username: "alice", Realname: "uid-alice", Email: "alice@rackspace-mk8s.invalid"}}}
+	r := &UserResolver{Store: store}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, "uid-alice", user.ExternalID)
+	assert.Equal(t, "alice", user.Realname)
+	assert.Equal(t, *user, store.users[0])
+	assert.Equal(t, 1, store.updates)
+
+	// then found by the external ID, even once renamed, the Realname following the username
+	renamed, err := r.Resolve(Identity{Username: "alicia", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, renamed.UserID)
+	assert.Equal(t, "alicia", renamed.Realname)
+	assert.Equal(t, 2, store.updates)
+	assert.Equal(t, 0, store.registers)
+
+	// a Realname set by an admin is left alone
+	store.users[0].Realname = "Alice Liddell"
+	renamed, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Alice Liddell", renamed.Realname)
+
+	// the Realname of a migrated user isn't mistaken for a UID
+	bob, err := r.Resolve(Identity{Username: "bob", UID: "Alice Liddell"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, 1, bob.UserID)
+}
+
+func TestResolveUIDFieldRealname(t *testing.T) {
+	store := &fakeStore{users: []models.User{{UserID: 1, Username: "alice", Realname: "uid-alice", Email: "alice@rackspace-mk8s.invalid"}}}
+	r := &UserResolver{Store: store, UIDField: UIDFieldRealname}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, "", user.ExternalID)
+	assert.Equal(t, 0, store.updates)
+
+	bob, err := r.Resolve(Identity{Username: "bob", UID: "uid-bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, "uid-bob", bob.Realname)
+	assert.Equal(t, "", bob.ExternalID)
+}
+
+func TestUIDField(t *testing.T) {
+	field, err := uidField()
+	assert.Nil(t, err)
+	assert.Equal(t, UIDFieldExternalID, field)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_UID_FIELD": "comment"})()
+	_, err = uidField()
+	assert.NotNil(t, err)
+}
+
+func TestResolvePasswordPolicy(t *testing.T) {
+	newStore := func() *fakeStore {
+		return &fakeStore{users: []models.User{{UserID: 1, Username: "alice", Realname: "alice", ExternalID: "uid-alice", Password: "oldrandompassword"}}}
+	}
+
+	// left as is by default
+	store := newStore()
+	r := &UserResolver{Store: store}
+	_, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, store.passwordChanges)
+	assert.Equal(t, "oldrandompassword", store.users[0].Password)
+
+	// rotated on each login
+	store = newStore()
+	r = &UserResolver{Store: store, Passwords: PasswordRotate}
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	first := store.users[0].Password
+	assert.NotEqual(t, "oldrandompassword", first)
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, store.users[0].Password)
+	assert.Equal(t, 2, store.passwordChanges)
+
+	// new users aren't rotated, they get a sentinel password when created
+	_, err = r.Resolve(Identity{Username: "bob", UID: "uid-bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, store.passwordChanges)
+	assert.Len(t, store.users[1].Password, sentinelPasswordLength)
+}
+
+func TestSentinelPassword(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		p := sentinelPassword()
+		assert.Len(t, p, sentinelPasswordLength)
+		assert.True(t, strings.ContainsAny(p, "abcdefghijklmnopqrstuvwxyz"), p)
+		assert.True(t, strings.ContainsAny(p, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"), p)
+		assert.True(t, strings.ContainsAny(p, "0123456789"), p)
+		assert.False(t, seen[p])
+		seen[p] = true
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy, err := passwordPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, PasswordLeave, policy)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_PASSWORD_POLICY": "random"})()
+	_, err = passwordPolicy()
+	assert.NotNil(t, err)
+}
+
+func TestIsTransientDBError(t *testing.T) {
+	assert.True(t, isTransientDBError(driver.ErrBadConn))
+	assert.True(t, isTransientDBError(&mysql.MySQLError{Number: mysqlLockWaitTimeout}))
+	assert.False(t, isTransientDBError(&mysql.MySQLError{Number: 1062}))
+	assert.False(t, isTransientDBError(errors.New("boom")))
+}
+
+func TestRenameEmailPolicy(t *testing.T) {
+	policy, err := renameEmailPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, RenameEmailSynthetic, policy)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_RENAME_EMAIL_POLICY": "never"})()
+	policy, err = renameEmailPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, RenameEmailNever, policy)
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_RENAME_EMAIL_POLICY", "sometimes")
+	_, err = renameEmailPolicy()
+	assert.NotNil(t, err)
+}
+
+func TestResolveNormalizeCase(t *testing.T) {
+	store := &fakeStore{}
+	groups := &fakeGroupStore{}
+	r := &UserResolver{Store: store, Groups: groups, NormalizeCase: true}
+
+	user, err := r.Resolve(Identity{Username: "Alice", Groups: []string{"Devs"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "alice@rackspace-mk8s.invalid", user.Email)
+
+	same, err := r.Resolve(Identity{Username: "alice", Groups: []string{"devs", "DEVS"}})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, same.UserID)
+	assert.Equal(t, 1, store.registers)
+	assert.Len(t, groups.groups, 1)
+
+	// without normalization, the case makes another user
+	r.NormalizeCase = false
+	other, err := r.Resolve(Identity{Username: "ALICE"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, user.UserID, other.UserID)
+}
+
+func TestResolveUsernamePrefix(t *testing.T) {
+	// alice of another auth backend
+	store := &fakeStore{users: []models.User{{UserID: 1, Username: "alice", Email: "alice@example.com"}}}
+	r := &UserResolver{Store: store, UsernamePrefix: "mk8s:"}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, 1, user.UserID)
+	assert.Equal(t, "mk8s:alice", user.Username)
+	assert.Equal(t, "mk8s:alice@rackspace-mk8s.invalid", user.Email)
+
+	// found again by UID and by username
+	same, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, same.UserID)
+	same, err = r.Resolve(Identity{Username: "alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, same.UserID)
+	assert.Equal(t, 1, store.registers)
+
+	// a rename keeps the prefix
+	renamed, err := r.Resolve(Identity{Username: "alice2", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, renamed.UserID)
+	assert.Equal(t, "mk8s:alice2", renamed.Username)
+	assert.Equal(t, "mk8s:alice2@rackspace-mk8s.invalid", renamed.Email)
+
+	// the other backend's alice is untouched, and is who an unprefixed alice resolves to
+	assert.Equal(t, models.User{UserID: 1, Username: "alice", Email: "alice@example.com"}, store.users[0])
+	r.UsernamePrefix = ""
+	other, err := r.Resolve(Identity{Username: "alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, other.UserID)
+}
+
+func TestUsernamePrefix(t *testing.T) {
+	prefix, err := usernamePrefix()
+	assert.Nil(t, err)
+	assert.Equal(t, "", prefix)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_USERNAME_PREFIX": "mk8s:"})()
+	prefix, err = usernamePrefix()
+	assert.Nil(t, err)
+	assert.Equal(t, "mk8s:", prefix)
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_USERNAME_PREFIX", "mk8s@")
+	_, err = usernamePrefix()
+	assert.NotNil(t, err)
+}
+
+func TestResolveNotificationReasons(t *testing.T) {
+	rec := &recorder{}
+	r := &UserResolver{Store: &fakeStore{}, publish: rec.publish}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	_, err = r.Resolve(Identity{Username: "alicia", UID: "uid-alice"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []recordedNotification{
+		{
+			topic: notifier.UserOnboardedTopic,
+			value: notifier.UserOnboardedNotification{
+				UserID:   user.UserID,
+				Username: "alice",
+				UID:      "uid-alice",
+				Reason:   notifier.ReasonFirstLogin,
+			},
+		},
+		{
+			topic: notifier.UserRenamedTopic,
+			value: notifier.UserRenamedNotification{
+				UserID:      user.UserID,
+				OldUsername: "alice",
+				NewUsername: "alicia",
+				UID:         "uid-alice",
+				Reason:      notifier.ReasonUsernameChange,
+			},
+		},
+	}, rec.notifications)
+}
+
+// deletedStore returns a store holding alice, deleted in Harbor
+func deletedStore() *fakeStore {
+	return &fakeStore{users: []models.User{{
+		UserID:   1,
+		Username: "alice#1",
+		Email:    "alice@rackspace-mk8s.invalid#1",
+		Realname: "uid-alice",
+		Deleted:  1,
+	}}}
+}
+
+func TestResolveDeletedUserByExternalID(t *testing.T) {
+	rec := &recorder{}
+	store := deletedStore()
+	store.users[0].Realname = "alice"
+	store.users[0].ExternalID = "uid-alice"
+	r := &UserResolver{Store: store, DeletedUsers: DeletedUserReactivate, publish: rec.publish}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, "uid-alice", user.ExternalID)
+	assert.Equal(t, 0, user.Deleted)
+	assert.Equal(t, 0, store.registers)
+}
+
+func TestResolveDeletedUserReject(t *testing.T) {
+	store := deletedStore()
+	r := &UserResolver{Store: store, DeletedUsers: DeletedUserReject}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Equal(t, ErrUserDeleted, err)
+	assert.Nil(t, user)
+	assert.Equal(t, 0, store.registers)
+	assert.Equal(t, 0, store.updates)
+
+	// rejecting is the default
+	r.DeletedUsers = ""
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Equal(t, ErrUserDeleted, err)
+}
+
+func TestResolveDeletedUserReactivate(t *testing.T) {
+	rec := &recorder{}
+	store := deletedStore()
+	r := &UserResolver{Store: store, DeletedUsers: DeletedUserReactivate, publish: rec.publish}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "alice@rackspace-mk8s.invalid", user.Email)
+	assert.Equal(t, 0, user.Deleted)
+	assert.Equal(t, 0, store.registers)
+	assert.Equal(t, 1, store.updates)
+
+	assert.Equal(t, []recordedNotification{{
+		topic: notifier.UserOnboardedTopic,
+		value: notifier.UserOnboardedNotification{
+			UserID:   1,
+			Username: "alice",
+			UID:      "uid-alice",
+			Reason:   notifier.ReasonReactivated,
+		},
+	}}, rec.notifications)
+
+	// the reactivated user is found on the next login
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, store.updates)
+}
+
+func TestDeletedUserPolicy(t *testing.T) {
+	policy, err := deletedUserPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, DeletedUserReject, policy)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_DELETED_USER_POLICY": "reactivate"})()
+	policy, err = deletedUserPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, DeletedUserReactivate, policy)
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_DELETED_USER_POLICY", "ignore")
+	_, err = deletedUserPolicy()
+	assert.NotNil(t, err)
+}
+
+func TestResolveOnboardHook(t *testing.T) {
+	var hooked []models.User
+	r := &UserResolver{
+		Store: &fakeStore{},
+		OnboardHook: func(user *models.User) error {
+			hooked = append(hooked, *user)
+			return nil
+		},
+	}
+
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	_, err = r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	_, err = r.Resolve(Identity{Username: "alicia", UID: "uid-alice"})
+	assert.Nil(t, err)
+
+	// the hook only runs when the user is created
+	if assert.Len(t, hooked, 1) {
+		assert.Equal(t, user.UserID, hooked[0].UserID)
+		assert.Equal(t, "alice", hooked[0].Username)
+	}
+}
+
+func TestResolveOnboardHookError(t *testing.T) {
+	hookErr := errors.New("failed to create project")
+	r := &UserResolver{
+		Store: &fakeStore{},
+		OnboardHook: func(user *models.User) error {
+			return hookErr
+		},
+	}
+
+	// errors are only logged by default
+	user, err := r.Resolve(Identity{Username: "alice", UID: "uid-alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+
+	// and fail the login when strict
+	r.StrictOnboardHook = true
+	_, err = r.Resolve(Identity{Username: "bob", UID: "uid-bob"})
+	assert.Equal(t, hookErr, err)
+}
+
+func TestResolveAdminUntouched(t *testing.T) {
+	admin := models.User{UserID: 1, Username: "admin", Realname: "system admin", Email: "admin@example.com"}
+	store := &fakeStore{users: []models.User{admin}}
+	r := &UserResolver{Store: store}
+
+	// the backend's user is named admin
+	_, err := r.Resolve(Identity{Username: "admin", UID: "uid-admin"})
+	assert.Equal(t, ErrReservedUsername, err)
+	_, err = r.Resolve(Identity{Username: "Admin", UID: "uid-admin"})
+	assert.Equal(t, ErrReservedUsername, err)
+
+	// the backend's UID resolves to the admin, who would be renamed
+	_, err = r.Resolve(Identity{Username: "mallory", UID: "system admin"})
+	assert.Equal(t, ErrReservedUsername, err)
+
+	assert.Equal(t, []models.User{admin}, store.users)
+	assert.Equal(t, 0, store.updates)
+
+	// a configured admin username is reserved instead
+	r.AdminUsername = "root"
+	_, err = r.Resolve(Identity{Username: "root", UID: "uid-root"})
+	assert.Equal(t, ErrReservedUsername, err)
+}
+
+func TestAuthenticateAdminUntouched(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	fb.response.Status.User.Username = "admin"
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	admin := models.User{UserID: 1, Username: "admin", Realname: "system admin"}
+	store := &fakeStore{users: []models.User{admin}}
+	a.resolver.Store = store
+
+	user, err := a.Authenticate(models.AuthModel{Principal: "admin", Password: "token"})
+	assert.Nil(t, user)
+	assert.Equal(t, ErrReservedUsername, err)
+	assert.Equal(t, []models.User{admin}, store.users)
+	assert.Equal(t, 0, store.registers+store.updates)
+}
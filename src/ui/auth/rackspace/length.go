@@ -0,0 +1,164 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+const (
+	// the user table's username and email columns are varchar(255), with 11 characters
+	// reserved for the "#user_id" suffix Harbor appends when a user is deleted
+	maxUsernameLength = 244
+	maxEmailLength    = 244
+
+	// maxEmailLocalPartLength is RFC 5321's limit of the part of an address before the "@"
+	maxEmailLocalPartLength = 64
+
+	// hashSuffixLength is the length of the "-<hash>" suffix of truncated values
+	hashSuffixLength = 9
+
+	// the default limits of the response's Extra field kept for a user
+	defaultMaxExtraKeys  = 100
+	defaultMaxExtraBytes = 64 * 1024
+)
+
+// truncateWithHash shortens s to at most max bytes. A truncated value ends with a hash of
+// the full value, so it is the same on every login and two long values sharing a prefix
+// don't collide. It's cut at a rune boundary, so it stays valid UTF-8.
+func truncateWithHash(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	suffix := "-" + hex.EncodeToString(sum[:])[:hashSuffixLength-1]
+	cut := max - len(suffix)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + suffix
+}
+
+// limitUsername truncates a username too long for the user table
+func limitUsername(username string) string {
+	limited := truncateWithHash(username, maxUsernameLength)
+	if limited != username {
+		log.Warningf("BackendUsername=%s is longer than %d characters, truncated to %s", username, maxUsernameLength, limited)
+	}
+	return limited
+}
+
+// limitEmail truncates the local part of an email too long for the user table
+func limitEmail(email string) string {
+	if len(email) <= maxEmailLength {
+		return email
+	}
+
+	local, domain := email, ""
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		local, domain = email[:i], email[i:]
+	}
+
+	// a domain leaving no room for the local part is truncated with it
+	if maxEmailLength-len(domain) < hashSuffixLength {
+		local, domain = email, ""
+	}
+
+	limited := truncateWithHash(local, maxEmailLength-len(domain)) + domain
+	log.Warningf("Email=%s is longer than %d characters, truncated to %s", email, maxEmailLength, limited)
+	return limited
+}
+
+// extraLimit is the number of keys, and bytes of keys and values, of the Extra field of the
+// backend's response kept for a user. 0 means no limit.
+type extraLimit struct {
+	keys  int
+	bytes int
+}
+
+// extraLimits returns the limits of RACKSPACE_MK8S_AUTH_MAX_EXTRA_KEYS and RACKSPACE_MK8S_AUTH_MAX_EXTRA_BYTES
+func extraLimits() (extraLimit, error) {
+	keys, err := envInt("RACKSPACE_MK8S_AUTH_MAX_EXTRA_KEYS", defaultMaxExtraKeys)
+	if err != nil {
+		return extraLimit{}, err
+	}
+	if keys < 0 {
+		return extraLimit{}, fmt.Errorf("The env var RACKSPACE_MK8S_AUTH_MAX_EXTRA_KEYS is not a valid limit, expected 0 or more")
+	}
+
+	bytes, err := envInt("RACKSPACE_MK8S_AUTH_MAX_EXTRA_BYTES", defaultMaxExtraBytes)
+	if err != nil {
+		return extraLimit{}, err
+	}
+	if bytes < 0 {
+		return extraLimit{}, fmt.Errorf("The env var RACKSPACE_MK8S_AUTH_MAX_EXTRA_BYTES is not a valid limit, expected 0 or more")
+	}
+
+	return extraLimit{keys: keys, bytes: bytes}, nil
+}
+
+// limitExtra returns the Extra field of id within the limit. Keys are kept in sorted order, so the
+// same ones are kept on every login, and everything from the first value which doesn't fit is dropped.
+func (l extraLimit) limitExtra(id Identity) map[string][]string {
+	keys := make([]string, 0, len(id.Extra))
+	size := 0
+	for key, values := range id.Extra {
+		keys = append(keys, key)
+		size += len(key)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	if (l.keys == 0 || len(keys) <= l.keys) && (l.bytes == 0 || size <= l.bytes) {
+		return id.Extra
+	}
+	sort.Strings(keys)
+
+	limited := make(map[string][]string)
+	used, dropped, full := 0, 0, false
+	for _, key := range keys {
+		full = full || (l.keys > 0 && len(limited) == l.keys) || (l.bytes > 0 && used+len(key) > l.bytes)
+
+		var values []string
+		for _, v := range id.Extra[key] {
+			full = full || (l.bytes > 0 && used+len(key)+len(v) > l.bytes)
+			if full {
+				dropped++
+				continue
+			}
+			used += len(v)
+			values = append(values, v)
+		}
+		if len(values) > 0 {
+			used += len(key)
+			limited[key] = values
+		}
+	}
+
+	log.Warningf("UID=%s BackendUsername=%s Extra has %d keys and %d bytes, more than the limit of %d keys and %d bytes, kept %d keys and dropped %d values",
+		id.UID, id.Username, len(keys), size, l.keys, l.bytes, len(limited), dropped)
+	return limited
+}
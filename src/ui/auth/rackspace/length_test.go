@@ -0,0 +1,140 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestLimitUsername(t *testing.T) {
+	assert.Equal(t, "alice", limitUsername("alice"))
+
+	long := strings.Repeat("a", 300)
+	limited := limitUsername(long)
+	assert.Len(t, limited, maxUsernameLength)
+	assert.Equal(t, limited, limitUsername(long), "truncation must be deterministic")
+	assert.NotEqual(t, limited, limitUsername(long+"b"), "long usernames sharing a prefix must not collide")
+}
+
+func TestLimitEmail(t *testing.T) {
+	assert.Equal(t, "alice@rackspace-mk8s.invalid", limitEmail("alice@rackspace-mk8s.invalid"))
+
+	long := strings.Repeat("a", 300) + "@rackspace-mk8s.invalid"
+	limited := limitEmail(long)
+	assert.Len(t, limited, maxEmailLength)
+	assert.True(t, strings.HasSuffix(limited, "@rackspace-mk8s.invalid"))
+	assert.Equal(t, limited, limitEmail(long))
+
+	// the domain is kept even when the local part has multi-byte runes, and truncated with it when
+	// it's too long itself
+	long = strings.Repeat("é", 150) + "@example.org"
+	limited = limitEmail(long)
+	assert.True(t, len(limited) <= maxEmailLength)
+	assert.True(t, utf8.ValidString(limited))
+	assert.True(t, strings.HasSuffix(limited, "@example.org"))
+	long = "alice@" + strings.Repeat("é", 150)
+	limited = limitEmail(long)
+	assert.True(t, len(limited) <= maxEmailLength)
+	assert.True(t, utf8.ValidString(limited))
+}
+
+func TestTruncateWithHashMultiByte(t *testing.T) {
+	for _, s := range []string{strings.Repeat("é", 300), strings.Repeat("日本", 100), "a" + strings.Repeat("🐳", 100)} {
+		for _, max := range []int{maxUsernameLength, maxEmailLocalPartLength, hashSuffixLength} {
+			limited := truncateWithHash(s, max)
+			assert.True(t, len(limited) <= max, "%q %d", limited, max)
+			assert.True(t, utf8.ValidString(limited), "%q %d", limited, max)
+			assert.Equal(t, limited, truncateWithHash(s, max))
+		}
+	}
+
+	email := emailAddress(&models.User{Username: strings.Repeat("é", 100)}, defaultEmailDomain)
+	assert.True(t, utf8.ValidString(email))
+}
+
+func TestEmailAddressLocalPart(t *testing.T) {
+	assert.Equal(t, "alice@rackspace-mk8s.invalid", emailAddress(&models.User{Username: "alice"}, defaultEmailDomain))
+
+	long := strings.Repeat("a", 100)
+	email := emailAddress(&models.User{Username: long}, defaultEmailDomain)
+	local := email[:strings.LastIndex(email, "@")]
+	assert.Len(t, local, maxEmailLocalPartLength)
+	assert.True(t, strings.HasPrefix(local, strings.Repeat("a", maxEmailLocalPartLength-hashSuffixLength)))
+	assert.Equal(t, email, emailAddress(&models.User{Username: long}, defaultEmailDomain), "truncation must be deterministic")
+
+	other := emailAddress(&models.User{Username: long + "b"}, defaultEmailDomain)
+	assert.NotEqual(t, email, other, "long usernames sharing a prefix must not collide")
+}
+
+func TestResolveLongUsername(t *testing.T) {
+	store := &fakeStore{}
+	r := &UserResolver{Store: store}
+	long := strings.Repeat("a", 300)
+
+	user, err := r.Resolve(Identity{Username: long, UID: "uid-long"})
+	assert.Nil(t, err)
+	assert.Len(t, user.Username, maxUsernameLength)
+	assert.True(t, len(user.Email) <= maxEmailLength)
+
+	// the next login finds the same user
+	again, err := r.Resolve(Identity{Username: long, UID: "uid-long"})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, again.UserID)
+	assert.Equal(t, 1, store.registers)
+}
+
+func TestLimitExtra(t *testing.T) {
+	small := Identity{Username: "alice", Extra: map[string][]string{"scopes": {"read", "write"}}}
+	assert.Equal(t, small.Extra, extraLimit{keys: 1, bytes: 100}.limitExtra(small))
+	assert.Equal(t, small.Extra, extraLimit{}.limitExtra(small), "0 means no limit")
+
+	oversized := Identity{Username: "alice", Extra: map[string][]string{}}
+	for i := 0; i < 1000; i++ {
+		oversized.Extra[fmt.Sprintf("key-%04d", i)] = []string{strings.Repeat("v", 1000)}
+	}
+
+	limited := extraLimit{keys: 10, bytes: defaultMaxExtraBytes}.limitExtra(oversized)
+	assert.Len(t, limited, 10)
+	assert.Contains(t, limited, "key-0000", "the first keys in sorted order are kept")
+	assert.NotContains(t, limited, "key-0010")
+
+	limited = extraLimit{keys: defaultMaxExtraKeys, bytes: 2500}.limitExtra(oversized)
+	size := 0
+	for key, values := range limited {
+		size += len(key)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	assert.True(t, size <= 2500, "kept %d bytes", size)
+	assert.Equal(t, []string{strings.Repeat("v", 1000)}, limited["key-0001"])
+	assert.Len(t, limited, 2, "the keys from the first value which doesn't fit are dropped")
+}
+
+func TestExtraLimits(t *testing.T) {
+	l, err := extraLimits()
+	assert.Nil(t, err)
+	assert.Equal(t, extraLimit{keys: defaultMaxExtraKeys, bytes: defaultMaxExtraBytes}, l)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_MAX_EXTRA_KEYS": "-1"})()
+	_, err = extraLimits()
+	assert.NotNil(t, err)
+}
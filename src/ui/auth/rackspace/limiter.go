@@ -0,0 +1,62 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"time"
+)
+
+// inflightLimiter is a semaphore bounding the number of outstanding requests to kubernetes-auth.
+// A nil limiter never blocks.
+type inflightLimiter chan struct{}
+
+// newInflightLimiter returns a limiter allowing max concurrent requests, or nil (unlimited) if max <= 0
+func newInflightLimiter(max int) inflightLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return make(inflightLimiter, max)
+}
+
+// acquire waits up to timeout for a free slot and returns ErrOverloaded if none became available
+func (l inflightLimiter) acquire(timeout time.Duration) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	default:
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-t.C:
+		return ErrOverloaded
+	}
+}
+
+// release frees a slot taken by acquire
+func (l inflightLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l
+}
@@ -0,0 +1,82 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestMaxInflight(t *testing.T) {
+	var current, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"apiVersion":"authentication.k8s.io/v1","kind":"TokenReview","status":{"authenticated":true}}`))
+	}))
+	defer server.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":          server.URL,
+		"RACKSPACE_MK8S_AUTH_MAX_INFLIGHT": "2",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, peak <= 2, "expected at most 2 concurrent requests, got %d", peak)
+}
+
+func TestInflightLimiterOverloaded(t *testing.T) {
+	l := newInflightLimiter(1)
+	assert.Nil(t, l.acquire(time.Second))
+
+	start := time.Now()
+	assert.Equal(t, ErrOverloaded, l.acquire(50*time.Millisecond))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	l.release()
+	assert.Nil(t, l.acquire(time.Second))
+
+	// unlimited by default
+	var unlimited inflightLimiter
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, unlimited.acquire(0))
+	}
+}
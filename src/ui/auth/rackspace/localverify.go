@@ -0,0 +1,250 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// localClaims are the claims of the JWTs verified locally
+type localClaims struct {
+	jwt.StandardClaims
+	Username string   `json:"preferred_username"`
+	Groups   []string `json:"groups"`
+}
+
+// defaultRevocationCheck is how long a locally verified token is trusted before the backend is
+// asked again whether it was revoked
+const defaultRevocationCheck = 5 * time.Minute
+
+// localVerifier verifies JWT tokens against the signing key without contacting the backend.
+// A nil verifier, or one without a key, leaves every token to the backend.
+// A signature can't tell whether the token was revoked, so the backend is asked the first time
+// a token is verified locally and again once revocationCheck has passed, keyed by its jti claim
+// or the token itself. With a zero revocationCheck it's never asked, and revoked tokens are
+// accepted until they expire.
+type localVerifier struct {
+	issuer          string
+	revocationCheck time.Duration
+	now             func() time.Time
+
+	mu  sync.RWMutex
+	key models.OAuthSigningKey
+
+	checkedMu sync.Mutex
+	// checked maps the key of each token to when the backend last authenticated it
+	checked map[string]revocationCheck
+}
+
+// localToken is a token verified locally
+type localToken struct {
+	id      Identity
+	key     string
+	expires time.Time
+}
+
+// revocationCheck is when the backend last authenticated a locally verified token, and when the token expires
+type revocationCheck struct {
+	at      time.Time
+	expires time.Time
+}
+
+// localVerification returns the local verifier when RACKSPACE_MK8S_AUTH_LOCAL_VERIFY is set, which
+// requires the expected issuer in RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_ISSUER, or nil. The interval of
+// the revocation checks is RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_REVOCATION_CHECK.
+func localVerification() (*localVerifier, error) {
+	const (
+		issuerEnvVar = "RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_ISSUER"
+		checkEnvVar  = "RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_REVOCATION_CHECK"
+	)
+
+	on, err := envBool("RACKSPACE_MK8S_AUTH_LOCAL_VERIFY", false)
+	if err != nil || !on {
+		return nil, err
+	}
+
+	issuer := envOrDefault(issuerEnvVar, "")
+	if issuer == "" {
+		return nil, fmt.Errorf("The env var %s is required when RACKSPACE_MK8S_AUTH_LOCAL_VERIFY is set", issuerEnvVar)
+	}
+
+	check, err := envDuration(checkEnvVar, defaultRevocationCheck)
+	if err != nil {
+		return nil, err
+	}
+	if check < 0 {
+		return nil, fmt.Errorf("The env var %s is not a valid interval, expected 0 or more", checkEnvVar)
+	}
+	if check == 0 {
+		log.Warningf("%s is 0, the locally verified tokens revoked before they expire are accepted until they expire", checkEnvVar)
+	}
+
+	return &localVerifier{
+		issuer:          issuer,
+		revocationCheck: check,
+		now:             time.Now,
+		checked:         make(map[string]revocationCheck),
+	}, nil
+}
+
+// RegisterSigningKey sets the key the registered authenticator verifies JWT tokens against when
+// local verification is on, e.g. the SigningKey of the OAuth settings. HS256 keys are []byte and
+// RS256 keys *rsa.PublicKey. It can be called again when the key rotates.
+func RegisterSigningKey(key models.OAuthSigningKey) error {
+	if registered == nil {
+		return nil
+	}
+	v := registered.localVerifier
+	if v == nil {
+		return nil
+	}
+	if err := checkSigningKey(key); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.key = key
+	return nil
+}
+
+func checkSigningKey(key models.OAuthSigningKey) error {
+	switch key.Type {
+	case jwt.SigningMethodHS256.Alg():
+		if k, ok := key.Data.([]byte); !ok || len(k) == 0 {
+			return fmt.Errorf("invalid %s signing key, expected non-empty bytes", key.Type)
+		}
+	case jwt.SigningMethodRS256.Alg():
+		if _, ok := key.Data.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("invalid %s signing key, expected an RSA public key", key.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported signing key type %q, expected %s or %s", key.Type, jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg())
+	}
+	return nil
+}
+
+// verify checks the signature, expiry and issuer of the token in m. It returns a valid token,
+// ErrTokenExpired for an expired one, and neither when the token can't be verified locally, e.g.
+// it's not a JWT, is signed with another key or has no expiry, in which case the backend decides.
+// Tokens revoked before they expire are only caught by the backend, see checkRevocation.
+func (v *localVerifier) verify(m models.AuthModel) (*localToken, error) {
+	if v == nil {
+		return nil, nil
+	}
+	v.mu.RLock()
+	key := v.key
+	v.mu.RUnlock()
+	if key.Type == "" {
+		return nil, nil
+	}
+
+	claims := &localClaims{}
+	_, err := jwt.ParseWithClaims(m.Password, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != key.Type {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key.Data, nil
+	})
+
+	switch {
+	case !claims.VerifyIssuer(v.issuer, true):
+		return nil, nil
+	case err == nil:
+		if claims.ExpiresAt == 0 || claims.Subject == "" || claims.Username == "" {
+			log.Debugf("ProvidedUsername=%s Token is missing the exp, sub or preferred_username claims, falling back to the backend", m.Principal)
+			return nil, nil
+		}
+		t := &localToken{
+			id:      Identity{Username: claims.Username, UID: claims.Subject, Groups: claims.Groups},
+			key:     tokenKey(m.Password),
+			expires: time.Unix(claims.ExpiresAt, 0),
+		}
+		if claims.Audience != "" {
+			t.id.Audiences = []string{claims.Audience}
+		}
+		if claims.Id != "" {
+			t.key = "jti:" + claims.Id
+		}
+		return t, nil
+	case isOnlyExpired(err):
+		log.Debugf("ProvidedUsername=%s UID=%s Token expired at %d", m.Principal, claims.Subject, claims.ExpiresAt)
+		return nil, ErrTokenExpired
+	}
+
+	log.Debugf("ProvidedUsername=%s Token can't be verified locally, falling back to the backend: %v", m.Principal, err)
+	return nil, nil
+}
+
+// isOnlyExpired reports whether err is the validation error of a correctly signed but expired token
+func isOnlyExpired(err error) bool {
+	e, ok := err.(*jwt.ValidationError)
+	return ok && e.Errors == jwt.ValidationErrorExpired
+}
+
+// revocationDue reports whether the backend should be asked whether t was revoked
+func (v *localVerifier) revocationDue(t *localToken) bool {
+	if v.revocationCheck == 0 {
+		return false
+	}
+
+	v.checkedMu.Lock()
+	defer v.checkedMu.Unlock()
+	c, ok := v.checked[t.key]
+	return !ok || v.now().Sub(c.at) >= v.revocationCheck
+}
+
+// authenticated records that the backend authenticated t, dropping the expired tokens
+func (v *localVerifier) authenticated(t *localToken) {
+	v.checkedMu.Lock()
+	defer v.checkedMu.Unlock()
+
+	now := v.now()
+	for key, c := range v.checked {
+		if !now.Before(c.expires) {
+			delete(v.checked, key)
+		}
+	}
+	v.checked[t.key] = revocationCheck{at: now, expires: t.expires}
+}
+
+// checkRevocation returns the identity of the locally verified t, once the backend confirmed it
+// wasn't revoked when that's due. The token is accepted while the backend fails, like the cached ones.
+func (a *Auth) checkRevocation(ctx context.Context, m models.AuthModel, t *localToken) (*Identity, error) {
+	v := a.localVerifier
+	if !v.revocationDue(t) {
+		return &t.id, nil
+	}
+
+	_, err := a.backendIdentity(ctx, m)
+	switch {
+	case err == nil:
+		v.authenticated(t)
+	case isTokenRejection(err):
+		log.Warningf("ProvidedUsername=%s UID=%s The backend rejected the locally verified token, it was revoked", m.Principal, t.id.UID)
+		return nil, err
+	default:
+		log.Warningf("ProvidedUsername=%s UID=%s Failed to check whether the locally verified token was revoked: %v", m.Principal, t.id.UID, err)
+	}
+	return &t.id, nil
+}
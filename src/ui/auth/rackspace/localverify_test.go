@@ -0,0 +1,175 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+var testSigningKey = models.OAuthSigningKey{Type: "HS256", Data: []byte("local-signing-key")}
+
+func signedToken(t *testing.T, key []byte, claims localClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	assert.Nil(t, err)
+	return token
+}
+
+func testClaims(expiresIn time.Duration) localClaims {
+	return localClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "https://auth.mk8s.local",
+			Subject:   "uid-alice",
+			ExpiresAt: time.Now().Add(expiresIn).Unix(),
+		},
+		Username: "alice",
+		Groups:   []string{"devs"},
+	}
+}
+
+func newLocalVerifyAuth(t *testing.T, fb *fakeBackend) *Auth {
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                           fb.URL,
+		"RACKSPACE_MK8S_AUTH_LOCAL_VERIFY":                  "true",
+		"RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_ISSUER":           "https://auth.mk8s.local",
+		"RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_REVOCATION_CHECK": "0",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	a.localVerifier.key = testSigningKey
+	return a
+}
+
+func TestAuthenticateLocallyValid(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	a := newLocalVerifyAuth(t, fb)
+
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: signedToken(t, testSigningKey.Data.([]byte), testClaims(time.Hour))})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "uid-alice", user.ExternalID)
+	assert.Equal(t, 0, fb.requests)
+}
+
+func TestAuthenticateLocallyRevoked(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	a := newLocalVerifyAuth(t, fb)
+	a.localVerifier.revocationCheck = defaultRevocationCheck
+	clock := &fakeClock{t: time.Now()}
+	a.localVerifier.now = clock.now
+	m := models.AuthModel{Principal: "alice", Password: signedToken(t, testSigningKey.Data.([]byte), testClaims(time.Hour))}
+
+	// the backend is asked whether the token was revoked the first time it's verified locally
+	_, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fb.requests)
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fb.requests)
+
+	// and again once the interval has passed, a failing backend doesn't reject it
+	clock.t = clock.t.Add(defaultRevocationCheck)
+	fb.status = http.StatusServiceUnavailable
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fb.requests)
+
+	// but a revoked token is rejected
+	fb.status = 0
+	fb.response.Status.Authenticated = false
+	_, err = a.Authenticate(m)
+	assert.Equal(t, ErrNotAuthenticated, err)
+	assert.Equal(t, 3, fb.requests)
+}
+
+func TestAuthenticateLocallyExpired(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	a := newLocalVerifyAuth(t, fb)
+
+	_, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: signedToken(t, testSigningKey.Data.([]byte), testClaims(-time.Minute))})
+	assert.Equal(t, ErrTokenExpired, err)
+	assert.Equal(t, 0, fb.requests)
+}
+
+func TestAuthenticateLocalVerifyFallback(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	a := newLocalVerifyAuth(t, fb)
+
+	otherIssuer := testClaims(time.Hour)
+	otherIssuer.Issuer = "https://other.local"
+	noExpiry := testClaims(time.Hour)
+	noExpiry.ExpiresAt = 0
+
+	cases := map[string]string{
+		"not a JWT":          "opaque-token",
+		"other key":          signedToken(t, []byte("other-key"), testClaims(time.Hour)),
+		"expired, other key": signedToken(t, []byte("other-key"), testClaims(-time.Minute)),
+		"other issuer":       signedToken(t, testSigningKey.Data.([]byte), otherIssuer),
+		"no expiry":          signedToken(t, testSigningKey.Data.([]byte), noExpiry),
+	}
+	for name, token := range cases {
+		requests := fb.requests
+		_, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: token})
+		assert.Nil(t, err, name)
+		assert.Equal(t, requests+1, fb.requests, name)
+	}
+
+	// without a key every token goes to the backend
+	a.localVerifier.key = models.OAuthSigningKey{}
+	_, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: signedToken(t, testSigningKey.Data.([]byte), testClaims(-time.Minute))})
+	assert.Nil(t, err)
+}
+
+func TestLocalVerification(t *testing.T) {
+	v, err := localVerification()
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_LOCAL_VERIFY": "true"})()
+	_, err = localVerification()
+	assert.NotNil(t, err)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_ISSUER": "https://auth.mk8s.local"})()
+	v, err = localVerification()
+	assert.Nil(t, err)
+	assert.Equal(t, defaultRevocationCheck, v.revocationCheck)
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_LOCAL_VERIFY_REVOCATION_CHECK": "-1m"})()
+	_, err = localVerification()
+	assert.NotNil(t, err)
+
+	assert.Nil(t, checkSigningKey(testSigningKey))
+	assert.NotNil(t, checkSigningKey(models.OAuthSigningKey{Type: "HS256", Data: []byte{}}))
+	assert.NotNil(t, checkSigningKey(models.OAuthSigningKey{Type: "RS256", Data: []byte("key")}))
+	assert.NotNil(t, checkSigningKey(models.OAuthSigningKey{Type: "none"}))
+}
+
+func TestRegisterWithoutAuthenticator(t *testing.T) {
+	defer func(a *Auth) { registered = a }(registered)
+
+	registered = nil
+	assert.Nil(t, RegisterSigningKey(models.OAuthSigningKey{}))
+	RegisterOnboardHook(func(*models.User) error { return nil })
+}
@@ -0,0 +1,67 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+// loginSampler publishes a LoginSucceededTopic notification for one in every `every` successful
+// logins, e.g. for a SIEM, keeping the volume manageable on busy registries. The first login is always
+// published. A nil sampler publishes nothing.
+type loginSampler struct {
+	every int64
+	n     int64
+}
+
+// loginEventSampling returns the sampler of RACKSPACE_MK8S_AUTH_LOGIN_EVENT_SAMPLING, publishing one
+// in that many logins, every login by default. It's nil when the sampling is 0.
+func loginEventSampling() (*loginSampler, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_LOGIN_EVENT_SAMPLING"
+
+	every, err := envInt(envVar, 1)
+	if err != nil {
+		return nil, err
+	}
+	if every < 0 {
+		return nil, fmt.Errorf("The env var %s is not a valid sampling, expected 0 to disable the events or a positive number", envVar)
+	}
+	if every == 0 {
+		return nil, nil
+	}
+	return &loginSampler{every: int64(every)}, nil
+}
+
+// emit publishes the successful login of user when it's sampled
+func (s *loginSampler) emit(r *UserResolver, m models.AuthModel, user *models.User, cacheHit bool) {
+	if s == nil || (atomic.AddInt64(&s.n, 1)-1)%s.every != 0 {
+		return
+	}
+
+	n := notifier.LoginSucceededNotification{
+		UserID:   user.UserID,
+		Username: user.Username,
+		UID:      userUID(user),
+		CacheHit: cacheHit,
+	}
+	if m.Metadata != nil {
+		n.ClientIP, n.UserAgent = m.Metadata.ClientIP, m.Metadata.UserAgent
+	}
+	r.notify(notifier.LoginSucceededTopic, n)
+}
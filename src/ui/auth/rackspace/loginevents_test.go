@@ -0,0 +1,107 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
+)
+
+// loginEvents returns the login notifications captured by rec
+func loginEvents(rec *recorder) []notifier.LoginSucceededNotification {
+	var result []notifier.LoginSucceededNotification
+	for _, n := range rec.notifications {
+		if n.topic == notifier.LoginSucceededTopic {
+			result = append(result, n.value.(notifier.LoginSucceededNotification))
+		}
+	}
+	return result
+}
+
+func TestAuthenticateLoginEvents(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":       fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	rec := &recorder{}
+	a.resolver.Store = &fakeStore{}
+	a.resolver.publish = rec.publish
+
+	m := models.AuthModel{
+		Principal: "alice",
+		Password:  "token",
+		Metadata:  &models.RequestMetadata{ClientIP: "10.0.0.1", UserAgent: "docker/17.06"},
+	}
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+
+	expected := notifier.LoginSucceededNotification{
+		UserID:    1,
+		Username:  "alice",
+		UID:       "uid-alice",
+		ClientIP:  "10.0.0.1",
+		UserAgent: "docker/17.06",
+	}
+	cached := expected
+	cached.CacheHit = true
+	assert.Equal(t, []notifier.LoginSucceededNotification{expected, cached}, loginEvents(rec))
+	assert.NotContains(t, fmt.Sprintf("%+v", rec.notifications), "token")
+
+	// failed logins aren't published
+	fb.status = 401
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "other-token"})
+	assert.NotNil(t, err)
+	assert.Len(t, loginEvents(rec), 2)
+}
+
+func TestLoginEventSampling(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_LOGIN_EVENT_SAMPLING": "3"})()
+	s, err := loginEventSampling()
+	assert.Nil(t, err)
+
+	rec := &recorder{}
+	r := &UserResolver{publish: rec.publish}
+	for i := 0; i < 7; i++ {
+		s.emit(r, models.AuthModel{}, &models.User{UserID: i + 1}, false)
+	}
+	// the 1st, 4th and 7th logins
+	events := loginEvents(rec)
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, []int{1, 4, 7}, []int{events[0].UserID, events[1].UserID, events[2].UserID})
+	}
+
+	// 0 disables the events
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_LOGIN_EVENT_SAMPLING": "0"})()
+	s, err = loginEventSampling()
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+	s.emit(r, models.AuthModel{}, &models.User{}, false)
+	assert.Len(t, loginEvents(rec), 3)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_LOGIN_EVENT_SAMPLING": "-1"})()
+	_, err = loginEventSampling()
+	assert.NotNil(t, err)
+}
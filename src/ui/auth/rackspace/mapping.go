@@ -0,0 +1,147 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fields of AuthResponse which can be remapped, with their standard TokenReview paths
+var mappableFields = map[string]string{
+	"authenticated": "status.authenticated",
+	"username":      "status.user.username",
+	"uid":           "status.user.uid",
+	"groups":        "status.user.groups",
+	"extra":         "status.user.extra",
+}
+
+// fieldMapping locates AuthResponse fields in the responses of backends which don't follow the
+// TokenReview contract, e.g. "username=status.user.name,uid=status.user.id". Each field maps to
+// a dotted path of JSON object keys. Fields that aren't mapped are read from their standard path.
+type fieldMapping map[string][]string
+
+// responseFieldMapping returns the configured field mapping, or nil to use the standard contract
+func responseFieldMapping() (fieldMapping, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_FIELD_MAPPING"
+
+	return parseFieldMapping(os.Getenv(envVar))
+}
+
+func parseFieldMapping(s string) (fieldMapping, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	fm := fieldMapping{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid field mapping %q, expected field=path", pair)
+		}
+
+		field, path := strings.TrimSpace(kv[0]), strings.Split(strings.TrimSpace(kv[1]), ".")
+		if _, ok := mappableFields[field]; !ok {
+			return nil, fmt.Errorf("invalid field mapping %q, unknown field %q", pair, field)
+		}
+		if _, dup := fm[field]; dup {
+			return nil, fmt.Errorf("invalid field mapping %q, field %q is mapped twice", pair, field)
+		}
+		for _, key := range path {
+			if key == "" {
+				return nil, fmt.Errorf("invalid field mapping %q, empty key in path", pair)
+			}
+		}
+
+		fm[field] = path
+	}
+
+	return fm, nil
+}
+
+// apply reads the mapped fields of body into resp
+func (fm fieldMapping) apply(body []byte, resp *AuthResponse) error {
+	if len(fm) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return err
+	}
+
+	for field, path := range fm {
+		raw, ok := lookupPath(doc, path)
+		if !ok {
+			continue
+		}
+
+		// round trip the value through JSON to get the field's Go type
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+
+		user := &resp.Status.User
+		switch field {
+		case "authenticated":
+			err = json.Unmarshal(b, &resp.Status.Authenticated)
+		case "username":
+			err = json.Unmarshal(b, &user.Username)
+		case "uid":
+			err = json.Unmarshal(b, &user.UID)
+		case "groups":
+			err = json.Unmarshal(b, &user.Groups)
+		case "extra":
+			err = json.Unmarshal(b, &user.Extra)
+		}
+		if err != nil {
+			return fmt.Errorf("mapped field %s at %s: %v", field, strings.Join(path, "."), err)
+		}
+	}
+
+	return nil
+}
+
+// lookupPath walks the JSON objects in doc along path
+func lookupPath(doc interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// withUsernameClaim returns the username of id, or, when claim is set, the first value of its
+// Extra claim, e.g. "preferred_username" for backends whose top-level username isn't the one
+// people know. The top-level username is kept when the claim is missing or empty.
+func withUsernameClaim(id Identity, claim string) string {
+	if claim == "" {
+		return id.Username
+	}
+	for _, v := range id.Extra[claim] {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return id.Username
+}
@@ -0,0 +1,137 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestParseFieldMapping(t *testing.T) {
+	fm, err := parseFieldMapping("")
+	assert.Nil(t, err)
+	assert.Nil(t, fm)
+
+	fm, err = parseFieldMapping("username=status.user.name, uid=status.user.id")
+	assert.Nil(t, err)
+	assert.Equal(t, fieldMapping{
+		"username": {"status", "user", "name"},
+		"uid":      {"status", "user", "id"},
+	}, fm)
+
+	for _, invalid := range []string{
+		"username",
+		"nickname=status.user.nick",
+		"username=status..name",
+		"username=a,username=b",
+	} {
+		_, err = parseFieldMapping(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestReviewStandardFields(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	fb.rawBody = []byte(`{"apiVersion":"authentication.k8s.io/v1","kind":"TokenReview","status":{"authenticated":true,"user":{"username":"alice","uid":"1","groups":["dev"]}}}`)
+	resp, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{Username: "alice", UID: "1", Groups: []string{"dev"}}, resp.identity())
+	assert.True(t, resp.Status.Authenticated)
+}
+
+func TestReviewRemappedFields(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":           fb.URL,
+		"RACKSPACE_MK8S_AUTH_FIELD_MAPPING": "authenticated=result.ok,username=result.account.name,uid=result.account.id,groups=result.teams",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	fb.rawBody = []byte(`{"apiVersion":"authentication.k8s.io/v1","kind":"TokenReview","result":{"ok":true,"account":{"name":"alice","id":"1"},"teams":["dev","ops"]}}`)
+	resp, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{Username: "alice", UID: "1", Groups: []string{"dev", "ops"}}, resp.identity())
+	assert.True(t, resp.Status.Authenticated)
+
+	// a mapped path holding the wrong type is an error
+	fb.rawBody = []byte(`{"result":{"account":{"name":42}}}`)
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.NotNil(t, err)
+}
+
+func TestSetupInvalidFieldMapping(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_FIELD_MAPPING": "nickname=a.b"})()
+
+	_, err := setupAuth()
+	assert.NotNil(t, err)
+}
+
+func TestWithUsernameClaim(t *testing.T) {
+	id := Identity{Username: "u-12345", Extra: map[string][]string{"preferred_username": {" ", "alice"}}}
+	assert.Equal(t, "alice", withUsernameClaim(id, "preferred_username"))
+	assert.Equal(t, "u-12345", withUsernameClaim(id, ""))
+	assert.Equal(t, "u-12345", withUsernameClaim(id, "email"))
+	assert.Equal(t, "u-12345", withUsernameClaim(Identity{Username: "u-12345"}, "preferred_username"))
+}
+
+func TestAuthenticateUsernameClaim(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":             fb.URL,
+		"RACKSPACE_MK8S_AUTH_USERNAME_CLAIM":  "preferred_username",
+		"RACKSPACE_MK8S_AUTH_USERNAME_PREFIX": "mk8s:",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Contains(t, configSummary(a), "usernameClaim=preferred_username")
+	store := &fakeStore{}
+	a.resolver.Store = store
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	fb.response.Status.User.Username = "u-12345"
+	fb.response.Status.User.Extra = map[string][]string{"preferred_username": {"alice"}}
+	user, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, "mk8s:alice", user.Username)
+	assert.Equal(t, "mk8s:alice@rackspace-mk8s.invalid", user.Email)
+
+	// a renamed claim renames the same user
+	fb.response.Status.User.Extra = map[string][]string{"preferred_username": {"alice.smith"}}
+	renamed, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, renamed.UserID)
+	assert.Equal(t, "mk8s:alice.smith", renamed.Username)
+
+	// without the claim the top-level username is used
+	fb.response.Status.User.Extra = nil
+	fallback, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, fallback.UserID)
+	assert.Equal(t, "mk8s:u-12345", fallback.Username)
+	assert.Equal(t, 1, store.registers)
+}
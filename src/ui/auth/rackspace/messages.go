@@ -0,0 +1,160 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// backend error conditions which can be given a user-facing message
+const (
+	conditionUnauthorized      = "unauthorized"       // 401 response
+	conditionForbidden         = "forbidden"          // 403 response
+	conditionServerError       = "server_error"       // 5xx response
+	conditionOverloaded        = "overloaded"         // too many requests in flight
+	conditionInvalidSignature  = "invalid_signature"  // response signature mismatch
+	conditionUserDeleted       = "user_deleted"       // the user was deleted in Harbor
+	conditionPrincipalMismatch = "principal_mismatch" // the username doesn't match the token's user
+	conditionInvalidToken      = "invalid_token"      // empty or whitespace-only token
+	conditionBackendProtocol   = "backend_protocol"   // response which isn't a valid TokenReview
+	conditionTooManyAttempts   = "too_many_attempts"  // source IP over the rate limit
+	conditionTokenExpired      = "token_expired"      // locally verified token which has expired
+	conditionAudienceMismatch  = "audience_mismatch"  // token not valid for the configured audiences
+	conditionReservedUsername  = "reserved_username"  // the token's user would be Harbor's admin
+	conditionUnknownService    = "unknown_service"    // client certificate mapped to a missing user
+	conditionUnavailable       = "unavailable"        // the backend couldn't be connected to
+	conditionNotAuthenticated  = "not_authenticated"  // 200 response not authenticating the user
+)
+
+var errorConditions = map[string]bool{
+	conditionUnauthorized:      true,
+	conditionForbidden:         true,
+	conditionServerError:       true,
+	conditionOverloaded:        true,
+	conditionInvalidSignature:  true,
+	conditionUserDeleted:       true,
+	conditionPrincipalMismatch: true,
+	conditionInvalidToken:      true,
+	conditionBackendProtocol:   true,
+	conditionTooManyAttempts:   true,
+	conditionTokenExpired:      true,
+	conditionAudienceMismatch:  true,
+	conditionReservedUsername:  true,
+	conditionUnknownService:    true,
+	conditionUnavailable:       true,
+	conditionNotAuthenticated:  true,
+}
+
+// errorMessages maps backend error conditions to the messages returned to users instead of the
+// raw backend errors, e.g. {"unauthorized": "Your token is invalid or expired"}.
+// Conditions that aren't mapped return the backend error unchanged.
+type errorMessages map[string]string
+
+// authErrorMessages returns the configured error messages, or nil to pass through all errors
+func authErrorMessages() (errorMessages, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_ERROR_MESSAGES"
+
+	return parseErrorMessages(os.Getenv(envVar))
+}
+
+func parseErrorMessages(s string) (errorMessages, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	em := errorMessages{}
+	if err := json.Unmarshal([]byte(s), &em); err != nil {
+		return nil, fmt.Errorf("invalid error messages, expected a JSON object of condition to message: %v", err)
+	}
+	for condition := range em {
+		if !errorConditions[condition] {
+			return nil, fmt.Errorf("invalid error messages, unknown condition %q", condition)
+		}
+	}
+
+	return em, nil
+}
+
+// errorCondition returns the condition of a backend error, or "" if it's not a known one
+func errorCondition(err error) string {
+	if e, ok := err.(*BackendUnavailableError); ok {
+		err = e.Err
+	}
+	if _, ok := err.(*BackendConnectionError); ok {
+		return conditionUnavailable
+	}
+	if e, ok := err.(*statusError); ok {
+		switch {
+		case e.code == http.StatusUnauthorized:
+			return conditionUnauthorized
+		case e.code == http.StatusForbidden:
+			return conditionForbidden
+		case e.code >= http.StatusInternalServerError:
+			return conditionServerError
+		}
+	}
+
+	if _, ok := err.(*BackendProtocolError); ok {
+		return conditionBackendProtocol
+	}
+	if _, ok := err.(*TooManyAttemptsError); ok {
+		return conditionTooManyAttempts
+	}
+
+	switch err {
+	case ErrOverloaded:
+		return conditionOverloaded
+	case ErrInvalidSignature:
+		return conditionInvalidSignature
+	case ErrUserDeleted:
+		return conditionUserDeleted
+	case ErrPrincipalMismatch:
+		return conditionPrincipalMismatch
+	case ErrInvalidToken:
+		return conditionInvalidToken
+	case ErrTokenExpired:
+		return conditionTokenExpired
+	case ErrAudienceMismatch:
+		return conditionAudienceMismatch
+	case ErrReservedUsername:
+		return conditionReservedUsername
+	case ErrUnknownServiceAccount:
+		return conditionUnknownService
+	case ErrNotAuthenticated:
+		return conditionNotAuthenticated
+	}
+	return ""
+}
+
+// translate returns the configured message for the condition of err, logging the original error,
+// or err itself when its condition isn't mapped
+func (em errorMessages) translate(m models.AuthModel, err error) error {
+	condition := errorCondition(err)
+	message, ok := em[condition]
+	if condition == "" || !ok {
+		return err
+	}
+
+	log.Errorf("ProvidedUsername=%s Replacing %s auth error with configured message: %v", m.Principal, condition, err)
+	return errors.New(message)
+}
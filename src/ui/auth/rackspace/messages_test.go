@@ -0,0 +1,70 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+func TestParseErrorMessages(t *testing.T) {
+	em, err := parseErrorMessages("")
+	assert.Nil(t, err)
+	assert.Nil(t, em)
+
+	em, err = parseErrorMessages(`{"unauthorized": "Your token is invalid or expired, please log in again"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, errorMessages{conditionUnauthorized: "Your token is invalid or expired, please log in again"}, em)
+
+	_, err = parseErrorMessages(`{"teapot": "I'm a teapot"}`)
+	assert.NotNil(t, err)
+	_, err = parseErrorMessages(`unauthorized=nope`)
+	assert.NotNil(t, err)
+}
+
+func TestAuthenticateErrorMessages(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":            fb.URL,
+		"RACKSPACE_MK8S_AUTH_ERROR_MESSAGES": `{"unauthorized": "Your token is invalid or expired"}`,
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stdout)
+
+	// a mapped condition returns the configured message and logs the original error
+	fb.status = http.StatusUnauthorized
+	fb.rawBody = []byte(`token expired at 12:00`)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.EqualError(t, err, "Your token is invalid or expired")
+	assert.Contains(t, logged.String(), "HTTPStatusCode=401 AuthResponseBody=token expired at 12:00")
+
+	// other conditions pass the backend error through
+	fb.status = http.StatusForbidden
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "other-token"})
+	assert.EqualError(t, err, "HTTPStatusCode=403 AuthResponseBody=token expired at 12:00")
+}
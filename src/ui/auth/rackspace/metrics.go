@@ -0,0 +1,143 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// outcomes of a backend request used as the "outcome" metric label
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	outcomeError   = "error"
+)
+
+// otherEndpoint is the endpoint label used for any host outside the configured set
+const otherEndpoint = "other"
+
+// RequestLabels identifies a backend request counter
+type RequestLabels struct {
+	// Endpoint is the host (and port) of the backend that served the request
+	Endpoint string
+	// Outcome is one of "success", "failure" (non-200 response) or "error" (transport error)
+	Outcome string
+}
+
+// Stats is a point-in-time snapshot of the authenticator's metrics
+type Stats struct {
+	Requests map[RequestLabels]int64
+	// CacheTTL is the effective cache TTL, zero when caching is disabled
+	CacheTTL time.Duration
+	// CacheEntries is the number of users in the cache
+	CacheEntries int
+	// CacheBytes is an estimate of the memory used by the cached users
+	CacheBytes int64
+	// CacheEvictions counts the entries evicted from the cache by reason: "expired", "capacity"
+	// or "invalidated"
+	CacheEvictions map[string]int64
+	// ResponseVersions counts the backend's responses by version
+	ResponseVersions map[ResponseVersion]int64
+	// RetryBudget is the number of retries the retry budget currently allows
+	RetryBudget float64
+	// SLOLatency is the latency objective of the backend requests, zero when none is set
+	SLOLatency time.Duration
+	// SLOViolations counts the backend requests slower than SLOLatency, a cheap signal for the
+	// fraction of slow auths alongside Requests
+	SLOViolations int64
+}
+
+// metrics holds the authenticator's counters. Endpoint labels are limited to the
+// hosts of the configured backend URLs to keep the label cardinality bounded.
+type metrics struct {
+	sync.Mutex
+	hosts    map[string]bool
+	requests map[RequestLabels]int64
+	// sloLatency, when positive, is the latency beyond which a request violates the SLO
+	sloLatency    time.Duration
+	sloViolations int64
+}
+
+func newMetrics(backendURLs ...string) *metrics {
+	m := &metrics{
+		hosts:    make(map[string]bool),
+		requests: make(map[RequestLabels]int64),
+	}
+	for _, u := range backendURLs {
+		m.hosts[endpointHost(u)] = true
+	}
+	return m
+}
+
+// endpointHost returns the host of rawURL without scheme, credentials, path or query
+func endpointHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// endpointLabel returns the endpoint label for rawURL, collapsing unknown hosts into "other"
+func (m *metrics) endpointLabel(rawURL string) string {
+	host := endpointHost(rawURL)
+	if !m.hosts[host] {
+		return otherEndpoint
+	}
+	return host
+}
+
+func (m *metrics) incRequest(rawURL, outcome string) {
+	m.Lock()
+	defer m.Unlock()
+	m.requests[RequestLabels{Endpoint: m.endpointLabel(rawURL), Outcome: outcome}]++
+}
+
+// observeLatency counts the request as an SLO violation when it took longer than the SLO latency
+func (m *metrics) observeLatency(d time.Duration) {
+	if m.sloLatency <= 0 || d <= m.sloLatency {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.sloViolations++
+}
+
+func (m *metrics) snapshot() Stats {
+	m.Lock()
+	defer m.Unlock()
+	s := Stats{
+		Requests:      make(map[RequestLabels]int64, len(m.requests)),
+		SLOLatency:    m.sloLatency,
+		SLOViolations: m.sloViolations,
+	}
+	for k, v := range m.requests {
+		s.Requests[k] = v
+	}
+	return s
+}
+
+// Stats returns a snapshot of the authenticator's metrics
+func (a *Auth) Stats() Stats {
+	s := a.metrics.snapshot()
+	s.CacheTTL = a.cache.effectiveTTL()
+	s.CacheEntries, s.CacheBytes = a.cache.size()
+	s.CacheEvictions = a.cache.evictionCounts()
+	s.RetryBudget = a.retryBudget.remaining()
+	s.ResponseVersions = a.versions.snapshot()
+	return s
+}
@@ -0,0 +1,117 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultNegativeTTL is how long a token rejected by the backend is rejected without asking it again
+const defaultNegativeTTL = 5 * time.Second
+
+// maxNegativeEntries bounds the memory of the negative cache, which anyone can fill with made up tokens
+const maxNegativeEntries = 10000
+
+// negativeEntry is a token rejected by the backend
+type negativeEntry struct {
+	err     error
+	expires time.Time
+}
+
+// negativeCache remembers the tokens the backend rejected for a short TTL, so that a client
+// retrying an invalid token in a loop fails fast without a backend call each time. Entries are
+// keyed by the hash of the token, like the userCache's. A nil cache is disabled.
+type negativeCache struct {
+	sync.Mutex
+	entries map[string]negativeEntry
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// newNegativeCache returns a cache using ttl, or nil (disabled) if ttl is zero
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{
+		entries: make(map[string]negativeEntry),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// negativeTTL returns RACKSPACE_MK8S_AUTH_NEGATIVE_TTL, zero disabling the negative cache
+func negativeTTL() (time.Duration, error) {
+	return envDuration("RACKSPACE_MK8S_AUTH_NEGATIVE_TTL", defaultNegativeTTL)
+}
+
+// get returns the error the backend rejected token with if it did within the TTL, nil otherwise
+func (c *negativeCache) get(token string) error {
+	if c == nil {
+		return nil
+	}
+
+	key := tokenKey(token)
+
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e.err
+}
+
+// put remembers that the backend rejected token with err. Only the rejections of the token
+// itself are cached, not the errors of an unavailable or misbehaving backend.
+func (c *negativeCache) put(token string, err error) {
+	if c == nil || !isTokenRejection(err) {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxNegativeEntries {
+		for key, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxNegativeEntries {
+			return
+		}
+	}
+	c.entries[tokenKey(token)] = negativeEntry{err: err, expires: now.Add(c.ttl)}
+}
+
+// isTokenRejection reports whether err is the backend rejecting the token, either with a 401 or 403
+// or with a TokenReview that doesn't authenticate it
+func isTokenRejection(err error) bool {
+	if errors.Is(err, ErrNotAuthenticated) {
+		return true
+	}
+	var e *statusError
+	return errors.As(err, &e) && (e.code == http.StatusUnauthorized || e.code == http.StatusForbidden)
+}
@@ -0,0 +1,118 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestAuthenticateNegativeCacheHit(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.negativeCache.now = clock.now
+
+	fb.status = http.StatusUnauthorized
+	_, first := a.Authenticate(models.AuthModel{Principal: "alice", Password: "expired-token"})
+	assert.NotNil(t, first)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "expired-token"})
+	assert.Equal(t, first, err)
+	assert.Equal(t, 1, fb.requests)
+
+	// a new valid token isn't affected
+	fb.status = 0
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "new-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fb.requests)
+
+	// the rejected token is sent to the backend again once the TTL has passed
+	clock.t = clock.t.Add(defaultNegativeTTL)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "expired-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fb.requests)
+}
+
+func TestAuthenticateNegativeCacheMiss(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	// accepted tokens aren't negatively cached
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Nil(t, a.negativeCache.get("token"))
+
+	// neither are the errors of an unavailable backend
+	fb.status = http.StatusServiceUnavailable
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "other-token"})
+	assert.NotNil(t, err)
+	fb.status = 0
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "other-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fb.requests)
+}
+
+func TestNegativeCache(t *testing.T) {
+	ttl, err := negativeTTL()
+	assert.Nil(t, err)
+	assert.Equal(t, defaultNegativeTTL, ttl)
+
+	// disabled with a zero TTL
+	disabled := newNegativeCache(0)
+	assert.Nil(t, disabled)
+	disabled.put("token", &statusError{code: http.StatusUnauthorized})
+	assert.Nil(t, disabled.get("token"))
+
+	c := newNegativeCache(time.Second)
+	c.put("token", errors.New("connection refused"))
+	assert.Nil(t, c.get("token"))
+	c.put("token", &statusError{code: http.StatusForbidden})
+	assert.NotNil(t, c.get("token"))
+	c.put("unauthenticated-token", ErrNotAuthenticated)
+	assert.Equal(t, ErrNotAuthenticated, c.get("unauthenticated-token"))
+}
+
+func TestAuthenticateNegativeCacheNotAuthenticated(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	// a TokenReview refusing the token is cached like a 401
+	fb.response.Status.Authenticated = false
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "revoked-token"})
+	assert.Equal(t, ErrNotAuthenticated, err)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "revoked-token"})
+	assert.Equal(t, ErrNotAuthenticated, err)
+	assert.Equal(t, 1, fb.requests)
+}
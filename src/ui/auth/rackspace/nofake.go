@@ -0,0 +1,29 @@
+//go:build !rackspacefake
+// +build !rackspacefake
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import "errors"
+
+// fakeTransport refuses RACKSPACE_MK8S_AUTH_FAKE, production builds always review tokens with the backend
+func fakeTransport() (transport, error) {
+	on, err := envBool("RACKSPACE_MK8S_AUTH_FAKE", false)
+	if err != nil || !on {
+		return nil, err
+	}
+	return nil, errors.New("RACKSPACE_MK8S_AUTH_FAKE is only supported by builds with the rackspacefake tag")
+}
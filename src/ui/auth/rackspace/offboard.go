@@ -0,0 +1,134 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// offboardGrace lets the Harbor users the backend stopped authenticating, e.g. once they are
+// off-boarded upstream, log in for a grace period so that their in-flight CI jobs aren't cut off.
+// The backend doesn't vouch for the identity of the tokens it refuses, so a refused token is only
+// graced as the identity the backend last authenticated it for, and for the grace period following
+// its last successful login. It's kept in memory only, and a nil offboardGrace rejects them immediately.
+type offboardGrace struct {
+	sync.Mutex
+	grace time.Duration
+	now   func() time.Time
+	// logins maps the token keys to their last successful login
+	logins map[string]offboardLogin
+}
+
+// offboardLogin is the identity the backend authenticated a token for, and when it last logged in
+type offboardLogin struct {
+	id Identity
+	at time.Time
+}
+
+// newOffboardGrace returns the grace of RACKSPACE_MK8S_AUTH_OFFBOARD_GRACE, or nil when it's zero (the default)
+func newOffboardGrace() (*offboardGrace, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_OFFBOARD_GRACE"
+
+	grace, err := envDuration(envVar, 0)
+	if err != nil {
+		return nil, err
+	}
+	if grace < 0 {
+		return nil, fmt.Errorf("The env var %s is not a valid grace period, expected 0 or more", envVar)
+	}
+	if grace == 0 {
+		return nil, nil
+	}
+	return &offboardGrace{grace: grace, now: time.Now, logins: make(map[string]offboardLogin)}, nil
+}
+
+// remember records that the backend authenticated token for id, dropping the logins past their grace period
+func (g *offboardGrace) remember(token string, id Identity) {
+	if g == nil || id.UID == "" {
+		return
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	now := g.now()
+	for key, login := range g.logins {
+		if now.Sub(login.at) >= g.grace {
+			delete(g.logins, key)
+		}
+	}
+	id.Groups = append([]string(nil), id.Groups...)
+	g.logins[tokenKey(token)] = offboardLogin{id: id, at: now}
+}
+
+// seen restarts the grace period of token when it logs in from the cache
+func (g *offboardGrace) seen(token string) {
+	if g == nil {
+		return
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	key := tokenKey(token)
+	if login, ok := g.logins[key]; ok {
+		login.at = g.now()
+		g.logins[key] = login
+	}
+}
+
+// lookup returns the identity the backend last authenticated token for and the remaining grace
+// period of token, when it ever logged in
+func (g *offboardGrace) lookup(token string) (Identity, time.Duration, bool) {
+	g.Lock()
+	defer g.Unlock()
+
+	login, ok := g.logins[tokenKey(token)]
+	if !ok {
+		return Identity{}, 0, false
+	}
+	id := login.id
+	id.Groups = append([]string(nil), id.Groups...)
+	return id, g.grace - g.now().Sub(login.at), true
+}
+
+// offboarded returns the identity the login of m is let through as, when the backend rejected it
+// with err but last authenticated its token for an existing Harbor user still within its grace period
+func (a *Auth) offboarded(m models.AuthModel, err error) (*Identity, bool) {
+	if err != ErrNotAuthenticated || a.offboardGrace == nil {
+		return nil, false
+	}
+
+	id, remaining, ok := a.offboardGrace.lookup(m.Password)
+	if !ok {
+		return nil, false
+	}
+
+	user, lookupErr := a.resolver.lookup(a.resolver.harborIdentity(id))
+	if lookupErr != nil || user == nil {
+		return nil, false
+	}
+
+	if remaining <= 0 {
+		log.Warningf("ProvidedUsername=%s UID=%s BackendUsername=%s is no longer authenticated by the backend and past the off-board grace period, rejecting login", m.Principal, id.UID, id.Username)
+		return nil, false
+	}
+	log.Warningf("ProvidedUsername=%s UID=%s BackendUsername=%s is no longer authenticated by the backend, allowing login for the remaining %v of the off-board grace period", m.Principal, id.UID, id.Username, remaining.Round(time.Second))
+	return &id, true
+}
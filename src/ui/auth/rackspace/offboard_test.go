@@ -0,0 +1,105 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestAuthenticateOffboardGrace(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":            fb.URL,
+		"RACKSPACE_MK8S_AUTH_OFFBOARD_GRACE": "1h",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Contains(t, configSummary(a), "offboardGrace=1h0m0s")
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.offboardGrace.now = clock.now
+	a.negativeCache.now = clock.now
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	user, err := a.Authenticate(m)
+	assert.Nil(t, err)
+
+	// off-boarded upstream, alice can still log in within the grace period of the last login, as the identity it was authenticated for
+	fb.response.Status.Authenticated = false
+	fb.response.Status.User.UID = "uid-mallory"
+	graced, err := a.Authenticate(m)
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, graced.UserID)
+	fb.response.Status.User.UID = "uid-alice"
+	clock.t = clock.t.Add(59 * time.Minute)
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+
+	// and is rejected once it's over
+	clock.t = clock.t.Add(time.Minute)
+	_, err = a.Authenticate(m)
+	assert.Equal(t, ErrNotAuthenticated, err)
+
+	// authenticated again once the rejection is no longer cached, a later off-boarding starts a new grace period
+	clock.t = clock.t.Add(defaultNegativeTTL)
+	fb.response.Status.Authenticated = true
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+	fb.response.Status.Authenticated = false
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+
+	// the identity echoed with a refused token isn't trusted, only the one it was last authenticated for
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token-forged"})
+	assert.Equal(t, ErrNotAuthenticated, err)
+
+	// users who were never onboarded aren't graced
+	fb.response.Status.User.Username = "bob"
+	fb.response.Status.User.UID = "uid-bob"
+	_, err = a.Authenticate(models.AuthModel{Principal: "bob", Password: "token-bob"})
+	assert.Equal(t, ErrNotAuthenticated, err)
+}
+
+func TestAuthenticateOffboardImmediate(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Nil(t, a.offboardGrace)
+	a.resolver.Store = &fakeStore{}
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	_, err = a.Authenticate(m)
+	assert.Nil(t, err)
+
+	fb.response.Status.Authenticated = false
+	_, err = a.Authenticate(m)
+	assert.Equal(t, ErrNotAuthenticated, err)
+	assert.Equal(t, conditionNotAuthenticated, errorCondition(err))
+}
+
+func TestOffboardGracePeriod(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_OFFBOARD_GRACE": "-1m"})()
+	_, err := newOffboardGrace()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,100 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"os"
+	"strings"
+
+	"github.com/vmware/harbor/src/common"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// precreatedGroups returns the canonical names of the groups of RACKSPACE_MK8S_AUTH_PRECREATE_GROUPS,
+// a comma separated list of the backend's group names
+func precreatedGroups() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("RACKSPACE_MK8S_AUTH_PRECREATE_GROUPS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return canonicalGroups(names)
+}
+
+// PrecreateGroups makes sure the groups of RACKSPACE_MK8S_AUTH_PRECREATE_GROUPS exist in Harbor,
+// with their roles of RACKSPACE_MK8S_AUTH_GROUP_ROLES, so that the roles apply from the first login
+// of their members. It must be called once the database is initialized and the group role projects
+// are checked.
+func PrecreateGroups() error {
+	if registered == nil {
+		return nil
+	}
+	return registered.resolver.precreateGroups(precreatedGroups())
+}
+
+// precreateGroups creates the groups which don't exist yet and grants them their roles. The
+// existing groups are left as they are, so restarting doesn't undo the changes made to them in Harbor.
+// The names are normalized like the backend's, so the groups are the ones its users join.
+func (r *UserResolver) precreateGroups(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	if r.Groups == nil {
+		log.Warningf("RACKSPACE_MK8S_AUTH_PRECREATE_GROUPS is set but has no effect unless RACKSPACE_MK8S_AUTH_GROUP_SYNC is enabled")
+		return nil
+	}
+
+	normalized := make([]string, len(names))
+	for i, name := range names {
+		normalized[i] = r.normalizeName(name)
+	}
+	names = canonicalGroups(normalized)
+
+	var created []string
+	for _, name := range names {
+		existing, err := r.Groups.GetGroup(groupIdentifier(name))
+		if err != nil {
+			log.Errorf("Error getting group %s from database: %v", name, err)
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+
+		g := &models.UserGroup{
+			GroupName:   name,
+			GroupType:   common.RackspaceGroupType,
+			LdapGroupDN: groupIdentifier(name),
+		}
+		if err := r.Groups.OnBoardGroup(g); err != nil {
+			log.Errorf("Error creating group %s: %v", name, err)
+			return err
+		}
+		for _, gr := range r.groupRoles[name] {
+			if err := r.Groups.SetProjectRole(g.ID, gr.project, gr.role); err != nil {
+				log.Errorf("Error granting group %s its role in project %s: %v", name, gr.project, err)
+				return err
+			}
+		}
+		created = append(created, name)
+	}
+
+	if len(created) > 0 {
+		log.Infof("Created the groups %v", created)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common"
+)
+
+func TestPrecreatedGroups(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_PRECREATE_GROUPS": " devs, admins,,devs "})()
+	assert.Equal(t, []string{"admins", "devs"}, precreatedGroups())
+}
+
+func TestPrecreateGroups(t *testing.T) {
+	groups := &fakeGroupStore{}
+	r := &UserResolver{
+		Groups: groups,
+		groupRoles: groupRoleMapping{
+			"devs": {{project: "library", role: common.RoleDeveloper}},
+		},
+	}
+
+	assert.Nil(t, r.precreateGroups([]string{"admins", "devs"}))
+	assert.Len(t, groups.groups, 2)
+	assert.Equal(t, []string{"role 2 library 2"}, groups.ops)
+	devs, err := groups.GetGroup(groupIdentifier("devs"))
+	assert.Nil(t, err)
+	assert.Equal(t, "devs", devs.GroupName)
+
+	// restarting neither duplicates the groups nor grants their roles again
+	assert.Nil(t, r.precreateGroups([]string{"admins", "devs"}))
+	assert.Len(t, groups.groups, 2)
+	assert.Equal(t, []string{"role 2 library 2"}, groups.ops)
+
+	// without group sync there's nothing to create
+	assert.Nil(t, (&UserResolver{}).precreateGroups([]string{"devs"}))
+}
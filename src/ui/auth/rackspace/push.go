@@ -0,0 +1,141 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// defaultPushTimeout bounds the final push of the metrics, so a slow push gateway can't hold up
+// the termination of the pod
+const defaultPushTimeout = 2 * time.Second
+
+// metricsPusher pushes the final metrics to a Prometheus push gateway when the authenticator is
+// closed, so the counts since the last scrape aren't lost when a pod terminates. The metrics are
+// pushed at most once. A nil pusher pushes nothing.
+type metricsPusher struct {
+	url     string
+	timeout time.Duration
+	client  *http.Client
+	once    sync.Once
+	// push sends the metrics, replaced in tests
+	push func(ctx context.Context, body []byte) error
+}
+
+// metricsPush returns the configured metrics pusher, or nil if no push gateway is configured
+func metricsPush() (*metricsPusher, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_METRICS_PUSH_URL"
+
+	rawURL := strings.TrimSpace(os.Getenv(envVar))
+	if rawURL == "" {
+		return nil, nil
+	}
+	pushURL, err := normalizeAuthURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("The env var %s is not a valid url: %v", envVar, err)
+	}
+
+	timeout, err := envDuration("RACKSPACE_MK8S_AUTH_METRICS_PUSH_TIMEOUT", defaultPushTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &metricsPusher{url: pushURL, timeout: timeout, client: &http.Client{}}
+	p.push = p.put
+	return p, nil
+}
+
+// flush pushes s, the first time it's called only. Failures are logged but don't fail the close.
+func (p *metricsPusher) flush(s Stats) {
+	if p == nil {
+		return
+	}
+
+	p.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		defer cancel()
+		if err := p.push(ctx, formatStats(s)); err != nil {
+			log.Errorf("Failed to push the final auth metrics to %s: %v", redactedURL(p.url), err)
+		}
+	})
+}
+
+// put replaces the metrics of the push gateway's group at url with body
+func (p *metricsPusher) put(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// formatStats formats s in the Prometheus text exposition format, with the series sorted so the
+// output is stable
+func formatStats(s Stats) []byte {
+	var b bytes.Buffer
+
+	requests := make([]string, 0, len(s.Requests))
+	for l, v := range s.Requests {
+		requests = append(requests, fmt.Sprintf("rackspace_mk8s_auth_requests_total{endpoint=%q,outcome=%q} %d\n", l.Endpoint, l.Outcome, v))
+	}
+	sort.Strings(requests)
+	b.WriteString("# TYPE rackspace_mk8s_auth_requests_total counter\n")
+	b.WriteString(strings.Join(requests, ""))
+
+	versions := make([]string, 0, len(s.ResponseVersions))
+	for rv, v := range s.ResponseVersions {
+		versions = append(versions, fmt.Sprintf("rackspace_mk8s_auth_response_versions_total{api_version=%q,kind=%q} %d\n", rv.APIVersion, rv.Kind, v))
+	}
+	sort.Strings(versions)
+	b.WriteString("# TYPE rackspace_mk8s_auth_response_versions_total counter\n")
+	b.WriteString(strings.Join(versions, ""))
+
+	fmt.Fprintf(&b, "# TYPE rackspace_mk8s_auth_cache_entries gauge\nrackspace_mk8s_auth_cache_entries %d\n", s.CacheEntries)
+	fmt.Fprintf(&b, "# TYPE rackspace_mk8s_auth_cache_bytes gauge\nrackspace_mk8s_auth_cache_bytes %d\n", s.CacheBytes)
+
+	evictions := make([]string, 0, len(s.CacheEvictions))
+	for reason, v := range s.CacheEvictions {
+		evictions = append(evictions, fmt.Sprintf("rackspace_mk8s_auth_cache_evictions_total{reason=%q} %d\n", reason, v))
+	}
+	sort.Strings(evictions)
+	b.WriteString("# TYPE rackspace_mk8s_auth_cache_evictions_total counter\n")
+	b.WriteString(strings.Join(evictions, ""))
+
+	if s.SLOLatency > 0 {
+		fmt.Fprintf(&b, "# TYPE rackspace_mk8s_auth_slo_violations_total counter\nrackspace_mk8s_auth_slo_violations_total{slo_latency=%q} %d\n", s.SLOLatency, s.SLOViolations)
+	}
+	fmt.Fprintf(&b, "# TYPE rackspace_mk8s_auth_retry_budget gauge\nrackspace_mk8s_auth_retry_budget %g\n", s.RetryBudget)
+	return b.Bytes()
+}
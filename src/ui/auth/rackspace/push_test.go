@@ -0,0 +1,99 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseFlushesMetricsOnce(t *testing.T) {
+	pushes := 0
+	var body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes++
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/metrics/job/harbor", r.URL.Path)
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer gateway.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_METRICS_PUSH_URL": gateway.URL + "/metrics/job/harbor"})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.metrics.incRequest(a.authURL, outcomeSuccess)
+
+	a.Close()
+	a.Close()
+	assert.Equal(t, 1, pushes)
+	assert.Contains(t, body, fmt.Sprintf("rackspace_mk8s_auth_requests_total{endpoint=%q,outcome=\"success\"} 1", a.metrics.endpointLabel(a.authURL)))
+}
+
+func TestFormatCacheEvictions(t *testing.T) {
+	body := string(formatStats(Stats{CacheEvictions: map[string]int64{evictionExpired: 3, evictionCapacity: 1}}))
+	assert.Contains(t, body, "rackspace_mk8s_auth_cache_evictions_total{reason=\"capacity\"} 1\nrackspace_mk8s_auth_cache_evictions_total{reason=\"expired\"} 3\n")
+}
+
+func TestCloseWithoutMetricsPush(t *testing.T) {
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Nil(t, a.pusher)
+	a.Close()
+}
+
+func TestPushesMetrics(t *testing.T) {
+	defer func(a *Auth) { registered = a }(registered)
+
+	registered = nil
+	assert.False(t, PushesMetrics())
+	registered = &Auth{}
+	assert.False(t, PushesMetrics())
+	registered = &Auth{pusher: &metricsPusher{}}
+	assert.True(t, PushesMetrics())
+}
+
+func TestMetricsPushTimeout(t *testing.T) {
+	release := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer gateway.Close()
+	defer close(release)
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_METRICS_PUSH_URL":     gateway.URL,
+		"RACKSPACE_MK8S_AUTH_METRICS_PUSH_TIMEOUT": "50ms",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	// a hanging push gateway doesn't hold up the close beyond the timeout
+	start := time.Now()
+	a.Close()
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestMetricsPushInvalid(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_METRICS_PUSH_URL": "gateway:9091"})()
+	_, err := setupAuth()
+	assert.NotNil(t, err)
+}
@@ -15,7 +15,8 @@
 package rackspace
 
 import (
-	"bytes"
+	"context"
+	cryptorand "crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -23,13 +24,17 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/vmware/harbor/src/common"
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/notifier"
 	"github.com/vmware/harbor/src/common/utils/log"
 	"github.com/vmware/harbor/src/ui/auth"
 )
@@ -37,110 +42,415 @@ import (
 // Auth implements Authenticator interface to authenticate against Rackspace Managed Kubernetes Auth (kubernetes-auth)
 type Auth struct {
 	auth.DefaultAuthenticateHelper
-	authURL string
-	client  *http.Client
+	authURL    string
+	apiVersion string
+	kind       string
+	timeout    time.Duration
+	transport  transport
+	metrics    *metrics
+	hmacKey    []byte
+	inflight   inflightLimiter
+	ipLimit    *ipRateLimiter
+	// localVerifier, when set, verifies JWT tokens without contacting the backend
+	localVerifier *localVerifier
+	resolver      *UserResolver
+	cache         *userCache
+	versions      *versionWatcher
+
+	fieldMapping fieldMapping
+	retries      int
+	retryBudget  *retryBudget
+
+	errorMessages errorMessages
+	// extraGroupsKey, when set, is the key of the response's Extra field holding more groups
+	extraGroupsKey string
+	// usernameClaim, when set, is the key of the response's Extra field holding the username
+	usernameClaim string
+	// extraLimit bounds the response's Extra field kept once the extra groups are taken from it
+	extraLimit extraLimit
+	// maintenance, when set, rejects every login without contacting the backend
+	maintenance *MaintenanceError
+	// verifyPrincipal rejects logins whose username doesn't match the backend's username for the token
+	verifyPrincipal bool
+	// tracer, when set, traces the logins
+	tracer Tracer
+	// auditor, when set, records every auth decision
+	auditor Auditor
+	// audiences, when set, are requested from the backend and checked in its responses
+	audiences *audienceCheck
+	// negativeCache, when set, rejects the tokens the backend rejected recently without asking it again
+	negativeCache *negativeCache
+	// pusher, when set, pushes the final metrics to a push gateway on Close
+	pusher *metricsPusher
+	// serviceAccounts, when set, authenticate the allowed client certificates without the backend
+	serviceAccounts serviceAccounts
+	// errorDuration includes how long the backend was waited for in the errors of unavailable backends
+	errorDuration bool
+	// loginEvents, when set, publishes a sample of the successful logins
+	loginEvents *loginSampler
+	// redactedHeaders are the response headers whose values are never logged
+	redactedHeaders headerRedactor
+	// router, when set, sends some tokens to other backends than the one of authURL
+	router *backendRouter
+	// failoverLimits bound the failover of a request across the router's failover backends
+	failoverLimits failoverLimits
+	// health publishes the health changes of the backends, nil when disabled
+	health *backendHealth
+	// fake is set when the tokens are reviewed as fixed identities, see RACKSPACE_MK8S_AUTH_FAKE
+	fake bool
+	// offboardGrace, when set, lets the users the backend no longer authenticates log in for a while
+	offboardGrace *offboardGrace
 }
 
 // Authenticate checks user's credential against the Rackspace Managed Kubernetes Auth (kubernetes-auth)
 // if the check is successful a dummy record will be inserted into DB, such that this user can
-// be associated to other entities in the system.
+// be associated to other entities in the system. The HTTP call is done by review, the database
+// side by the UserResolver. The login is traced when a Tracer is registered.
 func (a *Auth) Authenticate(m models.AuthModel) (*models.User, error) {
+	ctx, span := a.startSpan(context.Background(), spanAuthenticate)
+	var cacheHit bool
+	user, err := a.authenticate(ctx, m, &cacheHit)
+	endSpan(span, err)
+	a.audit(m, user, err)
+	if err == nil {
+		a.loginEvents.emit(a.resolver, m, user, cacheHit)
+	}
+	return user, err
+}
 
-	// kubernetes-auth only uses the token (m.Password) for auth. The username (m.Principal) isn't used at all.
-	// In fact, a user could put anything at all into the username field. It must be ignored.
-	// However, we log the username to help track the request because we can't put the token (m.Password) in the logs.
-	log.Debugf("ProvidedUsername=%s Authentication attempt", m.Principal)
+// authenticate returns the user of the login, setting cacheHit when it was found in the cache
+func (a *Auth) authenticate(ctx context.Context, m models.AuthModel, cacheHit *bool) (*models.User, error) {
 
-	// build auth request
-	authRequest := &AuthRequest{}
-	authRequest.Spec.Token = m.Password
+	// kubernetes-auth only uses the token (m.Password) for auth. The username (m.Principal) isn't used at all
+	// unless RACKSPACE_MK8S_AUTH_VERIFY_PRINCIPAL is set, otherwise a user could put anything at all into the
+	// username field. However, we log the username to help track the request because we can't put the
+	// token (m.Password) in the logs.
+	log.Debugf("ProvidedUsername=%s ClientIP=%s Authentication attempt", m.Principal, clientIP(m))
 
-	authRequestBody, err := json.Marshal(authRequest)
+	if a.maintenance != nil {
+		log.Debugf("ProvidedUsername=%s Rejected, authentication is disabled for maintenance", m.Principal)
+		return nil, a.maintenance
+	}
+
+	// tokens are the only credential, throttle the source IPs guessing them
+	if err := a.ipLimit.allow(clientIP(m)); err != nil {
+		log.Warningf("ProvidedUsername=%s ClientIP=%s Rejected, too many login attempts", m.Principal, clientIP(m))
+		return nil, a.errorMessages.translate(m, err)
+	}
+
+	// allowed client certificates authenticate their service account without a token
+	if username := a.serviceAccounts.username(m); username != "" {
+		return a.authenticateServiceAccount(m, username)
+	}
+
+	// robot accounts are commonly misconfigured with an empty credential, which the backend would
+	// only reject after a round trip. Surrounding whitespace is trimmed from any other token.
+	m.Password = strings.TrimSpace(m.Password)
+	if m.Password == "" {
+		log.Debugf("ProvidedUsername=%s Rejected, the token is empty", m.Principal)
+		return nil, a.errorMessages.translate(m, ErrInvalidToken)
+	}
+
+	_, cacheSpan := a.startSpan(ctx, spanCacheGet)
+	user, ok := a.cache.get(m.Password)
+	cacheSpan.SetAttribute(attrCacheHit, ok)
+	cacheSpan.End()
+	if ok && !a.reverify(ctx, m) {
+		ok = false
+	}
+	*cacheHit = ok
+	if ok {
+		if err := a.checkPrincipal(m, user.Username); err != nil {
+			return nil, a.errorMessages.translate(m, err)
+		}
+		log.Debugf("ProvidedUsername=%s BackendUsername=%s Authenticated from cache", m.Principal, user.Username)
+		a.offboardGrace.seen(m.Password)
+		return user, nil
+	}
+
+	if err := a.negativeCache.get(m.Password); err != nil {
+		log.Debugf("ProvidedUsername=%s Rejected from cache, the token was rejected recently", m.Principal)
+		return nil, a.errorMessages.translate(m, err)
+	}
+
+	// JWT tokens are verified locally when possible, the backend decides for the others. The users
+	// the backend no longer authenticates may be graced for a while, but never cached.
+	var graced bool
+	var id *Identity
+	local, err := a.localVerifier.verify(m)
+	if err != nil {
+		return nil, a.errorMessages.translate(m, err)
+	}
+	if local != nil {
+		if id, err = a.checkRevocation(ctx, m, local); err != nil {
+			a.negativeCache.put(m.Password, err)
+			return nil, a.errorMessages.translate(m, err)
+		}
+	}
+	if id != nil {
+		log.Debugf("ProvidedUsername=%s UID=%s BackendUsername=%s Verified locally", m.Principal, id.UID, id.Username)
+	} else if id, err = a.backendIdentity(ctx, m); err != nil {
+		if id, graced = a.offboarded(m, err); !graced {
+			a.negativeCache.put(m.Password, err)
+			return nil, a.errorMessages.translate(m, err)
+		}
+	} else {
+		a.offboardGrace.remember(m.Password, *id)
+	}
+
+	if err := a.audiences.check(*id); err != nil {
+		return nil, a.errorMessages.translate(m, err)
+	}
+
+	id.Username = withUsernameClaim(*id, a.usernameClaim)
+	if err := a.checkPrincipal(m, a.resolver.UsernamePrefix+id.Username); err != nil {
+		return nil, a.errorMessages.translate(m, err)
+	}
+
+	id.Groups = withExtraGroups(*id, a.extraGroupsKey)
+	id.Extra = a.extraLimit.limitExtra(*id)
+
+	_, resolveSpan := a.startSpan(ctx, spanResolve)
+	user, err = a.resolver.Resolve(*id)
+	endSpan(resolveSpan, err)
+	if err != nil {
+		return nil, a.errorMessages.translate(m, err)
+	}
+
+	if !graced {
+		a.cache.put(m.Password, user)
+	}
+	return user, nil
+}
+
+// reverify asks the backend again whether a cached token still maps to the cached UID once the
+// reverify interval has passed, and reports whether the cached user can be served. A backend
+// reusing the token for another identity, or scoping it to other audiences, evicts the entry, and
+// the token is then resolved as if it had never been cached. The cached user keeps being served while the backend fails.
+func (a *Auth) reverify(ctx context.Context, m models.AuthModel) bool {
+	uid, due := a.cache.reverifyDue(m.Password)
+	if !due {
+		return true
+	}
+
+	id, err := a.backendIdentity(ctx, m)
+	if err == ErrNotAuthenticated {
+		log.Warningf("ProvidedUsername=%s UID=%s The backend no longer authenticates the cached token, invalidating it", m.Principal, uid)
+		a.cache.invalidateToken(m.Password)
+		return false
+	}
+	if err != nil {
+		log.Warningf("ProvidedUsername=%s UID=%s Failed to verify the cached token again: %v", m.Principal, uid, err)
+		return true
+	}
+	if id.UID != uid {
+		log.Warningf("ProvidedUsername=%s UID=%s The backend now maps the cached token to UID=%s, invalidating it", m.Principal, uid, id.UID)
+		a.cache.invalidateToken(m.Password)
+		return false
+	}
+	if err := a.audiences.check(*id); err != nil {
+		log.Warningf("ProvidedUsername=%s UID=%s The cached token is no longer valid for the configured audiences, invalidating it", m.Principal, uid)
+		a.cache.invalidateToken(m.Password)
+		return false
+	}
+
+	a.cache.verified(m.Password)
+	return true
+}
+
+// backendIdentity reviews the token in m with the backend and returns the identity of its user.
+// Tokens the backend didn't authenticate return ErrNotAuthenticated, without the identity fields it echoed.
+func (a *Auth) backendIdentity(ctx context.Context, m models.AuthModel) (*Identity, error) {
+	reviewCtx, reviewSpan := a.startSpan(ctx, spanReview)
+	reviewSpan.SetAttribute(attrBackend, a.backendFor(m.Password).url)
+	authResp, err := a.reviewContext(reviewCtx, m)
+	endSpan(reviewSpan, err)
 	if err != nil {
-		log.Errorf("ProvidedUsername=%s Error marshalling auth request: %v", m.Principal, err)
 		return nil, err
 	}
 
-	log.Debugf("ProvidedUsername=%s Sending auth request: %s", m.Principal, rackspaceMK8SAuthURLTokenEndpoint)
+	log.Debugf("ProvidedUsername=%s UID=%s BackendUsername=%s Authenticated=%t", m.Principal, authResp.Status.User.UID, authResp.Status.User.Username, authResp.Status.Authenticated)
 
-	// send auth request
-	resp, err := a.client.Post(a.authURL+"/authenticate/token", "application/json", bytes.NewReader(authRequestBody))
+	if !authResp.Status.Authenticated {
+		return nil, ErrNotAuthenticated
+	}
+	id := authResp.identity()
+	return &id, nil
+}
+
+// Close pushes the final metrics when a push gateway is configured and stops the background work
+// of the authenticator
+func (a *Auth) Close() {
+	a.pusher.flush(a.Stats())
+	a.cache.Close()
+}
+
+// checkPrincipal returns ErrPrincipalMismatch when principal verification is on and the username
+// typed by the user isn't the Harbor username of the token's user, with or without the username
+// prefix. Both are compared as limited to the user table's length, so cached users with truncated
+// usernames still match.
+func (a *Auth) checkPrincipal(m models.AuthModel, username string) error {
+	if !a.verifyPrincipal {
+		return nil
+	}
+	principal := m.Principal
+	if prefix := a.resolver.UsernamePrefix; !strings.HasPrefix(principal, prefix) {
+		principal = prefix + principal
+	}
+	if a.resolver.NormalizeUnicode {
+		principal, username = composeNFC(principal), composeNFC(username)
+	}
+	if a.resolver.NormalizeCase {
+		principal, username = strings.ToLower(principal), strings.ToLower(username)
+	}
+	if truncateWithHash(principal, maxUsernameLength) == truncateWithHash(username, maxUsernameLength) {
+		return nil
+	}
+
+	log.Warningf("ProvidedUsername=%s BackendUsername=%s Provided username doesn't match the token's user", m.Principal, username)
+	return ErrPrincipalMismatch
+}
+
+// review sends the token in m to kubernetes-auth as a TokenReview and returns the decoded response.
+func (a *Auth) review(m models.AuthModel) (*AuthResponse, error) {
+	return a.reviewContext(context.Background(), m)
+}
+
+// reviewContext is review giving up once ctx is done
+func (a *Auth) reviewContext(ctx context.Context, m models.AuthModel) (*AuthResponse, error) {
+
+	authRequest := newAuthRequest(a.apiVersion, a.kind, m)
+	authRequest.Spec.Audiences = a.audiences.requested()
+	authRequestBody, err := marshalAuthRequest(authRequest)
 	if err != nil {
-		log.Errorf("ProvidedUsername=%s Error sending auth request: %v", m.Principal, err)
+		log.Errorf("ProvidedUsername=%s Error marshalling auth request: %v", m.Principal, err)
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// read auth response body
-	authRespBody, err := ioutil.ReadAll(resp.Body)
+	start := time.Now()
+	authRespBody, header, err := a.failover(ctx, m, authRequestBody)
 	if err != nil {
-		log.Errorf("ProvidedUsername=%s Error reading auth response: %v", m.Principal, err)
+		if a.errorDuration && backendUnavailable(err) {
+			return nil, newBackendUnavailableError(err, time.Since(start))
+		}
 		return nil, err
 	}
 
-	// check for any status other than OK
-	if resp.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("HTTPStatusCode=%d AuthResponseBody=%s", resp.StatusCode, authRespBody)
-		log.Errorf("ProvidedUsername=%s Error non-200-OK status code on auth response: %s", m.Principal, errMsg)
-		return nil, errors.New(errMsg)
+	// verify the response was signed by the backend, when a shared secret is configured
+	if err := verifySignature(a.hmacKey, authRespBody, header.Get(signatureHeader)); err != nil {
+		log.Errorf("ProvidedUsername=%s Error verifying auth response: %v", m.Principal, err)
+		return nil, err
 	}
 
 	// read auth response body as json
 	authResp := AuthResponse{}
 	err = json.Unmarshal([]byte(authRespBody), &authResp)
 	if err != nil {
+		err = newBackendProtocolError(header.Get("Content-Type"), authRespBody, err)
 		log.Errorf("ProvidedUsername=%s Error unmarshalling auth response: %v", m.Principal, err)
 		return nil, err
 	}
 
-	log.Debugf("ProvidedUsername=%s UID=%s BackendUsername=%s Authenticated=%t Getting user from database", m.Principal, authResp.Status.User.UID, authResp.Status.User.Username, authResp.Status.Authenticated)
-
-	user, err := dao.GetUser(models.User{Username: authResp.Status.User.Username})
-	if err != nil {
-		log.Errorf("ProvidedUsername=%s Error getting user from database: %v", m.Principal, err)
+	// read any remapped fields of a non-standard backend
+	if err := a.fieldMapping.apply(authRespBody, &authResp); err != nil {
+		log.Errorf("ProvidedUsername=%s Error mapping auth response fields: %v", m.Principal, err)
 		return nil, err
 	}
 
-	// check if the user already exists in the database. if the user doesn't exist, create it.
-	if user != nil {
-		log.Debugf("ProvidedUsername=%s UID=%s BackendUsername=%s exists in database", m.Principal, authResp.Status.User.UID, authResp.Status.User.Username)
+	if err := checkStatus(authRespBody, &authResp); err != nil {
+		err = newBackendProtocolError(header.Get("Content-Type"), authRespBody, err)
+		log.Errorf("ProvidedUsername=%s Error invalid auth response: %v", m.Principal, err)
+		return nil, err
+	}
 
-		// if the username changed in kubernetes-auth backend, update it in the database
-		if user.Username != authResp.Status.User.Username {
-			log.Debugf("ProvidedUsername=%s UID=%s BackendUsername=%s backend username changed so updating database", m.Principal, authResp.Status.User.UID, authResp.Status.User.Username)
+	a.versions.observe(ResponseVersion{APIVersion: authResp.APIVersion, Kind: authResp.Kind})
 
-			user.Username = authResp.Status.User.Username
-			user.Email = emailAddress(user)
+	return &authResp, nil
+}
 
-			err = dao.ChangeUserProfile(*user)
-			if err != nil {
-				log.Errorf("ProvidedUsername=%s UID=%s BackendUsername=%s Error updating user profile: %v", m.Principal, authResp.Status.User.UID, authResp.Status.User.Username, err)
-				return nil, err
-			}
+// post sends the auth request body to the backend b and returns the body and headers of the 200 OK response.
+// Transport errors and 5xx responses are retried while the retry budget allows it and ctx isn't done.
+// retryable reports whether the last failure was worth retrying, e.g. on another backend.
+func (a *Auth) post(ctx context.Context, m models.AuthModel, b *backend, authRequestBody []byte) ([]byte, http.Header, bool, error) {
+	for attempt := 0; ; attempt++ {
+		authRespBody, header, retryable, err := a.postOnce(ctx, m, b, authRequestBody)
+		if err == nil {
+			a.retryBudget.deposit()
+			return authRespBody, header, false, nil
 		}
-	} else {
-		log.Debugf("ProvidedUsername=%s UID=%s BackendUsername=%s does not exist in database so creating new user", m.Principal, authResp.Status.User.UID, authResp.Status.User.Username)
-
-		// set the Harbor Realname to the kubernetes-auth backend's UID because the UID is a static ID
-		// whereas the kubernetes-auth backend's Username can change (so put it in the Harbor Username field for convenience)
-		// the Password field is required but unused so we set it to something random
-		user = new(models.User)
-		user.Realname = authResp.Status.User.UID
-		user.Username = authResp.Status.User.Username
-		user.Password = randString()
-		user.Comment = "Do not edit this user"
-		user.Email = emailAddress(user)
-
-		userID, err := dao.Register(*user)
-		if err != nil {
-			log.Errorf("ProvidedUsername=%s UID=%s BackendUsername=%s Error creating new user: %v", m.Principal, authResp.Status.User.UID, authResp.Status.User.Username, err)
-			return nil, err
+		if !retryable || attempt >= a.retries {
+			return nil, nil, retryable, err
+		}
+		if !a.retryBudget.withdraw() {
+			log.Warningf("ProvidedUsername=%s Retry budget exhausted, not retrying auth request", m.Principal)
+			return nil, nil, retryable, err
+		}
+
+		log.Debugf("ProvidedUsername=%s Retrying auth request, attempt %d of %d", m.Principal, attempt+1, a.retries)
+		select {
+		case <-time.After(time.Duration(attempt+1) * retryBackoff):
+		case <-ctx.Done():
+			return nil, nil, false, ctx.Err()
 		}
+	}
+}
+
+// postOnce makes a single request to the backend b. retryable reports whether a failure is worth retrying.
+func (a *Auth) postOnce(ctx context.Context, m models.AuthModel, b *backend, authRequestBody []byte) (authRespBody []byte, header http.Header, retryable bool, err error) {
+	log.Debugf("ProvidedUsername=%s Sending auth request: %s", m.Principal, rackspaceMK8SAuthURLTokenEndpoint)
 
-		user.UserID = int(userID)
+	// wait for a free slot so kubernetes-auth is not stampeded
+	if err := a.inflight.acquire(a.timeout); err != nil {
+		log.Errorf("ProvidedUsername=%s Error sending auth request: %v", m.Principal, err)
+		return nil, nil, false, err
 	}
+	defer a.inflight.release()
 
-	return user, nil
+	start := time.Now()
+	authRespBody, header, err = b.transport.send(ctx, m, authRequestBody)
+	a.metrics.observeLatency(time.Since(start))
+
+	// check for any status other than OK
+	if statusErr, ok := err.(*statusError); ok {
+		a.metrics.incRequest(b.url, outcomeFailure)
+		serverError := statusErr.code >= http.StatusInternalServerError
+		if serverError {
+			a.cache.backendFailed()
+		}
+		log.Errorf("ProvidedUsername=%s Error non-200-OK status code on auth response: %s AuthResponseHeaders=[%s]", m.Principal, statusErr, a.redactedHeaders.format(header))
+		return nil, nil, serverError, statusErr
+	}
+	if protocolErr, ok := err.(*BackendProtocolError); ok {
+		// retrying a misbehaving backend wouldn't change its answer
+		a.metrics.incRequest(b.url, outcomeFailure)
+		log.Errorf("ProvidedUsername=%s Error invalid auth response: %v AuthResponseHeaders=[%s]", m.Principal, protocolErr, a.redactedHeaders.format(header))
+		return nil, nil, false, protocolErr
+	}
+	if errors.Is(err, ErrUntrustedRedirect) {
+		// another backend would be just as misconfigured, and this one isn't down
+		a.metrics.incRequest(b.url, outcomeFailure)
+		log.Errorf("ProvidedUsername=%s Error auth request redirected: %v", m.Principal, err)
+		return nil, nil, false, err
+	}
+	if err != nil && ctx.Err() != nil {
+		// the caller gave up, which says nothing about the backend
+		a.metrics.incRequest(b.url, outcomeError)
+		log.Errorf("ProvidedUsername=%s Gave up on auth request: %v", m.Principal, ctx.Err())
+		return nil, nil, false, ctx.Err()
+	}
+	if err != nil {
+		// connection failures, e.g. exhausted ports under load, are worth retrying like a 5xx
+		err = connectionError(err)
+		a.metrics.incRequest(b.url, outcomeError)
+		a.cache.backendFailed()
+		log.Errorf("ProvidedUsername=%s Error sending auth request: %v", m.Principal, err)
+		return nil, nil, true, err
+	}
+
+	a.metrics.incRequest(b.url, outcomeSuccess)
+	a.cache.backendSucceeded()
+
+	return authRespBody, header, false, nil
 }
 
 func (a *Auth) OnBoardUser(u *models.User) error {
@@ -159,14 +469,32 @@ func (a *Auth) SearchUser(username string) (*models.User, error) {
 	return dao.GetUser(queryCondition)
 }
 
+// SearchGroup returns the onboarded group of kubernetes-auth with the identifier, or nil if there's
+// none. Groups only exist in Harbor once a member logged in, kubernetes-auth can't be searched.
 func (a *Auth) SearchGroup(groupDN string) (*models.UserGroup, error) {
-	return nil, errors.New("not implemented")
+	groups := a.resolver.Groups
+	if groups == nil {
+		groups = DAOGroupStore{}
+	}
+	return groups.GetGroup(groupIdentifier(groupName(groupDN)))
 }
 
 func (a *Auth) PostAuthenticate(u *models.User) error {
 	return nil
 }
 
+const (
+	// defaultAPIVersion and defaultKind describe the kubernetes-auth v1 TokenReview contract
+	defaultAPIVersion = "authentication.k8s.io/v1"
+	defaultKind       = "TokenReview"
+
+	// defaultTimeout bounds a single request to kubernetes-auth
+	defaultTimeout = 30 * time.Second
+
+	// retryBackoff is the delay before the first retry, each following retry waits one more
+	retryBackoff = 100 * time.Millisecond
+)
+
 var (
 	rackspaceMK8SAuthURLTokenEndpoint string
 )
@@ -177,49 +505,498 @@ func init() {
 		log.Fatal(err)
 	}
 
-	log.Infof("Initializing Rackspace Managed Auth: url=%q", a.authURL)
+	log.Infof("Initializing Rackspace Managed Auth: url=%q apiVersion=%q kind=%q", a.authURL, a.apiVersion, a.kind)
+
+	auth.Register(common.RackspaceAuth, a)
+	registered = a
 
-	auth.Register("rackspace_mk8s_auth", a)
+	if err := notifier.Subscribe(notifier.UserDeletedTopic, &userDeletedHandler{cache: a.cache}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// registered is the authenticator registered with Harbor
+var registered *Auth
+
+// Close closes the registered authenticator, pushing its final metrics. It is called when Harbor
+// is terminating.
+func Close() {
+	if registered != nil {
+		registered.Close()
+	}
+}
+
+// PushesMetrics reports whether the registered authenticator pushes its final metrics to a push
+// gateway on Close
+func PushesMetrics() bool {
+	return registered != nil && registered.pusher != nil
+}
+
+// RegisterOnboardHook sets the hook called with each user created on first login by the registered
+// authenticator. It must be called before any login is served.
+func RegisterOnboardHook(hook func(*models.User) error) {
+	if registered == nil {
+		return
+	}
+	registered.resolver.OnboardHook = hook
 }
 
 func setupAuth() (*Auth, error) {
-	return &Auth{
-		authURL: mk8sAuthURL(),
-		client:  getClient(),
-	}, nil
+	authURL, err := mk8sAuthURL()
+	if err != nil {
+		return nil, err
+	}
+
+	timeouts, err := backendTimeouts()
+	if err != nil {
+		return nil, err
+	}
+
+	maxInflight, err := envInt("RACKSPACE_MK8S_AUTH_MAX_INFLIGHT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := cacheTTL()
+	if err != nil {
+		return nil, err
+	}
+
+	evictionInterval, err := cacheEvictionInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	reverifyInterval, err := cacheReverifyInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	maxEntries, err := cacheMaxEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	negTTL, err := negativeTTL()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := responseFieldMapping()
+	if err != nil {
+		return nil, err
+	}
+
+	retries, err := envInt("RACKSPACE_MK8S_AUTH_RETRIES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	budget, err := newRetryBudgetFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := authErrorMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := extraHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	redacted, err := redactedHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := backendTransport(authURL, openStackCAPath, timeouts, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	fake, err := fakeTransport()
+	if err != nil {
+		return nil, err
+	}
+	if fake != nil {
+		log.Warningf("RACKSPACE_MK8S_AUTH_FAKE is set, tokens are reviewed as fixed identities instead of by the backend")
+		transport = fake
+	}
+
+	router, err := backendRouting(timeouts, headers, fake)
+	if err != nil {
+		return nil, err
+	}
+
+	failover, err := failoverLimitsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	grace, err := newOffboardGrace()
+	if err != nil {
+		return nil, err
+	}
+
+	groupSync, err := envBool("RACKSPACE_MK8S_AUTH_GROUP_SYNC", false)
+	if err != nil {
+		return nil, err
+	}
+
+	strictGroupSync, err := envBool("RACKSPACE_MK8S_AUTH_GROUP_SYNC_STRICT", false)
+	if err != nil {
+		return nil, err
+	}
+
+	maxGroups, groupLimitPolicy, err := groupLimit()
+	if err != nil {
+		return nil, err
+	}
+
+	deletedUsers, err := deletedUserPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	strictOnboardHook, err := envBool("RACKSPACE_MK8S_AUTH_ONBOARD_HOOK_STRICT", false)
+	if err != nil {
+		return nil, err
+	}
+
+	verifyPrincipal, err := envBool("RACKSPACE_MK8S_AUTH_VERIFY_PRINCIPAL", false)
+	if err != nil {
+		return nil, err
+	}
+
+	maintenance, err := maintenanceMode()
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := extraLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	lowercase, err := envBool("RACKSPACE_MK8S_AUTH_NORMALIZE_CASE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	compose, err := envBool("RACKSPACE_MK8S_AUTH_NORMALIZE_UNICODE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	renameEmails, err := renameEmailPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := passwordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := usernamePrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := uidField()
+	if err != nil {
+		return nil, err
+	}
+
+	auditor, err := auditFile()
+	if err != nil {
+		return nil, err
+	}
+
+	ipLimit, err := ipRateLimit()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := localVerification()
+	if err != nil {
+		return nil, err
+	}
+
+	audiences, err := audienceConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := groupRoles()
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) > 0 && !groupSync {
+		log.Warningf("RACKSPACE_MK8S_AUTH_GROUP_ROLES is set but has no effect unless RACKSPACE_MK8S_AUTH_GROUP_SYNC is enabled")
+	}
+
+	domains, err := emailDomains()
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := usernameConflictPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	pusher, err := metricsPush()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := serviceAccountConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	errorDuration, err := envBool("RACKSPACE_MK8S_AUTH_ERROR_DURATION", false)
+	if err != nil {
+		return nil, err
+	}
+
+	loginEvents, err := loginEventSampling()
+	if err != nil {
+		return nil, err
+	}
+
+	sloLatency, err := envDuration("RACKSPACE_MK8S_AUTH_SLO_LATENCY", 0)
+	if err != nil {
+		return nil, err
+	}
+	requestMetrics := newMetrics(append([]string{authURL}, router.urls()...)...)
+	requestMetrics.sloLatency = sloLatency
+
+	resolver := NewUserResolver()
+	resolver.DeletedUsers = deletedUsers
+	resolver.StrictOnboardHook = strictOnboardHook
+	resolver.RenameEmails = renameEmails
+	resolver.Passwords = passwords
+	resolver.UsernameConflicts = conflicts
+	resolver.NormalizeCase = lowercase
+	resolver.NormalizeUnicode = compose
+	resolver.UsernamePrefix = prefix
+	resolver.AdminUsername = envOrDefault("RACKSPACE_MK8S_AUTH_ADMIN_USERNAME", defaultAdminUsername)
+	resolver.UIDField = uid
+	resolver.emailDomains = domains
+	if groupSync {
+		resolver.Groups = DAOGroupStore{}
+		resolver.StrictGroupSync = strictGroupSync
+		resolver.MaxGroups = maxGroups
+		resolver.GroupLimit = groupLimitPolicy
+		resolver.groupRoles = roles.normalized(resolver.normalizeName)
+	}
+
+	apiVersion := envOrDefault("RACKSPACE_MK8S_AUTH_API_VERSION", defaultAPIVersion)
+	kind := envOrDefault("RACKSPACE_MK8S_AUTH_KIND", defaultKind)
+
+	health, err := backendHealthFromEnv(resolver.notify)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := newUserCache(ttl)
+	if cache != nil {
+		cache.reverifyInterval = reverifyInterval
+		cache.maxEntries = maxEntries
+	}
+	cache.startEviction(evictionInterval)
+
+	a := &Auth{
+		authURL:    authURL,
+		apiVersion: apiVersion,
+		kind:       kind,
+		timeout:    timeouts.total,
+		transport:  transport,
+		metrics:    requestMetrics,
+		hmacKey:    responseHMACKey(),
+		inflight:   newInflightLimiter(maxInflight),
+		ipLimit:    ipLimit,
+		resolver:   resolver,
+		cache:      cache,
+		versions:   newVersionWatcher(apiVersion, kind),
+
+		fieldMapping: mapping,
+		retries:      retries,
+		retryBudget:  budget,
+
+		errorMessages:   messages,
+		verifyPrincipal: verifyPrincipal,
+		maintenance:     maintenance,
+		extraGroupsKey:  envOrDefault("RACKSPACE_MK8S_AUTH_EXTRA_GROUPS_KEY", ""),
+		usernameClaim:   strings.TrimSpace(envOrDefault("RACKSPACE_MK8S_AUTH_USERNAME_CLAIM", "")),
+		extraLimit:      extra,
+		auditor:         auditor,
+		localVerifier:   verifier,
+		audiences:       audiences,
+		negativeCache:   newNegativeCache(negTTL),
+		pusher:          pusher,
+		serviceAccounts: accounts,
+		errorDuration:   errorDuration,
+		loginEvents:     loginEvents,
+		redactedHeaders: redacted,
+		router:          router,
+		failoverLimits:  failover,
+		health:          health,
+		fake:            fake != nil,
+		offboardGrace:   grace,
+	}
+	logConfigSummary(a)
+	return a, nil
 }
 
-func getClient() *http.Client {
-	const caPath = "/etc/openstack/certs/ca.pem"
-	if needCustomCert(caPath) {
+// maintenanceMode returns the error rejecting logins when RACKSPACE_MK8S_AUTH_MAINTENANCE is set,
+// with the message of RACKSPACE_MK8S_AUTH_MAINTENANCE_MESSAGE, or nil
+func maintenanceMode() (*MaintenanceError, error) {
+	const defaultMaintenanceMessage = "Authentication is disabled for maintenance, please try again later"
+
+	on, err := envBool("RACKSPACE_MK8S_AUTH_MAINTENANCE", false)
+	if err != nil || !on {
+		return nil, err
+	}
+
+	log.Warningf("RACKSPACE_MK8S_AUTH_MAINTENANCE is set, all logins will be rejected")
+	return &MaintenanceError{Message: envOrDefault("RACKSPACE_MK8S_AUTH_MAINTENANCE_MESSAGE", defaultMaintenanceMessage)}, nil
+}
+
+// cacheTTL returns the cache TTL policy. Caching is disabled unless RACKSPACE_MK8S_AUTH_CACHE_TTL is set.
+func cacheTTL() (*adaptiveTTL, error) {
+	base, err := envDuration("RACKSPACE_MK8S_AUTH_CACHE_TTL", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	adaptive, err := envBool("RACKSPACE_MK8S_AUTH_CACHE_ADAPTIVE_TTL", false)
+	if err != nil {
+		return nil, err
+	}
+
+	max, err := envDuration("RACKSPACE_MK8S_AUTH_CACHE_MAX_TTL", 4*base)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAdaptiveTTL(base, max, adaptive), nil
+}
+
+// clientTimeouts bound the phases of a backend request, so that a slow-but-alive backend can be
+// given time to answer while an unreachable one fails fast
+type clientTimeouts struct {
+	// connect bounds dialing and the TLS handshake
+	connect time.Duration
+	// responseHeader bounds waiting for the response headers once the request is sent, zero for no limit
+	responseHeader time.Duration
+	// total caps the whole request, including reading the response body
+	total time.Duration
+}
+
+// backendTimeouts returns the configured timeouts. The connect timeout defaults to the total timeout.
+func backendTimeouts() (clientTimeouts, error) {
+	return timeoutsFromEnv("RACKSPACE_MK8S_AUTH_", clientTimeouts{total: defaultTimeout})
+}
+
+// timeoutsFromEnv returns the timeouts of the <prefix>TIMEOUT, <prefix>CONNECT_TIMEOUT and
+// <prefix>RESPONSE_HEADER_TIMEOUT env vars, each defaulting to the one of defaults. Without a
+// default, the connect timeout defaults to the total timeout.
+func timeoutsFromEnv(prefix string, defaults clientTimeouts) (clientTimeouts, error) {
+	total, err := envDuration(prefix+"TIMEOUT", defaults.total)
+	if err != nil {
+		return clientTimeouts{}, err
+	}
+
+	connectDefault := defaults.connect
+	if connectDefault == 0 {
+		connectDefault = total
+	}
+	connect, err := envDuration(prefix+"CONNECT_TIMEOUT", connectDefault)
+	if err != nil {
+		return clientTimeouts{}, err
+	}
+
+	responseHeader, err := envDuration(prefix+"RESPONSE_HEADER_TIMEOUT", defaults.responseHeader)
+	if err != nil {
+		return clientTimeouts{}, err
+	}
+
+	return clientTimeouts{connect: connect, responseHeader: responseHeader, total: total}, nil
+}
+
+// openStackCAPath is the CA trusted in addition to the system's for https backends, when it exists
+var openStackCAPath = "/etc/openstack/certs/ca.pem"
+
+// getClient returns the HTTP client of the backend, trusting the CA of caPath in addition to the
+// system's when it exists. A CA file without any certificate fails rather than silently trusting
+// only the system's CAs.
+func getClient(authURL, caPath string, timeouts clientTimeouts) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeouts.connect,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeouts.connect,
+		ResponseHeaderTimeout: timeouts.responseHeader,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	client := &http.Client{
+		Timeout:       timeouts.total,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+
+	if needCustomCert(authURL, caPath) {
 		ca, err := ioutil.ReadFile(caPath)
 		if err != nil {
 			log.Errorf("Error reading OpenStack CA Cert %s: %v", caPath, err)
-			return http.DefaultClient
+			return client, nil
 		}
 
 		certs, err := x509.SystemCertPool()
 		if err != nil {
 			log.Errorf("Error getting cert pool: %v", err)
-			return http.DefaultClient
+			return client, nil
 		}
 
-		certs.AppendCertsFromPEM(ca)
+		if !certs.AppendCertsFromPEM(ca) {
+			log.Errorf("No certificate found in OpenStack CA Cert %s", caPath)
+			return nil, fmt.Errorf("The OpenStack CA Cert %s is not a valid PEM certificate", caPath)
+		}
 
-		return &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					RootCAs: certs,
-				},
-			},
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: certs,
 		}
 	}
 
-	return http.DefaultClient
+	return client, nil
+}
+
+// checkRedirect refuses redirects to another host or from https to http, the request carries the token
+// so it must only ever reach the configured backend
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	original := via[0].URL
+	if req.URL.Host != original.Host || (original.Scheme == "https" && req.URL.Scheme != "https") {
+		log.Errorf("Refusing redirect of auth request from %s to %s", original.Host, req.URL.Host)
+		return ErrUntrustedRedirect
+	}
+	return nil
 }
 
-func needCustomCert(caPath string) bool {
-	if !strings.HasPrefix(mk8sAuthURL(), "https") {
+func needCustomCert(authURL, caPath string) bool {
+	if !strings.HasPrefix(authURL, "https") {
 		return false
 	}
 
@@ -235,7 +1012,8 @@ func needCustomCert(caPath string) bool {
 	return true
 }
 
-func mk8sAuthURL() string {
+// mk8sAuthURL returns the normalized kubernetes-auth URL from RACKSPACE_MK8S_AUTH_URL
+func mk8sAuthURL() (string, error) {
 	const envVar = "RACKSPACE_MK8S_AUTH_URL"
 
 	authURL := os.Getenv(envVar)
@@ -245,11 +1023,59 @@ func mk8sAuthURL() string {
 		authURL = "http://app:8080"
 	}
 
-	if _, err := url.ParseRequestURI(authURL); err != nil {
-		log.Fatalf("The env var %s is not a valid url %s", envVar, authURL)
+	return backendURL(envVar, authURL)
+}
+
+// backendURL returns the normalized authURL of envVar, the URL of a kubernetes-auth backend
+func backendURL(envVar, authURL string) (string, error) {
+	normalized, err := normalizeAuthURL(authURL)
+	if err != nil {
+		return "", fmt.Errorf("The env var %s is not a valid url %s: %v", envVar, authURL, err)
+	}
+
+	// production deployments can forbid sending tokens to kubernetes-auth in the clear
+	requireHTTPS, err := envBool("RACKSPACE_MK8S_AUTH_REQUIRE_HTTPS", false)
+	if err != nil {
+		return "", err
+	}
+	if requireHTTPS && !strings.HasPrefix(normalized, "https://") {
+		return "", fmt.Errorf("The env var %s must be an https url when RACKSPACE_MK8S_AUTH_REQUIRE_HTTPS is set, got %s", envVar, authURL)
+	}
+
+	return normalized, nil
+}
+
+// normalizeAuthURL checks rawURL is an http(s) URL that the endpoint paths can be appended to,
+// and strips its trailing slashes
+func normalizeAuthURL(rawURL string) (string, error) {
+	u, err := url.ParseRequestURI(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", errors.New("host is missing")
 	}
+	if u.RawQuery != "" || u.ForceQuery {
+		return "", errors.New("query strings are not supported")
+	}
+	if strings.Contains(rawURL, "#") {
+		return "", errors.New("fragments are not supported")
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
 
-	return authURL
+// clientIP returns the client IP from the metadata of m, if the caller provided it
+func clientIP(m models.AuthModel) string {
+	if m.Metadata == nil {
+		return ""
+	}
+	return m.Metadata.ClientIP
 }
 
 func randString() string {
@@ -261,17 +1087,56 @@ func randString() string {
 	return string(b)
 }
 
-// emailAddress will return a unique email address for the given user
-// Harbor requires email addresses in its database to be unique.
-func emailAddress(u *models.User) string {
-	// (fake) default email domain
-	const defaultEmailDomain = "fake-rackspace-mk8s.com"
+// sentinelPasswordLength fits the password validators, which accept 8 to 20 characters
+const sentinelPasswordLength = 20
+
+// sentinelPassword returns a password nobody knows from a cryptographic source, with the
+// lowercase, uppercase and digit characters the password validators require
+func sentinelPassword() string {
+	const (
+		lower  = "abcdefghijklmnopqrstuvwxyz"
+		upper  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		digits = "0123456789"
+	)
+	alphabet := lower + upper + digits
+	// bytes from max up are rejected so that every character is equally likely
+	max := 256 - 256%len(alphabet)
+
+	buf := make([]byte, 1)
+	for {
+		b := make([]byte, 0, sentinelPasswordLength)
+		for len(b) < sentinelPasswordLength {
+			if _, err := cryptorand.Read(buf); err != nil {
+				panic(fmt.Sprintf("error reading random bytes: %v", err))
+			}
+			if int(buf[0]) < max {
+				b = append(b, alphabet[int(buf[0])%len(alphabet)])
+			}
+		}
+		p := string(b)
+		if strings.ContainsAny(p, lower) && strings.ContainsAny(p, upper) && strings.ContainsAny(p, digits) {
+			return p
+		}
+	}
+}
+
+// defaultEmailDomain is the default domain of the synthetic emails, under the .invalid TLD
+// RFC 2606 reserves so that no mail can ever be delivered to them
+const defaultEmailDomain = "rackspace-mk8s.invalid"
+
+// legacyEmailDomain is the former default domain, still found in the synthetic emails of the
+// users created before
+const legacyEmailDomain = "fake-rackspace-mk8s.com"
 
+// emailAddress will return a unique email address for the given user in domain
+// Harbor requires email addresses in its database to be unique. Usernames longer than the 64
+// characters RFC 5321 allows in a local part are truncated with a hash.
+func emailAddress(u *models.User, domain string) string {
 	if u.Email != "" {
 		return u.Email
 	}
 	if u.Username != "" {
-		return fmt.Sprintf("%s@%s", u.Username, defaultEmailDomain)
+		return fmt.Sprintf("%s@%s", truncateWithHash(u.Username, maxEmailLocalPartLength), domain)
 	}
-	return fmt.Sprintf("%s@%s", randString(), defaultEmailDomain)
+	return fmt.Sprintf("%s@%s", randString(), domain)
 }
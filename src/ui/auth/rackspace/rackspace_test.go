@@ -0,0 +1,448 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// fakeBackend is a kubernetes-auth stand-in that records the last TokenReview it received
+type fakeBackend struct {
+	*httptest.Server
+	lastRequest AuthRequest
+	lastMethod  string
+	lastHeader  http.Header
+	response    AuthResponse
+	// hmacKey, when set, is used to sign responses
+	hmacKey []byte
+	// status, when set, is returned instead of 200 OK
+	status int
+	// rawBody, when set, is returned instead of response
+	rawBody  []byte
+	requests int
+}
+
+func newFakeBackend(t *testing.T) *fakeBackend {
+	fb := &fakeBackend{}
+	fb.response.APIVersion = defaultAPIVersion
+	fb.response.Kind = defaultKind
+	fb.response.Status.Authenticated = true
+	fb.response.Status.User.Username = "alice"
+	fb.response.Status.User.UID = "uid-alice"
+	fb.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fb.requests++
+		fb.lastHeader = r.Header
+		fb.lastMethod = r.Method
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+		}
+		if err := json.Unmarshal(body, &fb.lastRequest); err != nil {
+			t.Errorf("failed to unmarshal request body: %v", err)
+		}
+		respBody, _ := json.Marshal(fb.response)
+		if fb.rawBody != nil {
+			respBody = fb.rawBody
+		}
+		if fb.hmacKey != nil {
+			w.Header().Set(signatureHeader, signBody(fb.hmacKey, respBody))
+		}
+		if fb.status != 0 {
+			w.WriteHeader(fb.status)
+		}
+		w.Write(respBody)
+	}))
+	return fb
+}
+
+func setEnv(t *testing.T, kv map[string]string) func() {
+	for k, v := range kv {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatalf("failed to set %s: %v", k, err)
+		}
+	}
+	return func() {
+		for k := range kv {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestReviewDefaultVersion(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	resp, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.Status.User.Username)
+	assert.Equal(t, "authentication.k8s.io/v1", fb.lastRequest.APIVersion)
+	assert.Equal(t, "TokenReview", fb.lastRequest.Kind)
+	assert.Equal(t, "token", fb.lastRequest.Spec.Token)
+}
+
+func TestReviewConfiguredVersion(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":         fb.URL,
+		"RACKSPACE_MK8S_AUTH_API_VERSION": "authentication.k8s.io/v1beta1",
+		"RACKSPACE_MK8S_AUTH_KIND":        "TokenReview",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	// a mismatched response version is only warned about
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "authentication.k8s.io/v1beta1", fb.lastRequest.APIVersion)
+
+	fb.response.APIVersion = "authentication.k8s.io/v1beta1"
+	resp, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "authentication.k8s.io/v1beta1", resp.APIVersion)
+}
+
+func TestReviewMethod(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPost, fb.lastMethod)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_METHOD": "put"})()
+	a, err = setupAuth()
+	assert.Nil(t, err)
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPut, fb.lastMethod)
+	assert.Equal(t, "token", fb.lastRequest.Spec.Token)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_METHOD": "GET"})()
+	_, err = setupAuth()
+	assert.NotNil(t, err)
+}
+
+func TestReviewRequestMetadata(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	// the trace headers of the login request are propagated
+	_, err = a.review(models.AuthModel{
+		Principal: "alice",
+		Password:  "token",
+		Metadata: &models.RequestMetadata{
+			ClientIP:     "10.0.0.1",
+			TraceHeaders: map[string]string{"X-Request-Id": "req-1"},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "req-1", fb.lastHeader.Get("X-Request-Id"))
+	assert.Equal(t, "application/json", fb.lastHeader.Get("Content-Type"))
+
+	// and nothing is required without metadata
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Empty(t, fb.lastHeader.Get("X-Request-Id"))
+}
+
+func TestNormalizeAuthURL(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+		valid    bool
+	}{
+		{"http://app:8080", "http://app:8080", true},
+		{"https://auth.example.com/", "https://auth.example.com", true},
+		{"https://auth.example.com/k8s-auth//", "https://auth.example.com/k8s-auth", true},
+		{"https://auth.example.com/?tenant=1", "", false},
+		{"https://auth.example.com?", "", false},
+		{"https://auth.example.com/#top", "", false},
+		{"ftp://auth.example.com", "", false},
+		{"http:///authenticate", "", false},
+		{"auth.example.com", "", false},
+	}
+	for _, c := range cases {
+		normalized, err := normalizeAuthURL(c.in)
+		if !c.valid {
+			assert.NotNil(t, err, c.in)
+			continue
+		}
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.expected, normalized, c.in)
+	}
+}
+
+func TestReviewMalformedResponse(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	for _, body := range []string{
+		`{"apiVersion":"authentication.k8s.io/v1","kind":"TokenReview","status":{"authent`,
+		"<html>502 Bad Gateway</html>",
+		"\x00\xff\xfe garbage",
+		`{"status":{"user":{"username":"alice","extra":{"token":["eyJhbGciOiJSUzI1NiJ9.c2VjcmV0"]}}}`,
+	} {
+		fb.rawBody = []byte(body)
+		_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+		assert.True(t, errors.Is(err, ErrBackendProtocol), "%q: %v", body, err)
+		assert.Equal(t, conditionBackendProtocol, errorCondition(err))
+
+		protocolErr, ok := err.(*BackendProtocolError)
+		if assert.True(t, ok) {
+			assert.NotEmpty(t, protocolErr.ContentType)
+			assert.True(t, len(protocolErr.Snippet) <= maxSnippetLength+len("..."), protocolErr.Snippet)
+			assert.NotContains(t, protocolErr.Snippet, "eyJhbGciOiJSUzI1NiJ9")
+		}
+	}
+}
+
+func TestRedactedSnippet(t *testing.T) {
+	assert.Equal(t, `{"a":1}`, redactedSnippet([]byte(`{"a":1}`)))
+	assert.Equal(t, `{"token":"[REDACTED]"}`, redactedSnippet([]byte(`{"token":"abcdefghijklmnopqrstuvwxyz"}`)))
+	assert.Equal(t, "??bin", redactedSnippet([]byte("\x00\xffbin")))
+	assert.Equal(t, strings.Repeat("a b ", maxSnippetLength/4)+"...", redactedSnippet([]byte(strings.Repeat("a b ", 100))))
+}
+
+func TestSetupAuthInvalidURL(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": "https://auth.example.com/?tenant=1"})()
+
+	_, err := setupAuth()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "RACKSPACE_MK8S_AUTH_URL")
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_URL", "https://auth.example.com/")
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://auth.example.com", a.authURL)
+}
+
+func TestSetupAuthRequireHTTPS(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": "http://auth.example.com"})()
+
+	// http is allowed by default
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://auth.example.com", a.authURL)
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_REQUIRE_HTTPS": "true"})()
+	_, err = setupAuth()
+	assert.NotNil(t, err)
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_URL", "https://auth.example.com")
+	a, err = setupAuth()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://auth.example.com", a.authURL)
+}
+
+func TestSetupAuthInvalidCA(t *testing.T) {
+	f, err := ioutil.TempFile("", "ca")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("-----BEGIN CERTIFICATE-----\ngarbage\n-----END CERTIFICATE-----\n")
+	assert.Nil(t, err)
+	f.Close()
+
+	defer func(path string) { openStackCAPath = path }(openStackCAPath)
+	openStackCAPath = f.Name()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": "https://auth.example.com"})()
+
+	_, err = setupAuth()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), f.Name())
+
+	// the CA is only used for https
+	os.Setenv("RACKSPACE_MK8S_AUTH_URL", "http://auth.example.com")
+	_, err = setupAuth()
+	assert.Nil(t, err)
+}
+
+func TestAuthenticateVerifyPrincipal(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":              fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL":        "1m",
+		"RACKSPACE_MK8S_AUTH_VERIFY_PRINCIPAL": "true",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	// match
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+
+	// mismatch, from the backend and from the cache
+	_, err = a.Authenticate(models.AuthModel{Principal: "bob", Password: "other-token"})
+	assert.Equal(t, ErrPrincipalMismatch, err)
+	_, err = a.Authenticate(models.AuthModel{Principal: "bob", Password: "token"})
+	assert.Equal(t, ErrPrincipalMismatch, err)
+	assert.Equal(t, 2, fb.requests)
+}
+
+func TestAuthenticateVerifyPrincipalPrefixed(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":              fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL":        "1m",
+		"RACKSPACE_MK8S_AUTH_VERIFY_PRINCIPAL": "true",
+		"RACKSPACE_MK8S_AUTH_USERNAME_PREFIX":  "mk8s:",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	// the backend's username or the Harbor one, from the backend and from the cache
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "mk8s:alice", user.Username)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	_, err = a.Authenticate(models.AuthModel{Principal: "mk8s:alice", Password: "token"})
+	assert.Nil(t, err)
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "mk8s:bob", Password: "token"})
+	assert.Equal(t, ErrPrincipalMismatch, err)
+	assert.Equal(t, 1, fb.requests)
+}
+
+func TestAuthenticatePrincipalIgnored(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	// disabled by default, whatever is typed as the username
+	user, err := a.Authenticate(models.AuthModel{Principal: "anything", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", user.Username)
+}
+
+func TestAuthenticateMaintenance(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                 fb.URL,
+		"RACKSPACE_MK8S_AUTH_MAINTENANCE":         "true",
+		"RACKSPACE_MK8S_AUTH_MAINTENANCE_MESSAGE": "Registry logins are down until 14:00 UTC",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	if assert.IsType(t, &MaintenanceError{}, err) {
+		assert.EqualError(t, err, "Registry logins are down until 14:00 UTC")
+	}
+	assert.Equal(t, 0, fb.requests)
+
+	os.Unsetenv("RACKSPACE_MK8S_AUTH_MAINTENANCE_MESSAGE")
+	a, err = setupAuth()
+	assert.Nil(t, err)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.EqualError(t, err, "Authentication is disabled for maintenance, please try again later")
+	assert.Equal(t, 0, fb.requests)
+
+	os.Setenv("RACKSPACE_MK8S_AUTH_MAINTENANCE", "false")
+	a, err = setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fb.requests)
+}
+
+func TestAuthenticateInvalidToken(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+
+	for _, token := range []string{"", "   ", "\t\n"} {
+		_, err = a.Authenticate(models.AuthModel{Principal: "robot", Password: token})
+		assert.Equal(t, ErrInvalidToken, err, "%q", token)
+	}
+	assert.Equal(t, 0, fb.requests)
+
+	// a valid token is sent without its surrounding whitespace
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "  token\n"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fb.requests)
+	assert.Equal(t, "token", fb.lastRequest.Spec.Token)
+}
+
+func TestAuthenticateRejectsUnauthenticatedReview(t *testing.T) {
+	// a 200 TokenReview naming a user, but not authenticating the token
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	fb.response.Status.Authenticated = false
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	store := &fakeStore{}
+	a.resolver.Store = store
+
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Equal(t, ErrNotAuthenticated, err)
+	assert.Nil(t, user)
+	assert.Equal(t, 0, store.registers)
+	_, cached := a.cache.get("token")
+	assert.False(t, cached)
+
+	results := a.ValidateTokens(context.Background(), []BatchEntry{{Token: "token"}})
+	assert.Equal(t, ErrNotAuthenticated, results[0].Err)
+	assert.False(t, results[0].Authenticated)
+	assert.Equal(t, Identity{}, results[0].Identity)
+}
@@ -0,0 +1,118 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxTrackedIPs is the number of source IPs tracked before the idle ones are forgotten
+const maxTrackedIPs = 10000
+
+// ipBucket is the token bucket of a source IP
+type ipBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// ipRateLimiter throttles the login attempts of each source IP with a token bucket refilled at
+// perMinute attempts per minute, up to burst. A nil limiter never throttles.
+type ipRateLimiter struct {
+	perMinute int
+	burst     int
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*ipBucket
+}
+
+// newIPRateLimiter returns a limiter allowing perMinute attempts per minute per source IP,
+// or nil (unlimited) if perMinute <= 0. The burst defaults to perMinute.
+func newIPRateLimiter(perMinute, burst int) *ipRateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &ipRateLimiter{
+		perMinute: perMinute,
+		burst:     burst,
+		now:       time.Now,
+		buckets:   make(map[string]*ipBucket),
+	}
+}
+
+// ipRateLimit returns the per source IP limiter configured by RACKSPACE_MK8S_AUTH_IP_RATE_LIMIT
+// and RACKSPACE_MK8S_AUTH_IP_RATE_BURST, or nil when it's not set
+func ipRateLimit() (*ipRateLimiter, error) {
+	perMinute, err := envInt("RACKSPACE_MK8S_AUTH_IP_RATE_LIMIT", 0)
+	if err != nil {
+		return nil, err
+	}
+	burst, err := envInt("RACKSPACE_MK8S_AUTH_IP_RATE_BURST", 0)
+	if err != nil {
+		return nil, err
+	}
+	if burst < 0 {
+		return nil, fmt.Errorf("The env var RACKSPACE_MK8S_AUTH_IP_RATE_BURST is not a valid burst, expected 0 or more")
+	}
+	return newIPRateLimiter(perMinute, burst), nil
+}
+
+// allow takes an attempt from the bucket of ip and returns a TooManyAttemptsError if it's empty.
+// Attempts without a source IP are never throttled.
+func (l *ipRateLimiter) allow(ip string) error {
+	if l == nil || ip == "" {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := float64(l.perMinute) / float64(time.Minute)
+	b, ok := l.buckets[ip]
+	if !ok {
+		if len(l.buckets) >= maxTrackedIPs {
+			l.forgetIdle(now, rate)
+		}
+		b = &ipBucket{tokens: float64(l.burst), updated: now}
+		l.buckets[ip] = b
+	}
+
+	b.tokens = math.Min(float64(l.burst), b.tokens+rate*float64(now.Sub(b.updated)))
+	b.updated = now
+	if b.tokens < 1 {
+		return &TooManyAttemptsError{
+			ClientIP:   ip,
+			RetryAfter: time.Duration(math.Ceil((1 - b.tokens) / rate)),
+		}
+	}
+	b.tokens--
+	return nil
+}
+
+// forgetIdle drops the buckets which have refilled, since they behave like new ones
+func (l *ipRateLimiter) forgetIdle(now time.Time, rate float64) {
+	for ip, b := range l.buckets {
+		if b.tokens+rate*float64(now.Sub(b.updated)) >= float64(l.burst) {
+			delete(l.buckets, ip)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestAuthenticateIPRateLimit(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":           fb.URL,
+		"RACKSPACE_MK8S_AUTH_IP_RATE_LIMIT": "60",
+		"RACKSPACE_MK8S_AUTH_IP_RATE_BURST": "3",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.ipLimit.now = clock.now
+
+	attacker := &models.RequestMetadata{ClientIP: "10.0.0.1"}
+	for i := 0; i < 3; i++ {
+		_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "guess", Metadata: attacker})
+		assert.Nil(t, err)
+	}
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "guess", Metadata: attacker})
+	assert.True(t, errors.Is(err, ErrTooManyAttempts))
+	if e, ok := err.(*TooManyAttemptsError); assert.True(t, ok) {
+		assert.Equal(t, "10.0.0.1", e.ClientIP)
+		assert.Equal(t, time.Second, e.RetryAfter)
+	}
+	assert.Equal(t, 3, fb.requests)
+
+	// another IP is unaffected
+	other := &models.RequestMetadata{ClientIP: "10.0.0.2"}
+	_, err = a.Authenticate(models.AuthModel{Principal: "bob", Password: "token", Metadata: other})
+	assert.Nil(t, err)
+
+	// the bucket refills at the rate
+	clock.t = clock.t.Add(time.Second)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "guess", Metadata: attacker})
+	assert.Nil(t, err)
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "guess", Metadata: attacker})
+	assert.True(t, errors.Is(err, ErrTooManyAttempts))
+}
+
+func TestIPRateLimiter(t *testing.T) {
+	// off by default
+	l, err := ipRateLimit()
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+	assert.Nil(t, l.allow("10.0.0.1"))
+
+	l = newIPRateLimiter(1, 0)
+	assert.Equal(t, 1, l.burst)
+	assert.Nil(t, l.allow("10.0.0.1"))
+	assert.NotNil(t, l.allow("10.0.0.1"))
+
+	// attempts without a source IP aren't throttled
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, l.allow(""))
+	}
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_IP_RATE_BURST": "-1"})()
+	_, err = ipRateLimit()
+	assert.NotNil(t, err)
+}
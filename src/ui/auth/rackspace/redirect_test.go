@@ -0,0 +1,131 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestReviewRefusesCrossHostRedirect(t *testing.T) {
+	// the host the token must never reach
+	untrusted := newFakeBackend(t)
+	defer untrusted.Close()
+
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, untrusted.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer redirecting.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": redirecting.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), ErrUntrustedRedirect.Error())
+	}
+	assert.Equal(t, 0, untrusted.requests)
+}
+
+func TestReviewCrossHostRedirectNotRetried(t *testing.T) {
+	untrusted, one := newFakeBackend(t), newFakeBackend(t)
+	defer untrusted.Close()
+	defer one.Close()
+
+	redirects := 0
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirects++
+		http.Redirect(w, r, untrusted.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer redirecting.Close()
+	env := failoverEnv(&fakeBackend{Server: redirecting}, map[string]string{"ONE": one.URL}, "ONE")
+	env["RACKSPACE_MK8S_AUTH_RETRIES"] = "2"
+	env["RACKSPACE_MK8S_AUTH_BACKEND_HEALTH_EVENTS"] = "true"
+	defer setEnv(t, env)()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.True(t, errors.Is(err, ErrUntrustedRedirect))
+	assert.False(t, backendUnavailable(err))
+	// a single attempt, without failing over or marking the backend unhealthy
+	assert.Equal(t, 1, redirects)
+	assert.Equal(t, 0, one.requests)
+	assert.Equal(t, 0, untrusted.requests)
+	assert.Empty(t, a.health.hosts)
+}
+
+func TestReviewFollowsSameHostRedirect(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	backend := fb.Config.Handler
+	fb.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v2") {
+			http.Redirect(w, r, "/v2"+r.URL.Path, http.StatusTemporaryRedirect)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	})
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	resp, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.Status.User.Username)
+	assert.Equal(t, "token", fb.lastRequest.Spec.Token)
+}
+
+func TestCheckRedirectDowngrade(t *testing.T) {
+	original := &http.Request{URL: &url.URL{Scheme: "https", Host: "auth.example.com"}}
+	downgraded := &http.Request{URL: &url.URL{Scheme: "http", Host: "auth.example.com"}}
+	assert.Equal(t, ErrUntrustedRedirect, checkRedirect(downgraded, []*http.Request{original}))
+}
+
+func TestReviewRedirectWithoutLocation(t *testing.T) {
+	requests := 0
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer gateway.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":            gateway.URL,
+		"RACKSPACE_MK8S_AUTH_RETRIES":        "2",
+		"RACKSPACE_MK8S_AUTH_ERROR_DURATION": "true",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	if assert.IsType(t, &BackendProtocolError{}, err) {
+		assert.True(t, errors.Is(err, ErrBackendProtocol))
+		assert.Contains(t, err.Error(), "unexpected redirect status 302")
+		assert.Equal(t, conditionBackendProtocol, errorCondition(err))
+	}
+	// not retried
+	assert.Equal(t, 1, requests)
+}
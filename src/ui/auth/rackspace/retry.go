@@ -0,0 +1,95 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// by default every successful request earns a tenth of a retry, up to 10 retries saved up
+	defaultRetryBudgetRatio = 0.1
+	defaultRetryBudgetMax   = 10
+)
+
+// retryBudget is a token bucket limiting retries to a fraction of the successful requests, so that
+// retries across Harbor replicas can't amplify the load on kubernetes-auth during an incident.
+// Every success deposits ratio tokens, up to max, and every retry withdraws a whole token.
+type retryBudget struct {
+	sync.Mutex
+	tokens float64
+	ratio  float64
+	max    float64
+}
+
+// newRetryBudget returns a full budget
+func newRetryBudget(ratio, max float64) *retryBudget {
+	return &retryBudget{
+		tokens: max,
+		ratio:  ratio,
+		max:    max,
+	}
+}
+
+func newRetryBudgetFromEnv() (*retryBudget, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_RETRY_BUDGET_RATIO"
+
+	ratio := defaultRetryBudgetRatio
+	if v := strings.TrimSpace(os.Getenv(envVar)); v != "" {
+		var err error
+		if ratio, err = strconv.ParseFloat(v, 64); err != nil || ratio < 0 {
+			return nil, fmt.Errorf("The env var %s is not a valid ratio %s", envVar, v)
+		}
+	}
+
+	max, err := envInt("RACKSPACE_MK8S_AUTH_RETRY_BUDGET_MAX", defaultRetryBudgetMax)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRetryBudget(ratio, float64(max)), nil
+}
+
+// deposit credits the budget for a successful request
+func (b *retryBudget) deposit() {
+	b.Lock()
+	defer b.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// withdraw takes a token for a retry, it returns false if the budget is exhausted
+func (b *retryBudget) withdraw() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// remaining returns the number of retries currently allowed
+func (b *retryBudget) remaining() float64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.tokens
+}
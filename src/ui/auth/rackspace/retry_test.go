@@ -0,0 +1,159 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestRetryBudget(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                fb.URL,
+		"RACKSPACE_MK8S_AUTH_RETRIES":            "1",
+		"RACKSPACE_MK8S_AUTH_RETRY_BUDGET_RATIO": "0.5",
+		"RACKSPACE_MK8S_AUTH_RETRY_BUDGET_MAX":   "2",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Equal(t, float64(2), a.Stats().RetryBudget)
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	// each failing review retries once until the budget is exhausted
+	fb.status = http.StatusServiceUnavailable
+	for _, expectedRequests := range []int{2, 4, 5, 6} {
+		_, err = a.review(m)
+		assert.NotNil(t, err)
+		assert.Equal(t, expectedRequests, fb.requests)
+	}
+	assert.Equal(t, float64(0), a.Stats().RetryBudget)
+
+	// successes refill it
+	fb.status = 0
+	for i := 0; i < 2; i++ {
+		_, err = a.review(m)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, float64(1), a.Stats().RetryBudget)
+
+	fb.status = http.StatusServiceUnavailable
+	fb.requests = 0
+	a.review(m)
+	assert.Equal(t, 2, fb.requests)
+	assert.Equal(t, float64(0), a.Stats().RetryBudget)
+}
+
+func TestNoRetryOnRejection(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":     fb.URL,
+		"RACKSPACE_MK8S_AUTH_RETRIES": "3",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	fb.status = http.StatusUnauthorized
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, fb.requests)
+}
+
+// transportFunc is a transport returning the answers of a function
+type transportFunc func() ([]byte, http.Header, error)
+
+func (f transportFunc) send(ctx context.Context, m models.AuthModel, authRequestBody []byte) ([]byte, http.Header, error) {
+	return f()
+}
+
+func TestRetryOnPoolExhaustion(t *testing.T) {
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_RETRIES": "1"})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	// the client can't dial since every local port is in use
+	attempts := 0
+	a.transport = transportFunc(func() ([]byte, http.Header, error) {
+		attempts++
+		return nil, nil, &url.Error{Op: "Post", URL: a.authURL, Err: &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: os.NewSyscallError("connect", syscall.EADDRNOTAVAIL),
+		}}
+	})
+
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.True(t, errors.Is(err, ErrBackendUnavailable))
+	assert.True(t, errors.Is(err, syscall.EADDRNOTAVAIL))
+	assert.Equal(t, conditionUnavailable, errorCondition(err))
+	assert.True(t, backendUnavailable(err))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestConnectionError(t *testing.T) {
+	for _, err := range []error{
+		&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("socket", syscall.EMFILE)},
+		&url.Error{Op: "Post", URL: "http://app:8080", Err: &net.DNSError{Err: "no such host", Name: "app"}},
+		&url.Error{Op: "Post", URL: "http://app:8080", Err: io.EOF},
+		fmt.Errorf("read: %w", syscall.ECONNRESET),
+	} {
+		assert.True(t, errors.Is(connectionError(err), ErrBackendUnavailable), "%v", err)
+	}
+
+	for _, err := range []error{
+		ErrUntrustedRedirect,
+		&url.Error{Op: "Post", URL: "http://app:8080", Err: ErrUntrustedRedirect},
+	} {
+		assert.Equal(t, err, connectionError(err))
+	}
+}
+
+func TestBackendUnavailable(t *testing.T) {
+	for _, err := range []error{
+		&statusError{code: http.StatusBadGateway},
+		fmt.Errorf("review: %w", &statusError{code: http.StatusServiceUnavailable}),
+		&BackendConnectionError{Err: io.EOF},
+		context.DeadlineExceeded,
+	} {
+		assert.True(t, backendUnavailable(err), "%v", err)
+	}
+
+	for _, err := range []error{
+		&statusError{code: http.StatusUnauthorized},
+		&BackendProtocolError{Err: errors.New("unexpected end of JSON input")},
+		ErrOverloaded,
+		ErrUntrustedRedirect,
+		ErrNotAuthenticated,
+		errors.New("unknown"),
+	} {
+		assert.False(t, backendUnavailable(err), "%v", err)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// serviceAccounts is the allowlist of the client certificate subjects of automated systems, mapped
+// to the existing Harbor users they authenticate as, e.g. {"CN=ci,O=Acme": "robot-ci"}. A request
+// whose verified client certificate has a listed subject is authenticated without a token nor a
+// call to the backend. Subjects which aren't listed go through the token flow as usual.
+type serviceAccounts map[string]string
+
+// serviceAccountConfig returns the configured service accounts, or nil when none are allowed
+func serviceAccountConfig() (serviceAccounts, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_SERVICE_ACCOUNTS"
+
+	return parseServiceAccounts(os.Getenv(envVar))
+}
+
+func parseServiceAccounts(s string) (serviceAccounts, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	sa := serviceAccounts{}
+	if err := json.Unmarshal([]byte(s), &sa); err != nil {
+		return nil, fmt.Errorf("invalid service accounts, expected a JSON object of certificate subject to username: %v", err)
+	}
+	for subject, username := range sa {
+		if strings.TrimSpace(subject) == "" || strings.TrimSpace(username) == "" {
+			return nil, fmt.Errorf("invalid service account %q=%q, expected a certificate subject and a username", subject, username)
+		}
+	}
+
+	return sa, nil
+}
+
+// username returns the Harbor username of the verified client certificate of m, or "" when it has
+// none or its subject isn't allowed
+func (sa serviceAccounts) username(m models.AuthModel) string {
+	if len(sa) == 0 || m.Metadata == nil || m.Metadata.ClientCertSubject == "" {
+		return ""
+	}
+	return sa[m.Metadata.ClientCertSubject]
+}
+
+// authenticateServiceAccount returns the Harbor user of a service account. The user must already
+// exist: service accounts are never created, renamed or synced, and can't be Harbor's admin.
+func (a *Auth) authenticateServiceAccount(m models.AuthModel, username string) (*models.User, error) {
+	subject := m.Metadata.ClientCertSubject
+	if a.resolver.isAdmin(username) {
+		log.Warningf("ClientCertSubject=%q Rejected, the service account is mapped to the admin", subject)
+		return nil, a.errorMessages.translate(m, ErrReservedUsername)
+	}
+
+	user, err := a.resolver.Store.GetUser(models.User{Username: username})
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		log.Warningf("ClientCertSubject=%q BackendUsername=%s Rejected, the service user doesn't exist", subject, username)
+		return nil, a.errorMessages.translate(m, ErrUnknownServiceAccount)
+	}
+
+	log.Debugf("ClientCertSubject=%q BackendUsername=%s Authenticated by client certificate", subject, username)
+	return user, nil
+}
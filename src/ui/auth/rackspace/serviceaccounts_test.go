@@ -0,0 +1,76 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestParseServiceAccounts(t *testing.T) {
+	sa, err := parseServiceAccounts("")
+	assert.Nil(t, err)
+	assert.Nil(t, sa)
+
+	sa, err = parseServiceAccounts(`{"CN=ci,O=Acme": "robot-ci"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, serviceAccounts{"CN=ci,O=Acme": "robot-ci"}, sa)
+
+	for _, invalid := range []string{`CN=ci=robot-ci`, `{"CN=ci": ""}`, `{"": "robot-ci"}`, `{"CN=ci": 1}`} {
+		_, err := parseServiceAccounts(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestAuthenticateServiceAccount(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":              fb.URL,
+		"RACKSPACE_MK8S_AUTH_SERVICE_ACCOUNTS": `{"CN=ci,O=Acme": "robot-ci", "CN=gone": "robot-gone", "CN=root": "admin"}`,
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{users: []models.User{
+		{UserID: 1, Username: "admin"},
+		{UserID: 7, Username: "robot-ci", Realname: "robot-ci"},
+	}}
+	withCert := func(subject string) models.AuthModel {
+		return models.AuthModel{Metadata: &models.RequestMetadata{ClientCertSubject: subject}}
+	}
+
+	// an allowed certificate resolves to its service user without a token nor a backend call
+	user, err := a.Authenticate(withCert("CN=ci,O=Acme"))
+	assert.Nil(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, 7, user.UserID)
+		assert.Equal(t, "robot-ci", user.Username)
+	}
+	assert.Equal(t, 0, fb.requests)
+
+	// other certificates go through the token flow
+	_, err = a.Authenticate(withCert("CN=other"))
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// service users are never created, nor can they be the admin
+	_, err = a.Authenticate(withCert("CN=gone"))
+	assert.Equal(t, ErrUnknownServiceAccount, err)
+	_, err = a.Authenticate(withCert("CN=root"))
+	assert.Equal(t, ErrReservedUsername, err)
+	assert.Equal(t, 0, fb.requests)
+}
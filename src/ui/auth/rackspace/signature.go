@@ -0,0 +1,60 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+)
+
+// signatureHeader carries the hex encoded HMAC-SHA256 of the response body
+const signatureHeader = "X-Auth-Signature"
+
+// responseHMACKey returns the shared secret used to verify backend responses, or nil if verification is disabled
+func responseHMACKey() []byte {
+	const envVar = "RACKSPACE_MK8S_AUTH_RESPONSE_HMAC_KEY"
+
+	key := os.Getenv(envVar)
+	if len(key) == 0 {
+		return nil
+	}
+	return []byte(key)
+}
+
+// signBody returns the hex encoded HMAC-SHA256 of body using key
+func signBody(key, body []byte) string {
+	return hex.EncodeToString(hmacSum(key, body))
+}
+
+// verifySignature checks signature against the HMAC of body. Verification is skipped when key is empty.
+func verifySignature(key, body []byte, signature string) error {
+	if len(key) == 0 {
+		return nil
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, hmacSum(key, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func hmacSum(key, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
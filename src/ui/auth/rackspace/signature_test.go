@@ -0,0 +1,64 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestResponseSignature(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":               fb.URL,
+		"RACKSPACE_MK8S_AUTH_RESPONSE_HMAC_KEY": "shared-secret",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	// valid signature
+	fb.hmacKey = []byte("shared-secret")
+	resp, err := a.review(m)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.Status.User.Username)
+
+	// signed with the wrong key
+	fb.hmacKey = []byte("not-the-secret")
+	_, err = a.review(m)
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	// not signed at all
+	fb.hmacKey = nil
+	_, err = a.review(m)
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestResponseSignatureDisabled(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	fb.hmacKey = []byte("anything")
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,103 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// cacheSnapshotVersion is the version of the snapshot format
+const cacheSnapshotVersion = 1
+
+// cacheSnapshot is the persisted form of the user cache. Entries are keyed by the token hashes,
+// the tokens themselves are never persisted.
+type cacheSnapshot struct {
+	Version int                  `json:"version"`
+	Entries []cacheSnapshotEntry `json:"entries"`
+}
+
+type cacheSnapshotEntry struct {
+	Key     string      `json:"key"`
+	User    models.User `json:"user"`
+	Created time.Time   `json:"created"`
+}
+
+// SaveCacheSnapshot writes the cached users to w, e.g. for a sidecar to persist them across restarts.
+// Nothing is cached when caching is disabled, so an empty snapshot is written.
+func (a *Auth) SaveCacheSnapshot(w io.Writer) error {
+	return json.NewEncoder(w).Encode(a.cache.snapshot())
+}
+
+// LoadCacheSnapshot adds the users of a snapshot written by SaveCacheSnapshot to the cache.
+// Entries which have expired since are dropped. It is a no-op when caching is disabled.
+func (a *Auth) LoadCacheSnapshot(r io.Reader) error {
+	var s cacheSnapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("invalid cache snapshot: %v", err)
+	}
+	if s.Version != cacheSnapshotVersion {
+		return fmt.Errorf("unsupported cache snapshot version %d", s.Version)
+	}
+
+	loaded := a.cache.restore(s)
+	log.Infof("Loaded %d of %d cached users from snapshot", loaded, len(s.Entries))
+	return nil
+}
+
+func (c *userCache) snapshot() cacheSnapshot {
+	s := cacheSnapshot{Version: cacheSnapshotVersion, Entries: []cacheSnapshotEntry{}}
+	if c == nil {
+		return s
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for key, e := range c.entries {
+		// the password is random but still valid for the database, it must not leave the process
+		user := e.user
+		user.Password = ""
+		user.Salt = ""
+		user.ResetUUID = ""
+		s.Entries = append(s.Entries, cacheSnapshotEntry{Key: key, User: user, Created: e.created})
+	}
+	return s
+}
+
+// restore adds the unexpired entries of s to the cache and returns how many were added
+func (c *userCache) restore(s cacheSnapshot) int {
+	if c == nil {
+		return 0
+	}
+
+	ttl := c.ttl.get()
+
+	c.Lock()
+	defer c.Unlock()
+	loaded := 0
+	for _, e := range s.Entries {
+		if c.now().Sub(e.Created) >= ttl {
+			continue
+		}
+		c.set(e.Key, newCacheEntry(e.User, e.Created))
+		loaded++
+	}
+	return loaded
+}
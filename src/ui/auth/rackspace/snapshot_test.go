@@ -0,0 +1,83 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestCacheSnapshotRoundTrip(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":       fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	clock := &fakeClock{t: time.Now()}
+	a.cache.now = clock.now
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "old-token"})
+	assert.Nil(t, err)
+	clock.t = clock.t.Add(45 * time.Second)
+	user, err := a.Authenticate(models.AuthModel{Principal: "alice", Password: "new-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fb.requests)
+
+	var buf bytes.Buffer
+	assert.Nil(t, a.SaveCacheSnapshot(&buf))
+	assert.False(t, strings.Contains(buf.String(), "old-token"), "the tokens must not be persisted")
+	assert.False(t, strings.Contains(buf.String(), "new-token"), "the tokens must not be persisted")
+	assert.False(t, strings.Contains(buf.String(), user.Password), "the passwords must not be persisted")
+
+	// restart 30s later, when the old token's entry has expired
+	restarted, err := setupAuth()
+	assert.Nil(t, err)
+	restarted.resolver.Store = &fakeStore{}
+	clock.t = clock.t.Add(30 * time.Second)
+	restarted.cache.now = clock.now
+	assert.Nil(t, restarted.LoadCacheSnapshot(&buf))
+
+	cached, err := restarted.Authenticate(models.AuthModel{Principal: "alice", Password: "new-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, cached.UserID)
+	assert.Equal(t, "alice", cached.Username)
+	assert.Equal(t, 2, fb.requests)
+
+	_, err = restarted.Authenticate(models.AuthModel{Principal: "alice", Password: "old-token"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fb.requests)
+}
+
+func TestLoadCacheSnapshotInvalid(t *testing.T) {
+	a := &Auth{}
+	assert.NotNil(t, a.LoadCacheSnapshot(strings.NewReader("not json")))
+	assert.NotNil(t, a.LoadCacheSnapshot(strings.NewReader(`{"version": 2, "entries": []}`)))
+
+	// a disabled cache saves nothing and ignores snapshots
+	var buf bytes.Buffer
+	assert.Nil(t, a.SaveCacheSnapshot(&buf))
+	assert.JSONEq(t, `{"version": 1, "entries": []}`, buf.String())
+	assert.Nil(t, a.LoadCacheSnapshot(&buf))
+}
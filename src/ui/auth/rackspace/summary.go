@@ -0,0 +1,170 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// logConfigSummary logs the effective settings of a on one line, so operators don't have to
+// piece them together from the env vars and the scattered warnings
+func logConfigSummary(a *Auth) {
+	log.Infof("Rackspace Managed Auth settings: %s", configSummary(a))
+}
+
+// configSummary returns the effective settings of a as key=value pairs. Secrets are never
+// included: the password of the URL is redacted and keys are only reported as set or not.
+func configSummary(a *Auth) string {
+	protocol := protocolHTTP
+	switch t := a.transport.(type) {
+	case *grpcTransport:
+		protocol = protocolGRPC
+	case *httpTransport:
+		protocol += "," + t.method
+	}
+
+	cache := "off"
+	if a.cache != nil {
+		cache = fmt.Sprintf("ttl=%v", a.cache.ttl.base)
+		if a.cache.ttl.adaptive {
+			cache += fmt.Sprintf(",adaptive,max=%v", a.cache.ttl.max)
+		}
+		if a.cache.reverifyInterval > 0 {
+			cache += fmt.Sprintf(",reverify=%v", a.cache.reverifyInterval)
+		}
+		if a.cache.maxEntries > 0 {
+			cache += fmt.Sprintf(",maxEntries=%d", a.cache.maxEntries)
+		}
+	}
+
+	negativeCache := "off"
+	if a.negativeCache != nil {
+		negativeCache = fmt.Sprintf("ttl=%v", a.negativeCache.ttl)
+	}
+
+	maxInflight := "unlimited"
+	if a.inflight != nil {
+		maxInflight = fmt.Sprint(cap(a.inflight))
+	}
+
+	ipRateLimit := "off"
+	if a.ipLimit != nil {
+		ipRateLimit = fmt.Sprintf("%d/min,burst=%d", a.ipLimit.perMinute, a.ipLimit.burst)
+	}
+
+	audiences := "off"
+	if a.audiences != nil {
+		audiences = fmt.Sprintf("%s:%s", a.audiences.match, strings.Join(a.audiences.audiences, ","))
+	}
+
+	usernameClaim := "off"
+	if a.usernameClaim != "" {
+		usernameClaim = a.usernameClaim
+	}
+
+	localVerify := "off"
+	if a.localVerifier != nil {
+		localVerify = fmt.Sprintf("revocationCheck=%s", a.localVerifier.revocationCheck)
+	}
+
+	offboardGrace := "off"
+	if a.offboardGrace != nil {
+		offboardGrace = a.offboardGrace.grace.String()
+	}
+
+	loginEvents := "off"
+	if a.loginEvents != nil {
+		loginEvents = fmt.Sprintf("1/%d", a.loginEvents.every)
+	}
+
+	failover := a.router.describeFailover()
+	if failover != "off" {
+		failover += fmt.Sprintf(",maxAttempts=%d", a.failoverLimits.maxAttempts)
+		if a.failoverLimits.budget > 0 {
+			failover += fmt.Sprintf(",budget=%v", a.failoverLimits.budget)
+		}
+	}
+
+	health := "off"
+	if a.health != nil {
+		health = fmt.Sprintf("interval=%v", a.health.interval)
+	}
+
+	settings := []string{
+		fmt.Sprintf("url=%q", redactedURL(a.authURL)),
+		fmt.Sprintf("protocol=%s", protocol),
+		fmt.Sprintf("fake=%s", onOff(a.fake)),
+		fmt.Sprintf("apiVersion=%q", a.apiVersion),
+		fmt.Sprintf("kind=%q", a.kind),
+		fmt.Sprintf("timeout=%v", a.timeout),
+		fmt.Sprintf("tls=%s", tlsMode(a.authURL)),
+		fmt.Sprintf("cache=%s", cache),
+		fmt.Sprintf("negativeCache=%s", negativeCache),
+		fmt.Sprintf("retries=%d", a.retries),
+		fmt.Sprintf("sloLatency=%v", a.metrics.sloLatency),
+		fmt.Sprintf("maxInflight=%s", maxInflight),
+		fmt.Sprintf("ipRateLimit=%s", ipRateLimit),
+		fmt.Sprintf("responseSigning=%s", onOff(a.hmacKey != nil)),
+		fmt.Sprintf("localVerify=%s", localVerify),
+		fmt.Sprintf("audiences=%s", audiences),
+		fmt.Sprintf("verifyPrincipal=%s", onOff(a.verifyPrincipal)),
+		fmt.Sprintf("usernameClaim=%s", usernameClaim),
+		fmt.Sprintf("groupSync=%s", onOff(a.resolver.Groups != nil)),
+		fmt.Sprintf("emailDomains=%d", len(a.resolver.emailDomains)),
+		fmt.Sprintf("maintenance=%s", onOff(a.maintenance != nil)),
+		fmt.Sprintf("audit=%s", onOff(a.auditor != nil)),
+		fmt.Sprintf("metricsPush=%s", onOff(a.pusher != nil)),
+		fmt.Sprintf("serviceAccounts=%d", len(a.serviceAccounts)),
+		fmt.Sprintf("errorDuration=%s", onOff(a.errorDuration)),
+		fmt.Sprintf("offboardGrace=%s", offboardGrace),
+		fmt.Sprintf("loginEvents=%s", loginEvents),
+		fmt.Sprintf("redactedHeaders=%d", len(a.redactedHeaders)),
+		fmt.Sprintf("backendRoutes=%s", a.router.describe()),
+		fmt.Sprintf("failover=%s", failover),
+		fmt.Sprintf("backendHealth=%s", health),
+	}
+	return strings.Join(settings, " ")
+}
+
+// tlsMode describes how the backend's certificate is verified
+func tlsMode(authURL string) string {
+	if !strings.HasPrefix(authURL, "https") {
+		return "off"
+	}
+	if needCustomCert(authURL, openStackCAPath) {
+		return "system+" + openStackCAPath
+	}
+	return "system"
+}
+
+// redactedURL returns rawURL with the password of its user info, if any, redacted
+func redactedURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[REDACTED]"
+	}
+	return u.Redacted()
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,163 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestBackendTimeouts(t *testing.T) {
+	timeouts, err := backendTimeouts()
+	assert.Nil(t, err)
+	assert.Equal(t, clientTimeouts{connect: defaultTimeout, total: defaultTimeout}, timeouts)
+
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_TIMEOUT":                 "1m",
+		"RACKSPACE_MK8S_AUTH_CONNECT_TIMEOUT":         "2s",
+		"RACKSPACE_MK8S_AUTH_RESPONSE_HEADER_TIMEOUT": "45s",
+	})()
+	timeouts, err = backendTimeouts()
+	assert.Nil(t, err)
+	assert.Equal(t, clientTimeouts{connect: 2 * time.Second, responseHeader: 45 * time.Second, total: time.Minute}, timeouts)
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// a backend which accepts connections but never completes the TLS handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":             "https://" + l.Addr().String(),
+		"RACKSPACE_MK8S_AUTH_TIMEOUT":         "10s",
+		"RACKSPACE_MK8S_AUTH_CONNECT_TIMEOUT": "100ms",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	start := time.Now()
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second, "expected to fail on the connect timeout, took %v", time.Since(start))
+}
+
+func TestSlowBackendWithinTotalTimeout(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fb.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":             slow.URL,
+		"RACKSPACE_MK8S_AUTH_TIMEOUT":         "10s",
+		"RACKSPACE_MK8S_AUTH_CONNECT_TIMEOUT": "50ms",
+	})()
+
+	// a short connect timeout doesn't limit a slow answer
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	resp, err := a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.Status.User.Username)
+
+	// but the response header timeout does
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_RESPONSE_HEADER_TIMEOUT": "50ms"})()
+	a, err = setupAuth()
+	assert.Nil(t, err)
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.NotNil(t, err)
+}
+
+func TestErrorDuration(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer slow.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":     slow.URL,
+		"RACKSPACE_MK8S_AUTH_TIMEOUT": "150ms",
+		"RACKSPACE_MK8S_AUTH_RETRIES": "0",
+	})()
+
+	// off by default
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "secret-token"})
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "Duration=")
+
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_ERROR_DURATION": "true"})()
+	a, err = setupAuth()
+	assert.Nil(t, err)
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "secret-token"})
+	if assert.IsType(t, &BackendUnavailableError{}, err) {
+		e := err.(*BackendUnavailableError)
+		assert.True(t, e.TimedOut)
+		assert.False(t, e.Canceled)
+		assert.True(t, e.Duration >= 150*time.Millisecond && e.Duration < 450*time.Millisecond, "waited %v", e.Duration)
+		assert.Contains(t, err.Error(), "Duration=")
+		assert.NotContains(t, err.Error(), "secret-token")
+	}
+}
+
+func TestErrorDurationServerError(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	fb.status = http.StatusServiceUnavailable
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":            fb.URL,
+		"RACKSPACE_MK8S_AUTH_RETRIES":        "0",
+		"RACKSPACE_MK8S_AUTH_ERROR_DURATION": "true",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	if assert.IsType(t, &BackendUnavailableError{}, err) {
+		assert.False(t, err.(*BackendUnavailableError).TimedOut)
+		assert.Equal(t, conditionServerError, errorCondition(err))
+	}
+
+	// rejected tokens aren't unavailable backends
+	fb.status = http.StatusUnauthorized
+	_, err = a.review(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.IsType(t, &statusError{}, err)
+}
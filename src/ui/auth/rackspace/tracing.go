@@ -0,0 +1,78 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import "context"
+
+// the spans of a login
+const (
+	spanAuthenticate = "rackspace.Authenticate"
+	spanCacheGet     = "rackspace.cache.get"
+	spanReview       = "rackspace.backend.review"
+	spanResolve      = "rackspace.db.resolve"
+)
+
+// the attributes of the spans, none of them identifies the user
+const (
+	attrOutcome   = "auth.outcome"
+	attrCacheHit  = "auth.cache.hit"
+	attrBackend   = "auth.backend.url"
+	attrCondition = "auth.error.condition"
+)
+
+// Tracer starts the spans of the auth flow. It is the subset of OpenTelemetry's trace.Tracer used
+// by the authenticator, so an OpenTelemetry tracer is plugged in with a small adapter and the
+// package doesn't depend on OpenTelemetry when tracing is disabled, which it is by default.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) End()                                       {}
+
+// RegisterTracer sets the tracer of the registered authenticator. It must be called before any
+// login is served.
+func RegisterTracer(t Tracer) {
+	registered.tracer = t
+}
+
+// startSpan starts a span with the tracer, or a no-op span when there's none
+func (a *Auth) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if a.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return a.tracer.Start(ctx, name)
+}
+
+// endSpan sets the outcome of err on span and ends it
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.SetAttribute(attrOutcome, outcomeFailure)
+		if condition := errorCondition(err); condition != "" {
+			span.SetAttribute(attrCondition, condition)
+		}
+	} else {
+		span.SetAttribute(attrOutcome, outcomeSuccess)
+	}
+	span.End()
+}
@@ -0,0 +1,131 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// memorySpan is a span kept in memory by a memoryTracer
+type memorySpan struct {
+	tracer     *memoryTracer
+	name       string
+	parent     string
+	attributes map[string]interface{}
+}
+
+func (s *memorySpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *memorySpan) End() {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.tracer.ended = append(s.tracer.ended, s)
+}
+
+type spanKey struct{}
+
+// memoryTracer records the ended spans, like an in-memory exporter
+type memoryTracer struct {
+	mutex sync.Mutex
+	ended []*memorySpan
+}
+
+func (t *memoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &memorySpan{tracer: t, name: name, attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*memorySpan); ok {
+		s.parent = parent.name
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *memoryTracer) names() []string {
+	var names []string
+	for _, s := range t.ended {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func TestAuthenticateSpans(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":       fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL": "1m",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	tracer := &memoryTracer{}
+	a.tracer = tracer
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{spanCacheGet, spanReview, spanResolve, spanAuthenticate}, tracer.names())
+	for _, s := range tracer.ended[:3] {
+		assert.Equal(t, spanAuthenticate, s.parent, s.name)
+	}
+	assert.Equal(t, false, tracer.ended[0].attributes[attrCacheHit])
+	assert.Equal(t, outcomeSuccess, tracer.ended[1].attributes[attrOutcome])
+	assert.Equal(t, fb.URL, tracer.ended[1].attributes[attrBackend])
+	assert.Equal(t, outcomeSuccess, tracer.ended[3].attributes[attrOutcome])
+
+	// from the cache
+	tracer.ended = nil
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{spanCacheGet, spanAuthenticate}, tracer.names())
+	assert.Equal(t, true, tracer.ended[0].attributes[attrCacheHit])
+
+	// rejected by the backend
+	tracer.ended = nil
+	fb.status = http.StatusUnauthorized
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "other-token"})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{spanCacheGet, spanReview, spanAuthenticate}, tracer.names())
+	assert.Equal(t, outcomeFailure, tracer.ended[1].attributes[attrOutcome])
+	assert.Equal(t, conditionUnauthorized, tracer.ended[1].attributes[attrCondition])
+	assert.Equal(t, outcomeFailure, tracer.ended[2].attributes[attrOutcome])
+
+	// no span attribute identifies the user
+	for _, s := range tracer.ended {
+		for _, v := range s.attributes {
+			assert.NotContains(t, []interface{}{"alice", "uid-alice", "token", "other-token"}, v)
+		}
+	}
+}
+
+func TestAuthenticateWithoutTracer(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	a.resolver.Store = &fakeStore{}
+	assert.Nil(t, a.tracer)
+
+	_, err = a.Authenticate(models.AuthModel{Principal: "alice", Password: "token"})
+	assert.Nil(t, err)
+}
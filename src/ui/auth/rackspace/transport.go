@@ -0,0 +1,133 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// protocols of kubernetes-auth, set with RACKSPACE_MK8S_AUTH_PROTOCOL
+const (
+	protocolHTTP = "http"
+	protocolGRPC = "grpc"
+)
+
+// transport sends a TokenReview to kubernetes-auth. The request and response bodies are JSON
+// TokenReviews whatever the protocol, so the field mapping and the user logic are shared.
+// A review rejected by the backend is returned as a *statusError, any other error is a
+// transport error.
+type transport interface {
+	send(ctx context.Context, m models.AuthModel, authRequestBody []byte) (authRespBody []byte, header http.Header, err error)
+}
+
+// backendTransport returns the transport of the configured protocol, HTTP by default
+func backendTransport(authURL, caPath string, timeouts clientTimeouts, headers http.Header) (transport, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_PROTOCOL"
+
+	switch protocol := strings.ToLower(envOrDefault(envVar, protocolHTTP)); protocol {
+	case protocolHTTP:
+		method, err := requestMethod()
+		if err != nil {
+			return nil, err
+		}
+		client, err := getClient(authURL, caPath, timeouts)
+		if err != nil {
+			return nil, err
+		}
+		return &httpTransport{
+			client:  client,
+			method:  method,
+			url:     authURL + "/authenticate/token",
+			headers: headers,
+		}, nil
+	case protocolGRPC:
+		return newGRPCTransport(authURL, caPath, timeouts, headers)
+	default:
+		return nil, fmt.Errorf("The env var %s is not a valid protocol, expected %q or %q", envVar, protocolHTTP, protocolGRPC)
+	}
+}
+
+// requestMethod returns the HTTP method of the TokenReview requests from RACKSPACE_MK8S_AUTH_METHOD,
+// POST by default. Only the methods sending a body are allowed.
+func requestMethod() (string, error) {
+	const envVar = "RACKSPACE_MK8S_AUTH_METHOD"
+
+	switch method := strings.ToUpper(envOrDefault(envVar, http.MethodPost)); method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return method, nil
+	default:
+		return "", fmt.Errorf("The env var %s is not a valid method %s, expected %s, %s or %s", envVar, method, http.MethodPost, http.MethodPut, http.MethodPatch)
+	}
+}
+
+// requestHeaders sets the configured extra headers and the tracing headers of the login on req
+func requestHeaders(req *http.Request, m models.AuthModel, headers http.Header) {
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+
+	// propagate the tracing headers of the login request, when the caller provided them
+	if m.Metadata != nil {
+		for k, v := range m.Metadata.TraceHeaders {
+			req.Header.Set(k, v)
+		}
+	}
+}
+
+// httpTransport sends the TokenReview as JSON with the configured method, POST by default
+type httpTransport struct {
+	client  *http.Client
+	method  string
+	url     string
+	headers http.Header
+}
+
+func (t *httpTransport) send(ctx context.Context, m models.AuthModel, authRequestBody []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, t.method, t.url, bytes.NewReader(authRequestBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	requestHeaders(req, m, t.headers)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	authRespBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the client follows the same-host redirects, any other one, e.g. the 302 without a Location
+	// of a misconfigured gateway, isn't an answer of the backend
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		err := fmt.Errorf("unexpected redirect status %d Location=%q", resp.StatusCode, resp.Header.Get("Location"))
+		return nil, resp.Header, newBackendProtocolError(resp.Header.Get("Content-Type"), authRespBody, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.Header, &statusError{code: resp.StatusCode, body: authRespBody}
+	}
+	return authRespBody, resp.Header, nil
+}
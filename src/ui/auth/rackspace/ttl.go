@@ -0,0 +1,78 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"sync"
+	"time"
+)
+
+// adaptiveTTL is the cache TTL policy. When adaptive, the TTL doubles on every backend
+// failure up to max, so cached users ride out backend blips, and halves back down to base
+// on every success so results stay fresh while the backend is healthy.
+type adaptiveTTL struct {
+	sync.Mutex
+	base     time.Duration
+	max      time.Duration
+	current  time.Duration
+	adaptive bool
+}
+
+func newAdaptiveTTL(base, max time.Duration, adaptive bool) *adaptiveTTL {
+	if max < base {
+		max = base
+	}
+	return &adaptiveTTL{
+		base:     base,
+		max:      max,
+		current:  base,
+		adaptive: adaptive,
+	}
+}
+
+// get returns the effective TTL
+func (t *adaptiveTTL) get() time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.current
+}
+
+// backendFailed lengthens the TTL after a transport error or a 5xx response
+func (t *adaptiveTTL) backendFailed() {
+	if !t.adaptive {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.current *= 2
+	if t.current > t.max {
+		t.current = t.max
+	}
+}
+
+// backendSucceeded shortens the TTL back towards base
+func (t *adaptiveTTL) backendSucceeded() {
+	if !t.adaptive {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.current /= 2
+	if t.current < t.base {
+		t.current = t.base
+	}
+}
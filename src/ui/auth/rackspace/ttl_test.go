@@ -0,0 +1,70 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestAdaptiveTTL(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{
+		"RACKSPACE_MK8S_AUTH_URL":                fb.URL,
+		"RACKSPACE_MK8S_AUTH_CACHE_TTL":          "10s",
+		"RACKSPACE_MK8S_AUTH_CACHE_MAX_TTL":      "35s",
+		"RACKSPACE_MK8S_AUTH_CACHE_ADAPTIVE_TTL": "true",
+	})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, a.Stats().CacheTTL)
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+
+	// instability drives the TTL up to the cap
+	fb.status = http.StatusBadGateway
+	for _, expected := range []time.Duration{20 * time.Second, 35 * time.Second, 35 * time.Second} {
+		_, err = a.review(m)
+		assert.NotNil(t, err)
+		assert.Equal(t, expected, a.Stats().CacheTTL)
+	}
+
+	// a rejected token is not instability
+	fb.status = http.StatusUnauthorized
+	a.review(m)
+	assert.Equal(t, 35*time.Second, a.Stats().CacheTTL)
+
+	// recovery brings it back down to the base
+	fb.status = 0
+	for _, expected := range []time.Duration{17500 * time.Millisecond, 10 * time.Second, 10 * time.Second} {
+		_, err = a.review(m)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, a.Stats().CacheTTL)
+	}
+}
+
+func TestAdaptiveTTLDisabled(t *testing.T) {
+	ttl := newAdaptiveTTL(10*time.Second, time.Minute, false)
+	ttl.backendFailed()
+	assert.Equal(t, 10*time.Second, ttl.get())
+
+	// caching itself is off by default
+	assert.Nil(t, newUserCache(newAdaptiveTTL(0, 0, true)))
+}
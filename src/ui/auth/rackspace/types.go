@@ -1,17 +1,58 @@
 package rackspace
 
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// AuthRequest is the TokenReview sent to the backend. On the wire it's compact JSON, without any
+// whitespace between tokens or trailing newline, with the fields in the order apiVersion, kind,
+// spec.token and spec.audiences, the latter omitted when empty. The token is escaped as by
+// encoding/json, e.g. "<" as \u003c. Strict backends rely on this, use marshalAuthRequest.
 type AuthRequest struct {
-	Spec struct {
-		Token string `json:"token"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Token     string   `json:"token"`
+		Audiences []string `json:"audiences,omitempty"`
 	} `json:"spec"`
 }
 
+// newAuthRequest returns the TokenReview of the token in m, which the client sends as its password
+func newAuthRequest(apiVersion, kind string, m models.AuthModel) *AuthRequest {
+	r := &AuthRequest{
+		APIVersion: apiVersion,
+		Kind:       kind,
+	}
+	r.Spec.Token = m.Password
+	return r
+}
+
+// marshalAuthRequest returns the body of r, compacted so that a change of the marshalling can't
+// introduce whitespace the strict backends would reject
+func marshalAuthRequest(r *AuthRequest) ([]byte, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
+
 type AuthResponse struct {
 	APIVersion string `json:"apiVersion"`
 	Kind       string `json:"kind"`
 	Status     struct {
-		Authenticated bool   `json:"authenticated"`
-		Error         string `json:"error,omitempty"`
+		Authenticated bool     `json:"authenticated"`
+		Error         string   `json:"error,omitempty"`
+		Audiences     []string `json:"audiences,omitempty"`
 		User          struct {
 			Username string              `json:"username"`
 			UID      string              `json:"uid,omitempty"`
@@ -20,3 +61,31 @@ type AuthResponse struct {
 		} `json:"user,omitempty"`
 	} `json:"status"`
 }
+
+// identity returns the authenticated user in the response as an Identity
+func (r *AuthResponse) identity() Identity {
+	return Identity{
+		Username:  r.Status.User.Username,
+		UID:       r.Status.User.UID,
+		Groups:    r.Status.User.Groups,
+		Extra:     r.Status.User.Extra,
+		Audiences: r.Status.Audiences,
+	}
+}
+
+// checkStatus returns ErrNoStatus when the response in body has no status object, or
+// ErrEmptyStatus when the status decoded in resp is empty. Without these, a malformed backend
+// answering {} would only fail as an unauthenticated user.
+func checkStatus(body []byte, resp *AuthResponse) error {
+	if !reflect.ValueOf(resp.Status).IsZero() {
+		return nil
+	}
+
+	var probe struct {
+		Status json.RawMessage `json:"status"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil || len(probe.Status) == 0 || string(probe.Status) == "null" {
+		return ErrNoStatus
+	}
+	return ErrEmptyStatus
+}
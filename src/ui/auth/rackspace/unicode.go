@@ -0,0 +1,23 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import "golang.org/x/text/unicode/norm"
+
+// composeNFC returns s in Unicode Normalization Form C, so that the decomposed and precomposed
+// spellings of a name, e.g. e followed by the combining acute accent and é, are the same string
+func composeNFC(s string) string {
+	return norm.NFC.String(s)
+}
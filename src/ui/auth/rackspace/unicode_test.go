@@ -0,0 +1,71 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestComposeNFC(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice":                "alice",
+		"Jose\u0301":           "José",
+		"José":                 "José",
+		"A\u030a\u0301ngström": "Ǻngström",
+		"\u1100\u1161\u11a8":   "\uac01",
+		"e\u0338":              "e\u0338",
+		// singleton decompositions
+		"\u2126": "\u03a9",
+		"\u212b": "\u00c5",
+		// marks out of the canonical order
+		"a\u0301\u0323": "\u1ea1\u0301",
+		"a\u0323\u0301": "\u1ea1\u0301",
+	} {
+		assert.Equal(t, want, composeNFC(in), "%q", in)
+	}
+}
+
+func TestResolveNormalizeUnicode(t *testing.T) {
+	store := &fakeStore{}
+	groups := &fakeGroupStore{}
+	r := &UserResolver{Store: store, Groups: groups, NormalizeUnicode: true}
+
+	user, err := r.Resolve(Identity{Username: "josé", Groups: []string{"dévs"}})
+	assert.Nil(t, err)
+
+	same, err := r.Resolve(Identity{Username: "jose\u0301", Groups: []string{"de\u0301vs"}})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserID, same.UserID)
+	assert.Equal(t, "josé", same.Username)
+	assert.Equal(t, 1, store.registers)
+	assert.Len(t, groups.groups, 1)
+
+	// without normalization, the decomposed spelling makes another user
+	r.NormalizeUnicode = false
+	other, err := r.Resolve(Identity{Username: "jose\u0301"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, user.UserID, other.UserID)
+}
+
+func TestCheckPrincipalNormalizeUnicode(t *testing.T) {
+	a := &Auth{verifyPrincipal: true, resolver: &UserResolver{NormalizeUnicode: true}}
+	assert.Nil(t, a.checkPrincipal(models.AuthModel{Principal: "jose\u0301"}, "josé"))
+
+	a.resolver.NormalizeUnicode = false
+	assert.Equal(t, ErrPrincipalMismatch, a.checkPrincipal(models.AuthModel{Principal: "jose\u0301"}, "josé"))
+}
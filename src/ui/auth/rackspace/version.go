@@ -0,0 +1,86 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"sync"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// maxObservedVersions bounds the number of distinct response versions recorded, so a backend
+// answering with arbitrary versions can't grow the record or the logs without limit
+const maxObservedVersions = 16
+
+// ResponseVersion is an apiVersion and kind seen in the backend's responses
+type ResponseVersion struct {
+	APIVersion string
+	Kind       string
+}
+
+// versionWatcher records the versions of the backend's responses and warns, once per version,
+// when they differ from the configured version. It is observability only: responses of other
+// versions are still used. A nil watcher records nothing.
+type versionWatcher struct {
+	sync.Mutex
+	expected ResponseVersion
+	observed map[ResponseVersion]int64
+}
+
+func newVersionWatcher(apiVersion, kind string) *versionWatcher {
+	return &versionWatcher{
+		expected: ResponseVersion{APIVersion: apiVersion, Kind: kind},
+		observed: make(map[ResponseVersion]int64),
+	}
+}
+
+// observe records the version of a response, and returns true when it's an unexpected version
+// seen for the first time, after logging a warning about it
+func (w *versionWatcher) observe(v ResponseVersion) bool {
+	if w == nil {
+		return false
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if _, ok := w.observed[v]; !ok && len(w.observed) >= maxObservedVersions {
+		return false
+	}
+	w.observed[v]++
+	if v == w.expected || w.observed[v] > 1 {
+		return false
+	}
+
+	log.Warningf("Unexpected auth response version: apiVersion=%q kind=%q, expected apiVersion=%q kind=%q. "+
+		"If kubernetes-auth was upgraded, set RACKSPACE_MK8S_AUTH_API_VERSION and RACKSPACE_MK8S_AUTH_KIND to match it. "+
+		"This is only logged once per version.", v.APIVersion, v.Kind, w.expected.APIVersion, w.expected.Kind)
+	return true
+}
+
+// snapshot returns the number of responses of each observed version
+func (w *versionWatcher) snapshot() map[ResponseVersion]int64 {
+	if w == nil {
+		return nil
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	s := make(map[ResponseVersion]int64, len(w.observed))
+	for k, v := range w.observed {
+		s[k] = v
+	}
+	return s
+}
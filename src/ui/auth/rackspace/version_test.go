@@ -0,0 +1,72 @@
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package rackspace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+func TestReviewUnexpectedVersionWarnsOnce(t *testing.T) {
+	fb := newFakeBackend(t)
+	defer fb.Close()
+	defer setEnv(t, map[string]string{"RACKSPACE_MK8S_AUTH_URL": fb.URL})()
+
+	a, err := setupAuth()
+	assert.Nil(t, err)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stdout)
+
+	m := models.AuthModel{Principal: "alice", Password: "token"}
+	_, err = a.review(m)
+	assert.Nil(t, err)
+	assert.NotContains(t, logged.String(), "Unexpected auth response version")
+
+	// a new version is warned about once, with upgrade guidance, and not on repeats
+	fb.response.APIVersion = "authentication.k8s.io/v2"
+	for i := 0; i < 3; i++ {
+		_, err = a.review(m)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, strings.Count(logged.String(), "Unexpected auth response version"))
+	assert.Contains(t, logged.String(), `apiVersion="authentication.k8s.io/v2"`)
+	assert.Contains(t, logged.String(), "RACKSPACE_MK8S_AUTH_API_VERSION")
+
+	assert.Equal(t, map[ResponseVersion]int64{
+		{APIVersion: defaultAPIVersion, Kind: defaultKind}:          1,
+		{APIVersion: "authentication.k8s.io/v2", Kind: defaultKind}: 3,
+	}, a.Stats().ResponseVersions)
+}
+
+func TestVersionWatcherBounded(t *testing.T) {
+	w := newVersionWatcher(defaultAPIVersion, defaultKind)
+	for i := 0; i < 2*maxObservedVersions; i++ {
+		w.observe(ResponseVersion{APIVersion: fmt.Sprintf("v%d", i), Kind: defaultKind})
+	}
+	assert.Len(t, w.snapshot(), maxObservedVersions)
+
+	var disabled *versionWatcher
+	assert.False(t, disabled.observe(ResponseVersion{}))
+	assert.Nil(t, disabled.snapshot())
+}
@@ -67,6 +67,7 @@ func (cc *CommonController) Login() {
 	user, err := auth.Login(models.AuthModel{
 		Principal: principal,
 		Password:  password,
+		Metadata:  auth.NewRequestMetadata(cc.Ctx.Request),
 	})
 	if err != nil {
 		log.Errorf("Error occurred in UserLogin: %v", err)
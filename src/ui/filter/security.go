@@ -22,6 +22,7 @@ import (
 
 	beegoctx "github.com/astaxie/beego/context"
 	"github.com/docker/distribution/reference"
+	"github.com/vmware/harbor/src/common"
 	"github.com/vmware/harbor/src/common/models"
 	secstore "github.com/vmware/harbor/src/common/secret"
 	"github.com/vmware/harbor/src/common/security"
@@ -91,6 +92,7 @@ func Init() {
 	// standalone
 	reqCtxModifiers = []ReqCtxModifier{
 		&secretReqCtxModifier{config.SecretStore},
+		&clientCertReqCtxModifier{},
 		&basicAuthReqCtxModifier{},
 		&sessionReqCtxModifier{},
 		&unauthorizedReqCtxModifier{}}
@@ -143,6 +145,59 @@ func (s *secretReqCtxModifier) Modify(ctx *beegoctx.Context) bool {
 	return true
 }
 
+// clientCertReqCtxModifier authenticates the requests with a verified client certificate
+// and no credential in the rackspace auth mode, whose authenticator maps the allowed
+// certificates to service users. The other auth modes don't log in with certificates.
+type clientCertReqCtxModifier struct {
+	// authMode and login default to config.AuthMode and auth.Login
+	authMode func() (string, error)
+	login    func(models.AuthModel) (*models.User, error)
+}
+
+func (c *clientCertReqCtxModifier) Modify(ctx *beegoctx.Context) bool {
+	if _, _, ok := ctx.Request.BasicAuth(); ok {
+		return false
+	}
+	md := auth.NewRequestMetadata(ctx.Request)
+	if md == nil || len(md.ClientCertSubject) == 0 {
+		return false
+	}
+
+	authMode, login := c.authMode, c.login
+	if authMode == nil {
+		authMode = config.AuthMode
+	}
+	if login == nil {
+		login = auth.Login
+	}
+	mode, err := authMode()
+	if err != nil {
+		log.Errorf("failed to get the auth mode: %v", err)
+		return false
+	}
+	if mode != common.RackspaceAuth {
+		return false
+	}
+	log.Debug("got a verified client certificate")
+
+	user, err := login(models.AuthModel{Metadata: md})
+	if err != nil {
+		log.Errorf("failed to authenticate client certificate %s: %v", md.ClientCertSubject, err)
+		return false
+	}
+	if user == nil {
+		log.Debug("client certificate user is nil")
+		return false
+	}
+	log.Debug("using local database project manager")
+	pm := config.GlobalProjectMgr
+	log.Debug("creating local database security context...")
+	securCtx := local.NewSecurityContext(user, pm)
+
+	setSecurCtxAndPM(ctx.Request, securCtx, pm)
+	return true
+}
+
 type basicAuthReqCtxModifier struct{}
 
 func (b *basicAuthReqCtxModifier) Modify(ctx *beegoctx.Context) bool {
@@ -202,6 +257,7 @@ func (b *basicAuthReqCtxModifier) Modify(ctx *beegoctx.Context) bool {
 	user, err := auth.Login(models.AuthModel{
 		Principal: username,
 		Password:  password,
+		Metadata:  auth.NewRequestMetadata(ctx.Request),
 	})
 	if err != nil {
 		log.Errorf("failed to authenticate %s: %v", username, err)
@@ -16,6 +16,9 @@ package filter
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -29,7 +32,9 @@ import (
 	beegoctx "github.com/astaxie/beego/context"
 	"github.com/astaxie/beego/session"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common"
 	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
 	commonsecret "github.com/vmware/harbor/src/common/secret"
 	"github.com/vmware/harbor/src/common/security"
 	"github.com/vmware/harbor/src/common/security/local"
@@ -145,6 +150,40 @@ func TestBasicAuthReqCtxModifier(t *testing.T) {
 	assert.NotNil(t, projectManager(ctx))
 }
 
+func TestClientCertReqCtxModifier(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet,
+		"http://127.0.0.1/api/projects/", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", req)
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci-robot"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	ctx, err := newContext(req)
+	if err != nil {
+		t.Fatalf("failed to crate context: %v", err)
+	}
+
+	// the other auth modes never log in with the certificate
+	logins := 0
+	modifier := &clientCertReqCtxModifier{
+		authMode: func() (string, error) { return common.DBAuth, nil },
+		login: func(m models.AuthModel) (*models.User, error) {
+			logins++
+			return &models.User{UserID: 1, Username: "ci-robot"}, nil
+		},
+	}
+	assert.False(t, modifier.Modify(ctx))
+	assert.Equal(t, 0, logins)
+	assert.Nil(t, securityContext(ctx))
+
+	// the rackspace authenticator decides which certificates are allowed
+	modifier.authMode = func() (string, error) { return common.RackspaceAuth, nil }
+	assert.True(t, modifier.Modify(ctx))
+	assert.Equal(t, 1, logins)
+	assert.IsType(t, &local.SecurityContext{}, securityContext(ctx))
+}
+
 func TestSessionReqCtxModifier(t *testing.T) {
 	req, err := http.NewRequest(http.MethodGet,
 		"http://127.0.0.1/api/projects/", nil)
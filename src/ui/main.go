@@ -17,7 +17,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"reflect"
+	"syscall"
 
 	"github.com/vmware/harbor/src/common/utils"
 	"github.com/vmware/harbor/src/common/utils/log"
@@ -25,6 +27,7 @@ import (
 	"github.com/astaxie/beego"
 	_ "github.com/astaxie/beego/session/redis"
 
+	"github.com/vmware/harbor/src/common"
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
 	"github.com/vmware/harbor/src/common/notifier"
@@ -34,8 +37,8 @@ import (
 	"github.com/vmware/harbor/src/ui/api"
 	_ "github.com/vmware/harbor/src/ui/auth/db"
 	_ "github.com/vmware/harbor/src/ui/auth/ldap"
+	"github.com/vmware/harbor/src/ui/auth/rackspace"
 	_ "github.com/vmware/harbor/src/ui/auth/uaa"
-	_ "github.com/vmware/harbor/src/ui/auth/rackspace"
 	"github.com/vmware/harbor/src/ui/config"
 	"github.com/vmware/harbor/src/ui/filter"
 	"github.com/vmware/harbor/src/ui/proxy"
@@ -95,6 +98,13 @@ func main() {
 	if err := dao.InitDatabase(database); err != nil {
 		log.Fatalf("failed to initialize database: %v", err)
 	}
+	authMode, err := config.AuthMode()
+	if err != nil {
+		log.Fatalf("failed to get the auth mode: %v", err)
+	}
+	if authMode == common.RackspaceAuth {
+		initRackspace()
+	}
 	if config.WithClair() {
 		clairDB, err := config.ClairDB()
 		if err != nil {
@@ -156,3 +166,43 @@ func main() {
 	//go proxy.StartProxy()
 	beego.Run()
 }
+
+// handleTermination closes the rackspace authenticator on SIGTERM, so its final metrics are pushed
+// before the pod exits. SIGTERM is then raised again with its default handling restored, so the
+// process terminates as it would have without the handler.
+// initRackspace checks and prepares what the rackspace authenticator relies on
+func initRackspace() {
+	if err := rackspace.CheckDatabase(); err != nil {
+		log.Fatalf("failed to check the database: %v", err)
+	}
+	if err := rackspace.CheckGroupRoleProjects(); err != nil {
+		log.Fatalf("failed to check the group role projects: %v", err)
+	}
+	if err := rackspace.PrecreateGroups(); err != nil {
+		log.Fatalf("failed to create the configured groups: %v", err)
+	}
+	oauth, err := config.OAuthConf()
+	if err != nil {
+		log.Fatalf("failed to get the oauth settings: %v", err)
+	}
+	if err := rackspace.RegisterSigningKey(oauth.SigningKey); err != nil {
+		log.Fatalf("failed to register the token signing key: %v", err)
+	}
+	if rackspace.PushesMetrics() {
+		handleTermination()
+	}
+}
+
+func handleTermination() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Info("received SIGTERM, closing the rackspace authenticator...")
+		rackspace.Close()
+		signal.Reset(syscall.SIGTERM)
+		if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+			log.Errorf("failed to terminate after closing the rackspace authenticator: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+//Interaction : A request recorded in a cassette with the response it got
+type Interaction struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  string      `json:"request_body,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	ResponseBody string      `json:"response_body,omitempty"`
+}
+
+//Cassette : A http.RoundTripper recording the interactions with the Harbor API to a file
+//on the first run and replaying them from the file thereafter, so suites can run without
+//a live server. The credentials of the requests are not recorded.
+type Cassette struct {
+	path      string
+	transport http.RoundTripper
+	recording bool
+
+	mutex        sync.Mutex
+	interactions []*Interaction
+	replayed     []bool
+}
+
+//NewCassette : Replay the interactions of the cassette file if it exists, otherwise record
+//the interactions of the requests sent with transport to it
+func NewCassette(path string, transport http.RoundTripper) (*Cassette, error) {
+	if len(strings.TrimSpace(path)) == 0 {
+		return nil, fmt.Errorf("empty cassette path")
+	}
+
+	c := &Cassette{path: path, transport: transport}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		if transport == nil {
+			return nil, fmt.Errorf("cassette %s not recorded yet and no transport to record it", path)
+		}
+		c.recording = true
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %v", path, err)
+	}
+	c.replayed = make([]bool, len(c.interactions))
+
+	return c, nil
+}
+
+//Recording : Return true if the cassette records the interactions, false if it replays them
+func (c *Cassette) Recording() bool {
+	return c.recording
+}
+
+//RoundTrip : Implement http.RoundTripper
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.recording {
+		return c.record(req, body)
+	}
+
+	return c.replay(req, body)
+}
+
+//Send the request and append its interaction to the cassette file
+func (c *Cassette) record(req *http.Request, body string) (*http.Response, error) {
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		RequestBody:  body,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		ResponseBody: string(data),
+	}
+	c.interactions = append(c.interactions, interaction)
+
+	file, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(c.path, file, 0644); err != nil {
+		return nil, err
+	}
+
+	return interaction.response(req), nil
+}
+
+//Return the response of the first interaction matching the request which is not replayed yet,
+//so the same request sent several times gets the recorded responses in order
+func (c *Cassette) replay(req *http.Request, body string) (*http.Response, error) {
+	for i, interaction := range c.interactions {
+		if c.replayed[i] ||
+			interaction.Method != req.Method ||
+			interaction.URL != req.URL.String() ||
+			interaction.RequestBody != body {
+			continue
+		}
+
+		c.replayed[i] = true
+		return interaction.response(req), nil
+	}
+
+	return nil, fmt.Errorf("no recorded interaction for %s %s in cassette %s", req.Method, req.URL, c.path)
+}
+
+//Build the response of the interaction to the request
+func (i *Interaction) response(req *http.Request) *http.Response {
+	header := i.Header
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.StatusCode, http.StatusText(i.StatusCode)),
+		StatusCode:    i.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(i.ResponseBody)),
+		ContentLength: int64(len(i.ResponseBody)),
+		Request:       req,
+	}
+}
+
+//Read the request body and restore it so the request can still be sent
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return string(data), nil
+}
+
+//Return true if the cassette file is already recorded
+func cassetteRecorded(path string) bool {
+	if len(strings.TrimSpace(path)) == 0 {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -25,6 +25,8 @@ type APIClientConfig struct {
 	CertFile string
 	KeyFile  string
 	Proxy    string
+	//Record the interactions to the file or replay them from it if it exists, optional
+	Cassette string
 }
 
 //APIClient provided the http client for trigger http requests
@@ -38,24 +40,65 @@ type APIClient struct {
 
 //NewAPIClient is constructor of APIClient
 func NewAPIClient(config APIClientConfig) (*APIClient, error) {
-	//Load client cert
-	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
-	if err != nil {
-		return nil, err
+	//Replay the recorded interactions without any connection to the server
+	if cassetteRecorded(config.Cassette) {
+		cassette, err := NewCassette(config.Cassette, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return &APIClient{
+			client: &http.Client{Transport: cassette},
+			config: config,
+		}, nil
 	}
 
-	//Add ca
-	caCert, err := ioutil.ReadFile(config.CaFile)
+	transport, err := newTransport(config)
 	if err != nil {
 		return nil, err
 	}
 
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+	var roundTripper http.RoundTripper = transport
+	if len(strings.TrimSpace(config.Cassette)) > 0 {
+		if roundTripper, err = NewCassette(config.Cassette, transport); err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	return &APIClient{
+		client: client,
+		config: config,
+	}, nil
+
+}
+
+//Create the transport with the TLS and proxy settings of the config
+func newTransport(config APIClientConfig) (*http.Transport, error) {
+	tlsConfig := &tls.Config{}
+
+	//Load client cert if it's set
+	if len(config.CertFile) > 0 || len(config.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	//Add ca if it's set
+	if len(config.CaFile) > 0 {
+		caCert, err := ioutil.ReadFile(config.CaFile)
+		if err != nil {
+			return nil, err
+		}
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCert)
+		tlsConfig.RootCAs = caCertPool
 	}
 
 	tlsConfig.BuildNameToCertificate()
@@ -70,15 +113,7 @@ func NewAPIClient(config APIClientConfig) (*APIClient, error) {
 		}
 	}
 
-	client := &http.Client{
-		Transport: transport,
-	}
-
-	return &APIClient{
-		client: client,
-		config: config,
-	}, nil
-
+	return transport, nil
 }
 
 //Get data
@@ -0,0 +1,20 @@
+package envs
+
+//ConcourseCIRackspaceEnv : Rackspace auth env for concourse pipeline,
+//the password is a token of the stub auth backend of suite03, which listens
+//on the address the pipeline's Harbor has as RACKSPACE_MK8S_AUTH_URL
+var ConcourseCIRackspaceEnv = Environment{
+	Protocol:       "https",
+	TestingProject: "concoursecitesting03",
+	ImageName:      "busybox",
+	ImageTag:       "latest",
+	CAFile:         "../../../ca.crt",
+	KeyFile:        "../../../key.crt",
+	CertFile:       "../../../cert.crt",
+	Account:        "rackspace-dev",
+	Password:       "stub-token-dev",
+	Admin:          "admin",
+	AdminPass:      "pksxgxmifc0cnwa5px9h",
+	Hostname:       "10.112.122.1",
+	AuthBackend:    ":8090",
+}
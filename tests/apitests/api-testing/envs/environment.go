@@ -6,29 +6,35 @@ import (
 	"strings"
 
 	"github.com/vmware/harbor/tests/apitests/api-testing/client"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
 )
 
 //Environment keeps the testing env info
 type Environment struct {
-	Protocol       string //env var: HTTP_PROTOCOL
-	Hostname       string //env var: TESTING_ENV_HOSTNAME
-	Account        string //env var: TESTING_ENV_ACCOUNT
-	Password       string //env var: TESTING_ENV_PASSWORD
-	Admin          string //env var: TESTING_ENV_ADMIN
-	AdminPass      string //env var: TESTING_ENV_ADMIN_PASS
-	TestingProject string //env var: TESTING_PROJECT_NAME
-	ImageName      string //env var: TESTING_IMAGE_NAME
-	ImageTag       string //env var: TESTING_IMAGE_TAG
-	CAFile         string //env var: CA_FILE_PATH
-	CertFile       string //env var: CERT_FILE_PATH
-	KeyFile        string //env var: KEY_FILE_PATH
-	ProxyURL       string //env var: http_proxy, https_proxy, HTTP_PROXY, HTTPS_PROXY
+	Protocol       string `json:"protocol"`        //env var: HTTP_PROTOCOL
+	Hostname       string `json:"hostname"`        //env var: TESTING_ENV_HOSTNAME
+	Account        string `json:"account"`         //env var: TESTING_ENV_ACCOUNT
+	Password       string `json:"password"`        //env var: TESTING_ENV_PASSWORD
+	Admin          string `json:"admin"`           //env var: TESTING_ENV_ADMIN
+	AdminPass      string `json:"admin_pass"`      //env var: TESTING_ENV_ADMIN_PASS
+	TestingProject string `json:"testing_project"` //env var: TESTING_PROJECT_NAME
+	ImageName      string `json:"image_name"`      //env var: TESTING_IMAGE_NAME
+	ImageTag       string `json:"image_tag"`       //env var: TESTING_IMAGE_TAG
+	CAFile         string `json:"ca_file"`         //env var: CA_FILE_PATH
+	CertFile       string `json:"cert_file"`       //env var: CERT_FILE_PATH
+	KeyFile        string `json:"key_file"`        //env var: KEY_FILE_PATH
+	ProxyURL       string `json:"proxy_url"`       //env var: http_proxy, https_proxy, HTTP_PROXY, HTTPS_PROXY
+	Cassette       string `json:"cassette"`        //env var: TESTING_CASSETTE, record the API interactions on the first run and replay them thereafter
+	AuthBackend    string `json:"auth_backend"`    //env var: TESTING_AUTH_BACKEND_ADDR, where the suites stubbing the auth backend listen, e.g. ":8090"
 
 	//API client
-	HTTPClient *client.APIClient
+	HTTPClient *client.APIClient `json:"-"`
 
 	//Docker client
-	DockerClient *client.DockerClient
+	DockerClient *client.DockerClient `json:"-"`
+
+	//Receive the case events while suites are running, optional
+	Events lib.EventHandler `json:"-"`
 
 	//Initialize status
 	loaded bool
@@ -96,6 +102,16 @@ func (env *Environment) Load() error {
 		env.CertFile = certFile
 	}
 
+	cassette := os.Getenv("TESTING_CASSETTE")
+	if isNotEmpty(cassette) {
+		env.Cassette = cassette
+	}
+
+	authBackend := os.Getenv("TESTING_AUTH_BACKEND_ADDR")
+	if isNotEmpty(authBackend) {
+		env.AuthBackend = authBackend
+	}
+
 	proxyEnvVar := "https_proxy"
 	if env.Protocol == "http" {
 		proxyEnvVar = "http_proxy"
@@ -109,28 +125,36 @@ func (env *Environment) Load() error {
 	}
 
 	if !env.loaded {
-		cfg := client.APIClientConfig{
-			Username: env.Admin,
-			Password: env.AdminPass,
-			CaFile:   env.CAFile,
-			CertFile: env.CertFile,
-			KeyFile:  env.KeyFile,
-			Proxy:    env.ProxyURL,
-		}
-
-		httpClient, err := client.NewAPIClient(cfg)
-		if err != nil {
-			return err
-		}
-		env.HTTPClient = httpClient
-		env.DockerClient = &client.DockerClient{}
-
-		env.loaded = true
+		return env.loadClients()
 	}
 
 	return nil
 }
 
+//Create the API and docker clients with the current settings
+func (env *Environment) loadClients() error {
+	cfg := client.APIClientConfig{
+		Username: env.Admin,
+		Password: env.AdminPass,
+		CaFile:   env.CAFile,
+		CertFile: env.CertFile,
+		KeyFile:  env.KeyFile,
+		Proxy:    env.ProxyURL,
+		Cassette: env.Cassette,
+	}
+
+	httpClient, err := client.NewAPIClient(cfg)
+	if err != nil {
+		return err
+	}
+	env.HTTPClient = httpClient
+	env.DockerClient = &client.DockerClient{}
+
+	env.loaded = true
+
+	return nil
+}
+
 //RootURI : The root URI like https://<hostname>
 func (env *Environment) RootURI() string {
 	return fmt.Sprintf("%s://%s", env.Protocol, env.Hostname)
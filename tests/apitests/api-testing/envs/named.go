@@ -0,0 +1,74 @@
+package envs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//LoadNamedEnvironment : Read the named environments (e.g. dev, staging, prod) from the JSON
+//config file and return the selected one after validating it.
+//The file is an object keyed by the environment names, e.g.
+//  {"staging": {"protocol": "https", "hostname": "harbor.staging", ...}}
+func LoadNamedEnvironment(configFile, name string) (*Environment, error) {
+	if !isNotEmpty(name) {
+		return nil, errors.New("Empty environment name")
+	}
+
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	named := make(map[string]*Environment)
+	if err := json.Unmarshal(data, &named); err != nil {
+		return nil, fmt.Errorf("Failed to parse environments in %s: %s", configFile, err)
+	}
+
+	env, ok := named[name]
+	if !ok || env == nil {
+		return nil, fmt.Errorf("Environment %s is not defined in %s", name, configFile)
+	}
+
+	if err := env.Validate(); err != nil {
+		return nil, fmt.Errorf("Environment %s is invalid: %s", name, err)
+	}
+
+	return env, nil
+}
+
+//LoadNamedEnvironmentFromEnv : LoadNamedEnvironment with the config file and name
+//read from the env vars TESTING_ENV_CONFIG and TESTING_ENV_NAME
+func LoadNamedEnvironmentFromEnv() (*Environment, error) {
+	return LoadNamedEnvironment(os.Getenv("TESTING_ENV_CONFIG"), os.Getenv("TESTING_ENV_NAME"))
+}
+
+//Validate : Check the env has what the suites need
+func (env *Environment) Validate() error {
+	if env.Protocol != "http" && env.Protocol != "https" {
+		return fmt.Errorf("Protocol should be http or https but got '%s'", env.Protocol)
+	}
+
+	missing := []string{}
+	required := map[string]string{
+		"hostname":        env.Hostname,
+		"admin":           env.Admin,
+		"admin_pass":      env.AdminPass,
+		"testing_project": env.TestingProject,
+		"image_name":      env.ImageName,
+		"image_tag":       env.ImageTag,
+	}
+	for _, key := range []string{"hostname", "admin", "admin_pass", "testing_project", "image_name", "image_tag"} {
+		if !isNotEmpty(required[key]) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
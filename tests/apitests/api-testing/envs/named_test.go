@@ -0,0 +1,79 @@
+package envs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const namedEnvs = `{
+	"dev": {
+		"protocol": "http",
+		"hostname": "harbor.dev",
+		"admin": "admin",
+		"admin_pass": "Harbor12345",
+		"testing_project": "devtesting",
+		"image_name": "busybox",
+		"image_tag": "latest"
+	},
+	"staging": {
+		"protocol": "https",
+		"hostname": "harbor.staging",
+		"admin": "admin",
+		"testing_project": "stagingtesting",
+		"image_name": "busybox",
+		"image_tag": "latest"
+	}
+}`
+
+func writeNamedEnvs(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "envs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "envs.json")
+	if err := ioutil.WriteFile(file, []byte(namedEnvs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadNamedEnvironment(t *testing.T) {
+	file, clean := writeNamedEnvs(t)
+	defer clean()
+
+	env, err := LoadNamedEnvironment(file, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Hostname != "harbor.dev" || env.RootURI() != "http://harbor.dev" {
+		t.Fatalf("expect the dev environment but got %+v", env)
+	}
+}
+
+func TestLoadMissingNamedEnvironment(t *testing.T) {
+	file, clean := writeNamedEnvs(t)
+	defer clean()
+
+	_, err := LoadNamedEnvironment(file, "prod")
+	if err == nil || !strings.Contains(err.Error(), "prod is not defined") {
+		t.Fatalf("expect a missing environment error but got %v", err)
+	}
+}
+
+func TestLoadInvalidNamedEnvironment(t *testing.T) {
+	file, clean := writeNamedEnvs(t)
+	defer clean()
+
+	_, err := LoadNamedEnvironment(file, "staging")
+	if err == nil || !strings.Contains(err.Error(), "admin_pass") {
+		t.Fatalf("expect a validation error about admin_pass but got %v", err)
+	}
+
+	env := &Environment{Protocol: "ftp"}
+	if err := env.Validate(); err == nil {
+		t.Fatal("expect an invalid protocol error")
+	}
+}
@@ -0,0 +1,59 @@
+package envs
+
+//Merge : Return a copy of env with its settings replaced by the non-empty ones of override,
+//e.g. to run a suite against a second Harbor instance. The merged env is validated.
+//If env is loaded and the override changes the client settings, the clients are recreated.
+func (env *Environment) Merge(override *Environment) (*Environment, error) {
+	merged := *env
+	if override == nil {
+		return &merged, nil
+	}
+
+	mergeString(&merged.Protocol, override.Protocol)
+	mergeString(&merged.Hostname, override.Hostname)
+	mergeString(&merged.Account, override.Account)
+	mergeString(&merged.Password, override.Password)
+	mergeString(&merged.TestingProject, override.TestingProject)
+	mergeString(&merged.ImageName, override.ImageName)
+	mergeString(&merged.ImageTag, override.ImageTag)
+	mergeString(&merged.AuthBackend, override.AuthBackend)
+
+	clientChanged := false
+	for _, field := range []struct {
+		value    *string
+		override string
+	}{
+		{&merged.Admin, override.Admin},
+		{&merged.AdminPass, override.AdminPass},
+		{&merged.CAFile, override.CAFile},
+		{&merged.CertFile, override.CertFile},
+		{&merged.KeyFile, override.KeyFile},
+		{&merged.ProxyURL, override.ProxyURL},
+		{&merged.Cassette, override.Cassette},
+	} {
+		if mergeString(field.value, field.override) {
+			clientChanged = true
+		}
+	}
+
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+
+	if clientChanged && merged.loaded {
+		if err := merged.loadClients(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &merged, nil
+}
+
+//Replace value with override if it's not empty, return true if value is changed
+func mergeString(value *string, override string) bool {
+	if !isNotEmpty(override) || *value == override {
+		return false
+	}
+	*value = override
+	return true
+}
@@ -0,0 +1,40 @@
+package envs
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	env := &Environment{
+		Protocol:       "https",
+		Hostname:       "harbor.local",
+		Admin:          "admin",
+		AdminPass:      "Harbor12345",
+		TestingProject: "testing",
+		ImageName:      "busybox",
+		ImageTag:       "latest",
+	}
+
+	merged, err := env.Merge(&Environment{Hostname: "harbor2.local", ImageTag: "1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Hostname != "harbor2.local" || merged.ImageTag != "1.0" {
+		t.Fatalf("expect the override to be applied but got %+v", merged)
+	}
+	if merged.Admin != "admin" || merged.TestingProject != "testing" {
+		t.Fatalf("expect the base settings to be kept but got %+v", merged)
+	}
+	if env.Hostname != "harbor.local" {
+		t.Fatal("expect the base environment not to be changed")
+	}
+
+	merged, err = env.Merge(nil)
+	if err != nil || merged.Hostname != "harbor.local" {
+		t.Fatalf("expect a copy of the base without override but got %+v, %v", merged, err)
+	}
+
+	if _, err := env.Merge(&Environment{Protocol: "ftp"}); err == nil {
+		t.Fatal("expect the merged environment to be validated")
+	}
+}
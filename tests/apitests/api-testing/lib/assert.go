@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//AssertionError : A failed assertion with the expected and actual values
+type AssertionError struct {
+	Assertion string
+	Expected  interface{}
+	Actual    interface{}
+}
+
+//Error : Format the failure the same way for all the suites
+func (ae *AssertionError) Error() string {
+	return fmt.Sprintf("%s: expected %#v, actual %#v", ae.Assertion, ae.Expected, ae.Actual)
+}
+
+//AssertEqual : Pass the case if actual deeply equals expected, fail it otherwise.
+//Return the result so that the dependent steps can be skipped.
+func (r *Report) AssertEqual(caseName string, expected, actual interface{}) bool {
+	return r.assert(caseName, "AssertEqual", reflect.DeepEqual(expected, actual), expected, actual)
+}
+
+//AssertStatus : Pass the case if the HTTP status code is the expected one, fail it otherwise
+func (r *Report) AssertStatus(caseName string, expected, actual int) bool {
+	return r.assert(caseName, "AssertStatus", expected == actual, expected, actual)
+}
+
+//AssertContains : Pass the case if s contains substr, fail it otherwise
+func (r *Report) AssertContains(caseName string, s, substr string) bool {
+	return r.assert(caseName, "AssertContains", strings.Contains(s, substr), substr, s)
+}
+
+func (r *Report) assert(caseName, assertion string, ok bool, expected, actual interface{}) bool {
+	if !ok {
+		r.Failed(caseName, &AssertionError{
+			Assertion: assertion,
+			Expected:  expected,
+			Actual:    actual,
+		})
+		return false
+	}
+
+	r.Passed(caseName)
+	return true
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAssertPassed(t *testing.T) {
+	report := &Report{}
+	if !report.AssertEqual("equal", []string{"a", "b"}, []string{"a", "b"}) {
+		t.Fatal("expect AssertEqual to pass")
+	}
+	if !report.AssertStatus("status", http.StatusOK, 200) {
+		t.Fatal("expect AssertStatus to pass")
+	}
+	if !report.AssertContains("contains", "harbor-1.5.0", "1.5") {
+		t.Fatal("expect AssertContains to pass")
+	}
+
+	if report.IsFail() || report.Total() != 3 {
+		t.Fatalf("expect 3 passed cases but got %+v", report)
+	}
+	if report.passed[0] != "equal: [PASSED]" {
+		t.Fatalf("unexpected report entry %s", report.passed[0])
+	}
+}
+
+func TestAssertFailed(t *testing.T) {
+	events := []CaseEvent{}
+	report := NewReport(func(event CaseEvent) {
+		events = append(events, event)
+	})
+
+	if report.AssertEqual("equal", "project1", "project2") {
+		t.Fatal("expect AssertEqual to fail")
+	}
+	if report.AssertStatus("status", http.StatusCreated, http.StatusConflict) {
+		t.Fatal("expect AssertStatus to fail")
+	}
+	if report.AssertContains("contains", "harbor-1.5.0", "1.6") {
+		t.Fatal("expect AssertContains to fail")
+	}
+
+	expected := []string{
+		`equal: [FAILED] AssertEqual: expected "project1", actual "project2"`,
+		`status: [FAILED] AssertStatus: expected 201, actual 409`,
+		`contains: [FAILED] AssertContains: expected "1.6", actual "harbor-1.5.0"`,
+	}
+	if !report.IsFail() || len(report.failed) != len(expected) {
+		t.Fatalf("expect %d failed cases but got %+v", len(expected), report)
+	}
+	for i, entry := range expected {
+		if report.failed[i] != entry {
+			t.Fatalf("expect report entry %q but got %q", entry, report.failed[i])
+		}
+	}
+
+	if len(events) != 3 || events[1].Error != `AssertStatus: expected 201, actual 409` {
+		t.Fatalf("expect the structured failures to be streamed but got %+v", events)
+	}
+}
+
+func TestReportSummary(t *testing.T) {
+	report := &Report{}
+	report.Passed("a")
+	other := &Report{}
+	other.Failed("b", nil)
+	other.Skipped("c", "replication is disabled")
+	report.Merge(other)
+	report.Merge(nil)
+
+	passed, failed, skipped := report.Counts()
+	if passed != 1 || failed != 1 || skipped != 1 {
+		t.Fatalf("expect 1 passed, 1 failed and 1 skipped case but got %d, %d, %d", passed, failed, skipped)
+	}
+	if summary := report.Summary(1500 * time.Millisecond); summary != "FAILED: 1 passed, 1 failed, 1 skipped in 1.5s" {
+		t.Fatalf("unexpected summary %s", summary)
+	}
+	if report.ExitCode() != 1 {
+		t.Fatal("expect a non-zero exit code")
+	}
+}
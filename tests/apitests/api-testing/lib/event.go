@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+//EventType : Type of the case event
+type EventType string
+
+const (
+	//CaseStarted : The case is started
+	CaseStarted EventType = "started"
+	//CaseFinished : The case is finished, passed, failed or skipped
+	CaseFinished EventType = "finished"
+)
+
+//CaseEvent : Emitted in real time while a suite is running
+type CaseEvent struct {
+	Type   EventType
+	Case   string
+	Passed bool
+	//Skipped case, neither passed nor failed
+	Skipped bool
+	//Error message of the failed case
+	Error string
+	Time  time.Time
+}
+
+//EventHandler : Receive the case events
+type EventHandler func(event CaseEvent)
+
+//PrintEvent : EventHandler rendering the events as a progress stream
+func PrintEvent(event CaseEvent) {
+	switch event.Type {
+	case CaseStarted:
+		fmt.Printf("[%s] %s: [RUNNING]\n", event.Time.Format(time.RFC3339), event.Case)
+	case CaseFinished:
+		if event.Skipped {
+			fmt.Printf("[%s] %s: [SKIPPED]\n", event.Time.Format(time.RFC3339), event.Case)
+		} else if event.Passed {
+			fmt.Printf("[%s] %s: [PASSED]\n", event.Time.Format(time.RFC3339), event.Case)
+		} else {
+			fmt.Printf("[%s] %s: [FAILED] %s\n", event.Time.Format(time.RFC3339), event.Case, event.Error)
+		}
+	}
+}
@@ -1,17 +1,35 @@
 package lib
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 )
 
+//Report : Keep the results of the cases
 type Report struct {
-	passed []string
-	failed []string
+	passed  []string
+	failed  []string
+	skipped []string
+
+	//Optional, receive the case events in real time
+	handler EventHandler
+}
+
+//NewReport : Constructor, the case events are streamed to the handler if it's not nil
+func NewReport(handler EventHandler) *Report {
+	return &Report{handler: handler}
+}
+
+//Start case
+func (r *Report) Start(caseName string) {
+	r.emit(CaseEvent{Type: CaseStarted, Case: caseName})
 }
 
 //Passed case
 func (r *Report) Passed(caseName string) {
 	r.passed = append(r.passed, fmt.Sprintf("%s: [%s]", caseName, "PASSED"))
+	r.emit(CaseEvent{Type: CaseFinished, Case: caseName, Passed: true})
 }
 
 //Failed case
@@ -21,6 +39,22 @@ func (r *Report) Failed(caseName string, err error) {
 		errMsg = err.Error()
 	}
 	r.failed = append(r.failed, fmt.Sprintf("%s: [%s] %s", caseName, "FAILED", errMsg))
+	r.emit(CaseEvent{Type: CaseFinished, Case: caseName, Error: errMsg})
+}
+
+//Skipped case, e.g. a feature not enabled on the environment
+func (r *Report) Skipped(caseName string, reason string) {
+	r.skipped = append(r.skipped, fmt.Sprintf("%s: [%s] %s", caseName, "SKIPPED", reason))
+	r.emit(CaseEvent{Type: CaseFinished, Case: caseName, Skipped: true})
+}
+
+func (r *Report) emit(event CaseEvent) {
+	if r.handler == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	r.handler(event)
 }
 
 //Print report
@@ -39,9 +73,75 @@ func (r *Report) Print() {
 	for _, res := range r.failed {
 		fmt.Println(res)
 	}
+
+	for _, res := range r.skipped {
+		fmt.Println(res)
+	}
+}
+
+//Merge : Append the results of the other report, e.g. to aggregate the reports of several suites
+func (r *Report) Merge(other *Report) {
+	if other == nil {
+		return
+	}
+	r.passed = append(r.passed, other.passed...)
+	r.failed = append(r.failed, other.failed...)
+	r.skipped = append(r.skipped, other.skipped...)
+}
+
+//Counts : Number of passed, failed and skipped cases
+func (r *Report) Counts() (passed, failed, skipped int) {
+	return len(r.passed), len(r.failed), len(r.skipped)
+}
+
+//Summary : One line summary of the counts and the total duration, for CI logs
+func (r *Report) Summary(elapsed time.Duration) string {
+	status := "PASSED"
+	if r.IsFail() {
+		status = "FAILED"
+	}
+	return fmt.Sprintf("%s: %d passed, %d failed, %d skipped in %s",
+		status, len(r.passed), len(r.failed), len(r.skipped), elapsed)
+}
+
+//ExitCode : Process exit code of the report, non-zero if any case failed.
+//Skipped cases don't fail the run, so a run with only skipped cases exits with 0.
+func (r *Report) ExitCode() int {
+	if r.IsFail() {
+		return 1
+	}
+	return 0
+}
+
+//Total : Count of the finished cases
+func (r *Report) Total() int {
+	return len(r.passed) + len(r.failed)
 }
 
 //IsFail : Overall result
 func (r *Report) IsFail() bool {
 	return len(r.failed) > 0
 }
+
+type reportJSON struct {
+	Passed  []string `json:"passed"`
+	Failed  []string `json:"failed"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+//MarshalJSON : Encode the report so it can be persisted
+func (r *Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(reportJSON{Passed: r.passed, Failed: r.failed, Skipped: r.skipped})
+}
+
+//UnmarshalJSON : Decode a persisted report
+func (r *Report) UnmarshalJSON(data []byte) error {
+	var rj reportJSON
+	if err := json.Unmarshal(data, &rj); err != nil {
+		return err
+	}
+	r.passed = rj.Passed
+	r.failed = rj.Failed
+	r.skipped = rj.Skipped
+	return nil
+}
@@ -92,6 +92,22 @@ func (uu *UserUtil) GetUsers(name string) ([]models.ExistingUser, error) {
 	return users, nil
 }
 
+//GetCurrentUser : Get the user the client is logged in as
+func (uu *UserUtil) GetCurrentUser() (*models.ExistingUser, error) {
+	url := fmt.Sprintf("%s%s", uu.rootURI, "/api/users/current")
+	data, err := uu.testingClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.ExistingUser
+	if err = json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 //GetUserID : Get user ID
 //If user with the username is not existing, then return -1
 func (uu *UserUtil) GetUserID(username string) int {
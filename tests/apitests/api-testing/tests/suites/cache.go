@@ -0,0 +1,102 @@
+package suites
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+)
+
+//Fingerprinter : Optional interface for suites with inputs beyond the environment,
+//e.g. fixtures. Any change of the fingerprint makes the suite run again.
+type Fingerprinter interface {
+	Fingerprint() string
+}
+
+//ResultCache : Keep the reports of passed suites in a file, keyed by the hash of their inputs
+type ResultCache struct {
+	sync.Mutex
+	path    string
+	reports map[string]*lib.Report
+}
+
+//NewResultCache : Constructor, load the existing results from the file if it's there
+func NewResultCache(path string) (*ResultCache, error) {
+	rc := &ResultCache{
+		path:    path,
+		reports: make(map[string]*lib.Report),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rc, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &rc.reports); err != nil {
+		return nil, fmt.Errorf("Failed to load result cache %s: %s", path, err)
+	}
+
+	return rc, nil
+}
+
+//Lookup : Get the cached report with the key
+func (rc *ResultCache) Lookup(key string) (*lib.Report, bool) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	report, ok := rc.reports[key]
+	return report, ok
+}
+
+//Store : Cache the report if it passed and save the cache file
+func (rc *ResultCache) Store(key string, report *lib.Report) error {
+	if report == nil || report.IsFail() {
+		return nil
+	}
+
+	rc.Lock()
+	defer rc.Unlock()
+
+	rc.reports[key] = report
+	data, err := json.Marshal(rc.reports)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(rc.path, data, 0644)
+}
+
+//cacheKey : Hash of everything the result of the suite depends on
+func cacheKey(name, version string, suite Suite, onEnvironment *envs.Environment) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "suite=%s\nversion=%s\n", name, version)
+	fmt.Fprintf(h, "protocol=%s\nhostname=%s\naccount=%s\npassword=%s\nadmin=%s\nadminPass=%s\n",
+		onEnvironment.Protocol,
+		onEnvironment.Hostname,
+		onEnvironment.Account,
+		onEnvironment.Password,
+		onEnvironment.Admin,
+		onEnvironment.AdminPass)
+	fmt.Fprintf(h, "project=%s\nimage=%s:%s\nca=%s\ncert=%s\nkey=%s\nproxy=%s\n",
+		onEnvironment.TestingProject,
+		onEnvironment.ImageName,
+		onEnvironment.ImageTag,
+		onEnvironment.CAFile,
+		onEnvironment.CertFile,
+		onEnvironment.KeyFile,
+		onEnvironment.ProxyURL)
+	if fp, ok := suite.(Fingerprinter); ok {
+		fmt.Fprintf(h, "fingerprint=%s\n", fp.Fingerprint())
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
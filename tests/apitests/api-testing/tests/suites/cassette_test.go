@@ -0,0 +1,87 @@
+package suites
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+)
+
+type systemInfoSuite struct{}
+
+func (sis *systemInfoSuite) Run(onEnvironment *envs.Environment) *lib.Report {
+	report := &lib.Report{}
+	sys := lib.NewSystemUtil(onEnvironment.RootURI(), onEnvironment.Hostname, onEnvironment.HTTPClient)
+	for _, name := range []string{"systeminfo", "systeminfo again"} {
+		if err := sys.GetSystemInfo(); err != nil {
+			report.Failed(name, err)
+		} else {
+			report.Passed(name)
+		}
+	}
+	return report
+}
+
+func TestCassetteReplaysRecordedRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cassette := filepath.Join(dir, "harbor.json")
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//The second systeminfo is wrong so the report has a failure to replay too
+		calls++
+		host := r.Host
+		if calls > 1 {
+			host = "other.local"
+		}
+		fmt.Fprintf(w, `{"registry_url": %q}`, host)
+	}))
+	hostname := strings.TrimPrefix(server.URL, "http://")
+
+	run := func() *lib.Report {
+		env := &envs.Environment{Protocol: "http", Hostname: hostname, Cassette: cassette}
+		if err := env.Load(); err != nil {
+			t.Fatal(err)
+		}
+		return (&systemInfoSuite{}).Run(env)
+	}
+
+	recorded := run()
+	if passed, failed, _ := recorded.Counts(); passed != 1 || failed != 1 {
+		t.Fatalf("expect 1 passed and 1 failed case to be recorded but got %d and %d", passed, failed)
+	}
+	if _, err := os.Stat(cassette); err != nil {
+		t.Fatalf("expect the cassette to be recorded: %v", err)
+	}
+
+	//Replay without the server
+	server.Close()
+	replayed := run()
+	if calls != 2 {
+		t.Fatalf("expect the server to be called only while recording but got %d calls", calls)
+	}
+
+	recordedJSON, err := recorded.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayedJSON, err := replayed.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recordedJSON, replayedJSON) {
+		t.Fatalf("expect the replayed report %s to equal the recorded one %s", replayedJSON, recordedJSON)
+	}
+}
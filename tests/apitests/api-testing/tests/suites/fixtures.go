@@ -0,0 +1,36 @@
+package suites
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//Fixtures : Read the fixtures of a suite. They are embedded in the binary with go:embed so
+//the suites also run in a container without the source tree, e.g.
+//  //go:embed testdata
+//  var fixtures embed.FS
+//When Dir is set, a fixture found on disk under Dir is read instead of the embedded one,
+//so the fixtures can be edited locally without rebuilding.
+type Fixtures struct {
+	Embedded fs.FS
+	Dir      string
+}
+
+//NewFixtures : Constructor, Dir is read from the env var TESTING_FIXTURES_DIR
+func NewFixtures(embedded fs.FS) *Fixtures {
+	return &Fixtures{Embedded: embedded, Dir: os.Getenv("TESTING_FIXTURES_DIR")}
+}
+
+//Read : Get the content of the fixture with the slash-separated name, e.g. "testdata/users.json"
+func (f *Fixtures) Read(name string) ([]byte, error) {
+	if len(f.Dir) > 0 {
+		data, err := ioutil.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(name)))
+		if err == nil || !os.IsNotExist(err) {
+			return data, err
+		}
+	}
+
+	return fs.ReadFile(f.Embedded, name)
+}
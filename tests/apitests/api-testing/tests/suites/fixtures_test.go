@@ -0,0 +1,80 @@
+package suites
+
+import (
+	"embed"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+)
+
+//go:embed testdata
+var testFixtures embed.FS
+
+//fixtureSuite : Pass one case per name in its fixture
+type fixtureSuite struct {
+	fixtures *Fixtures
+}
+
+func (fxs *fixtureSuite) Run(onEnvironment *envs.Environment) *lib.Report {
+	report := &lib.Report{}
+	data, err := fxs.fixtures.Read("testdata/cases.json")
+	if err != nil {
+		report.Failed("fixture", err)
+		return report
+	}
+
+	cases := []string{}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		report.Failed("fixture", err)
+		return report
+	}
+	for _, name := range cases {
+		report.Passed(name)
+	}
+	return report
+}
+
+func TestRunSuiteWithEmbeddedFixture(t *testing.T) {
+	suite := &fixtureSuite{fixtures: &Fixtures{Embedded: testFixtures}}
+	report := (&Runner{}).Run("fixtures", suite, &envs.Environment{})
+	if report.IsFail() || report.Total() != 2 {
+		t.Fatalf("expect the 2 cases of the embedded fixture to pass but got %d cases, failed=%v", report.Total(), report.IsFail())
+	}
+
+	if _, err := suite.fixtures.Read("testdata/missing.json"); err == nil {
+		t.Fatal("expect an error for a missing fixture")
+	}
+}
+
+func TestFixturesPreferDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixtures := &Fixtures{Embedded: testFixtures, Dir: dir}
+
+	//Not on disk, fall back to the embedded fixture
+	data, err := fixtures.Read("testdata/cases.json")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("expect the embedded fixture but got %q, %v", data, err)
+	}
+
+	//Edited locally
+	if err := os.MkdirAll(filepath.Join(dir, "testdata"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "testdata", "cases.json"), []byte(`["Edited"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := (&Runner{}).Run("fixtures", &fixtureSuite{fixtures: fixtures}, &envs.Environment{})
+	if report.IsFail() || report.Total() != 1 {
+		t.Fatalf("expect the single case of the on-disk fixture but got %d cases", report.Total())
+	}
+}
@@ -0,0 +1,108 @@
+package suites
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+)
+
+var (
+	registryLock sync.Mutex
+	registry     = make(map[string]Suite)
+)
+
+//Register : Enroll the suite under the name, usually from the init() of the suite package,
+//so that importing the package is enough to have it run by RunRegistered.
+//It panics if the name is empty, the suite is nil or the name is already registered.
+func Register(name string, suite Suite) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if len(name) == 0 {
+		panic("suites: Register with an empty name")
+	}
+	if suite == nil {
+		panic(fmt.Sprintf("suites: Register suite %s is nil", name))
+	}
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("suites: Register called twice for suite %s", name))
+	}
+	registry[name] = suite
+}
+
+//All : Return the registered suites sorted by name
+func All() []NamedSuite {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	named := make([]NamedSuite, 0, len(registry))
+	for name, suite := range registry {
+		named = append(named, NamedSuite{Name: name, Suite: suite})
+	}
+	sort.Slice(named, func(i, j int) bool { return named[i].Name < named[j].Name })
+	return named
+}
+
+//RunRegistered : RunAll with the registered suites
+func (r *Runner) RunRegistered(onEnvironment *envs.Environment, out io.Writer) (*lib.Report, int) {
+	return r.RunAll(All(), onEnvironment, out)
+}
+
+//RunByName : Run only the registered suite with the name, e.g. to debug a CI failure, and write
+//a one line summary of its report to out. Its dependencies run first unless SkipDependencies is
+//set and the suite fails without running if one of them fails. Return the report of the suite
+//alone and the process exit code.
+func (r *Runner) RunByName(name string, onEnvironment *envs.Environment, out io.Writer) (*lib.Report, int) {
+	start := time.Now()
+	report := r.runWithDependencies(name, onEnvironment, make(map[string]*lib.Report))
+
+	fmt.Fprintln(out, report.Summary(time.Since(start)))
+	return report, report.ExitCode()
+}
+
+//runWithDependencies : Run the suite after its dependencies, each suite at most once.
+//A nil report in reports marks a suite whose dependencies are being run, to detect cycles.
+func (r *Runner) runWithDependencies(name string, onEnvironment *envs.Environment, reports map[string]*lib.Report) *lib.Report {
+	if report, seen := reports[name]; seen {
+		if report == nil {
+			return failedReport(r.Events, name, fmt.Errorf("dependency cycle on suite %s", name))
+		}
+		return report
+	}
+
+	registryLock.Lock()
+	suite, ok := registry[name]
+	registryLock.Unlock()
+	if !ok {
+		return failedReport(r.Events, name, fmt.Errorf("suite %s is not registered", name))
+	}
+
+	if dependent, ok := suite.(Dependent); ok && !r.SkipDependencies {
+		reports[name] = nil
+		for _, dependency := range dependent.Dependencies() {
+			if r.runWithDependencies(dependency, onEnvironment, reports).IsFail() {
+				fmt.Printf("Dependency %s of suite %s failed, skip running it\n", dependency, name)
+				report := failedReport(r.Events, name, fmt.Errorf("dependency %s failed", dependency))
+				reports[name] = report
+				return report
+			}
+		}
+	}
+
+	report := r.Run(name, suite, onEnvironment)
+	reports[name] = report
+	return report
+}
+
+//failedReport : Report of a suite that could not run
+func failedReport(handler lib.EventHandler, name string, err error) *lib.Report {
+	report := lib.NewReport(handler)
+	report.Start(name)
+	report.Failed(name, err)
+	return report
+}
@@ -0,0 +1,124 @@
+package suites
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+)
+
+func TestRegister(t *testing.T) {
+	first, second := &countingSuite{}, &countingSuite{}
+	Register("registry-test-first", first)
+	Register("registry-test-second", second)
+
+	found := map[string]Suite{}
+	for _, ns := range All() {
+		found[ns.Name] = ns.Suite
+	}
+	if found["registry-test-first"] != first || found["registry-test-second"] != second {
+		t.Fatalf("expect both registered suites in All() but got %v", found)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expect registering a duplicate name to panic")
+			}
+		}()
+		Register("registry-test-first", &countingSuite{})
+	}()
+	if suite := findRegistered("registry-test-first"); suite != first {
+		t.Errorf("expect the duplicate to leave the first suite registered but got %v", suite)
+	}
+
+	out := &bytes.Buffer{}
+	if _, exitCode := (&Runner{}).RunRegistered(&envs.Environment{}, out); exitCode != 0 {
+		t.Errorf("expect exit code 0 but got %d", exitCode)
+	}
+	if first.runs != 1 || second.runs != 1 {
+		t.Errorf("expect each registered suite to run once but got %d and %d", first.runs, second.runs)
+	}
+	if !strings.HasPrefix(out.String(), "PASSED") {
+		t.Errorf("expect a passed summary but got %q", out.String())
+	}
+}
+
+type dependentSuite struct {
+	countingSuite
+	dependencies []string
+}
+
+func (ds *dependentSuite) Dependencies() []string {
+	return ds.dependencies
+}
+
+func TestRunByName(t *testing.T) {
+	dependency, other := &countingSuite{}, &countingSuite{}
+	target := &dependentSuite{dependencies: []string{"byname-test-dependency"}}
+	Register("byname-test-dependency", dependency)
+	Register("byname-test-other", other)
+	Register("byname-test-target", target)
+
+	out := &bytes.Buffer{}
+	report, exitCode := (&Runner{}).RunByName("byname-test-target", &envs.Environment{}, out)
+	if exitCode != 0 {
+		t.Errorf("expect exit code 0 but got %d", exitCode)
+	}
+	if passed, failed, _ := report.Counts(); passed != 1 || failed != 0 {
+		t.Errorf("expect the report of the target suite alone but got %d passed and %d failed", passed, failed)
+	}
+	if target.runs != 1 || dependency.runs != 1 || other.runs != 0 {
+		t.Errorf("expect the target and its dependency to run once but got %d, %d and %d runs of the other suite",
+			target.runs, dependency.runs, other.runs)
+	}
+	if !strings.HasPrefix(out.String(), "PASSED: 1 passed") {
+		t.Errorf("expect a summary of the target suite but got %q", out.String())
+	}
+
+	//A failed dependency fails the suite without running it
+	dependency.fail = true
+	if _, exitCode := (&Runner{}).RunByName("byname-test-target", &envs.Environment{}, out); exitCode == 0 {
+		t.Error("expect a failed dependency to fail the run")
+	}
+	if target.runs != 1 || dependency.runs != 2 {
+		t.Errorf("expect only the dependency to run but got %d and %d runs", target.runs, dependency.runs)
+	}
+
+	//Unless the dependencies are skipped
+	report, exitCode = (&Runner{SkipDependencies: true}).RunByName("byname-test-target", &envs.Environment{}, out)
+	if exitCode != 0 || report.Total() != 1 {
+		t.Errorf("expect the target suite to pass alone but got exit code %d and %d cases", exitCode, report.Total())
+	}
+	if target.runs != 2 || dependency.runs != 2 {
+		t.Errorf("expect only the target to run but got %d and %d runs", target.runs, dependency.runs)
+	}
+
+	if _, exitCode := (&Runner{}).RunByName("byname-test-missing", &envs.Environment{}, out); exitCode == 0 {
+		t.Error("expect an unknown suite to fail the run")
+	}
+}
+
+func TestRunByNameDependencyCycle(t *testing.T) {
+	first := &dependentSuite{dependencies: []string{"cycle-test-second"}}
+	second := &dependentSuite{dependencies: []string{"cycle-test-first"}}
+	Register("cycle-test-first", first)
+	Register("cycle-test-second", second)
+
+	if _, exitCode := (&Runner{}).RunByName("cycle-test-first", &envs.Environment{}, &bytes.Buffer{}); exitCode == 0 {
+		t.Error("expect a dependency cycle to fail the run")
+	}
+	if first.runs != 0 || second.runs != 0 {
+		t.Errorf("expect no suite of the cycle to run but got %d and %d runs", first.runs, second.runs)
+	}
+}
+
+func findRegistered(name string) Suite {
+	for _, ns := range All() {
+		if ns.Name == name {
+			return ns.Suite
+		}
+	}
+	return nil
+}
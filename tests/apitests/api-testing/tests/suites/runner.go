@@ -0,0 +1,87 @@
+package suites
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+)
+
+//Runner : Run suites against the testing environment
+type Runner struct {
+	//Cache of passed results, the suite is always run if it's nil
+	Cache *ResultCache
+
+	//Version of the code being tested, part of the cache key.
+	//The cache is not used if it's empty as changes can not be detected.
+	Version string
+
+	//Receive the case events in real time, optional
+	Events lib.EventHandler
+
+	//Don't run the dependencies of the suite run by RunByName, e.g. when their state is already there
+	SkipDependencies bool
+}
+
+//Run : Run the suite with the name, or reuse its last passed result if none of its inputs changed
+//If the suite is an EnvironmentOverrider it runs on the base environment merged with its override.
+func (r *Runner) Run(name string, suite Suite, onEnvironment *envs.Environment) *lib.Report {
+	if overrider, ok := suite.(EnvironmentOverrider); ok {
+		merged, err := onEnvironment.Merge(overrider.EnvironmentOverride())
+		if err != nil {
+			fmt.Printf("Invalid environment override of suite %s: %s\n", name, err)
+			report := lib.NewReport(r.Events)
+			report.Start("environment override")
+			report.Failed("environment override", err)
+			return report
+		}
+		onEnvironment = merged
+	}
+
+	key := ""
+	if r.Cache != nil && len(r.Version) > 0 {
+		key = cacheKey(name, r.Version, suite, onEnvironment)
+		if report, ok := r.Cache.Lookup(key); ok {
+			fmt.Printf("Suite %s is unchanged since its last passed run, reuse the result\n", name)
+			return report
+		}
+	}
+
+	if r.Events != nil {
+		streaming := *onEnvironment
+		streaming.Events = r.Events
+		onEnvironment = &streaming
+	}
+
+	report := suite.Run(onEnvironment)
+
+	if len(key) > 0 {
+		if err := r.Cache.Store(key, report); err != nil {
+			fmt.Printf("Failed to cache the result of suite %s: %s\n", name, err)
+		}
+	}
+
+	return report
+}
+
+//NamedSuite : A suite with the name it is reported and cached under
+type NamedSuite struct {
+	Name  string
+	Suite Suite
+}
+
+//RunAll : Entrypoint for CI, run the suites in order and write a one line summary of their
+//aggregate report to out. Return the aggregate report and the process exit code, which is
+//non-zero if any case failed.
+func (r *Runner) RunAll(named []NamedSuite, onEnvironment *envs.Environment, out io.Writer) (*lib.Report, int) {
+	start := time.Now()
+	aggregate := &lib.Report{}
+	for _, ns := range named {
+		aggregate.Merge(r.Run(ns.Name, ns.Suite, onEnvironment))
+	}
+
+	fmt.Fprintln(out, aggregate.Summary(time.Since(start)))
+	return aggregate, aggregate.ExitCode()
+}
@@ -0,0 +1,254 @@
+package suites
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+)
+
+type countingSuite struct {
+	runs int
+	fail bool
+}
+
+func (cs *countingSuite) Run(onEnvironment *envs.Environment) *lib.Report {
+	cs.runs++
+	report := &lib.Report{}
+	if cs.fail {
+		report.Failed("case", errors.New("failed"))
+	} else {
+		report.Passed("case")
+	}
+	return report
+}
+
+func TestRunnerReusesCachedPass(t *testing.T) {
+	dir, err := ioutil.TempDir("", "suites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cacheFile := filepath.Join(dir, "results.json")
+
+	cache, err := NewResultCache(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &Runner{Cache: cache, Version: "v1"}
+	env := &envs.Environment{Protocol: "https", Hostname: "harbor.local"}
+	suite := &countingSuite{}
+
+	runner.Run("suite", suite, env)
+	if report := runner.Run("suite", suite, env); report.IsFail() {
+		t.Fatal("expect the cached report to pass")
+	}
+	if suite.runs != 1 {
+		t.Fatalf("expect suite to run once but it ran %d times", suite.runs)
+	}
+
+	//Reload from the file
+	cache, err = NewResultCache(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.Cache = cache
+	runner.Run("suite", suite, env)
+	if suite.runs != 1 {
+		t.Fatalf("expect the persisted result to be reused but suite ran %d times", suite.runs)
+	}
+
+	//Any input change runs the suite again
+	env.Hostname = "harbor2.local"
+	runner.Run("suite", suite, env)
+	if suite.runs != 2 {
+		t.Fatalf("expect suite to run again after env change but it ran %d times", suite.runs)
+	}
+
+	runner.Version = "v2"
+	runner.Run("suite", suite, env)
+	if suite.runs != 3 {
+		t.Fatalf("expect suite to run again after version change but it ran %d times", suite.runs)
+	}
+}
+
+func TestRunnerDoesNotCacheFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "suites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewResultCache(filepath.Join(dir, "results.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &Runner{Cache: cache, Version: "v1"}
+	env := &envs.Environment{Hostname: "harbor.local"}
+	suite := &countingSuite{fail: true}
+
+	runner.Run("suite", suite, env)
+	runner.Run("suite", suite, env)
+	if suite.runs != 2 {
+		t.Fatalf("expect failed suite to run every time but it ran %d times", suite.runs)
+	}
+
+	//Caching is off without a version
+	passing := &countingSuite{}
+	runner.Version = ""
+	runner.Run("passing", passing, env)
+	runner.Run("passing", passing, env)
+	if passing.runs != 2 {
+		t.Fatalf("expect suite to run every time without version but it ran %d times", passing.runs)
+	}
+}
+
+type streamingSuite struct{}
+
+func (ss *streamingSuite) Run(onEnvironment *envs.Environment) *lib.Report {
+	report := lib.NewReport(onEnvironment.Events)
+	report.Start("case1")
+	report.Passed("case1")
+	report.Start("case2")
+	report.Failed("case2", errors.New("failed"))
+	report.Start("case3")
+	report.Passed("case3")
+	return report
+}
+
+func TestRunnerStreamsEvents(t *testing.T) {
+	events := []lib.CaseEvent{}
+	runner := &Runner{
+		Events: func(event lib.CaseEvent) {
+			events = append(events, event)
+		},
+	}
+	env := &envs.Environment{Hostname: "harbor.local"}
+
+	report := runner.Run("streaming", &streamingSuite{}, env)
+	if env.Events != nil {
+		t.Fatal("expect the passed environment not to be changed")
+	}
+
+	if len(events) != 2*report.Total() {
+		t.Fatalf("expect %d events but got %d", 2*report.Total(), len(events))
+	}
+	for i, event := range events {
+		expectedType := lib.CaseStarted
+		if i%2 == 1 {
+			expectedType = lib.CaseFinished
+		}
+		expectedCase := []string{"case1", "case2", "case3"}[i/2]
+		if event.Type != expectedType || event.Case != expectedCase {
+			t.Fatalf("expect event %d to be %s %s but got %s %s", i, expectedCase, expectedType, event.Case, event.Type)
+		}
+	}
+	if events[3].Passed || events[3].Error != "failed" {
+		t.Fatalf("expect case2 to finish as failed but got %+v", events[3])
+	}
+	if !report.IsFail() {
+		t.Fatal("expect the final report to fail")
+	}
+}
+
+//Record the hostname it runs against
+type hostSuite struct {
+	hostname string
+}
+
+func (hs *hostSuite) Run(onEnvironment *envs.Environment) *lib.Report {
+	hs.hostname = onEnvironment.Hostname
+	report := &lib.Report{}
+	report.Passed("case")
+	return report
+}
+
+type overridingSuite struct {
+	hostSuite
+	override *envs.Environment
+}
+
+func (ovs *overridingSuite) EnvironmentOverride() *envs.Environment {
+	return ovs.override
+}
+
+func TestRunnerEnvironmentOverride(t *testing.T) {
+	runner := &Runner{}
+	env := &envs.Environment{
+		Protocol:       "https",
+		Hostname:       "harbor.local",
+		Admin:          "admin",
+		AdminPass:      "Harbor12345",
+		TestingProject: "testing",
+		ImageName:      "busybox",
+		ImageTag:       "latest",
+	}
+
+	base := &hostSuite{}
+	replication := &overridingSuite{override: &envs.Environment{Hostname: "harbor2.local"}}
+
+	runner.Run("base", base, env)
+	if report := runner.Run("replication", replication, env); report.IsFail() {
+		t.Fatal("expect the suite with an override to pass")
+	}
+	runner.Run("base", base, env)
+
+	if base.hostname != "harbor.local" {
+		t.Fatalf("expect base suite to run on harbor.local but got %s", base.hostname)
+	}
+	if replication.hostname != "harbor2.local" {
+		t.Fatalf("expect overriding suite to run on harbor2.local but got %s", replication.hostname)
+	}
+	if env.Hostname != "harbor.local" {
+		t.Fatal("expect the base environment not to be changed")
+	}
+
+	//An invalid merged environment fails the suite without running it
+	invalid := &overridingSuite{override: &envs.Environment{Protocol: "ftp"}}
+	if report := runner.Run("invalid", invalid, env); !report.IsFail() {
+		t.Fatal("expect an invalid override to fail the suite")
+	}
+	if len(invalid.hostname) > 0 {
+		t.Fatal("expect the suite with an invalid override not to run")
+	}
+}
+
+//skippingSuite : Skip its only case
+type skippingSuite struct{}
+
+func (ss skippingSuite) Run(onEnvironment *envs.Environment) *lib.Report {
+	report := &lib.Report{}
+	report.Skipped("case", "not enabled")
+	return report
+}
+
+func TestRunAllExitCode(t *testing.T) {
+	env := &envs.Environment{Protocol: "https", Hostname: "harbor.local"}
+	cases := []struct {
+		name     string
+		suites   []NamedSuite
+		exitCode int
+		summary  string
+	}{
+		{"all pass", []NamedSuite{{"a", &countingSuite{}}, {"b", &countingSuite{}}}, 0, "PASSED: 2 passed, 0 failed, 0 skipped in "},
+		{"some fail", []NamedSuite{{"a", &countingSuite{}}, {"b", &countingSuite{fail: true}}, {"c", skippingSuite{}}}, 1, "FAILED: 1 passed, 1 failed, 1 skipped in "},
+		{"all skip", []NamedSuite{{"a", skippingSuite{}}, {"b", skippingSuite{}}}, 0, "PASSED: 0 passed, 0 failed, 2 skipped in "},
+	}
+
+	for _, c := range cases {
+		out := &bytes.Buffer{}
+		_, exitCode := (&Runner{}).RunAll(c.suites, env, out)
+		if exitCode != c.exitCode {
+			t.Errorf("%s: expect exit code %d but got %d", c.name, c.exitCode, exitCode)
+		}
+		if !strings.HasPrefix(out.String(), c.summary) || strings.Count(out.String(), "\n") != 1 {
+			t.Errorf("%s: unexpected summary %q", c.name, out.String())
+		}
+	}
+}
@@ -7,5 +7,18 @@ import (
 
 //Suite : Run a group of test cases
 type Suite interface {
-	Run(onEnvironment envs.Environment) *lib.Report
+	Run(onEnvironment *envs.Environment) *lib.Report
+}
+
+//EnvironmentOverrider : Optionally implemented by a suite needing a different environment,
+//e.g. a second Harbor instance for replication. The non-empty fields of the returned
+//environment replace the ones of the environment passed to the runner.
+type EnvironmentOverrider interface {
+	EnvironmentOverride() *envs.Environment
+}
+
+//Dependent : Optionally implemented by a suite relying on the state left by other registered
+//suites, e.g. a project they create. RunByName runs them first, RunAll runs every suite anyway.
+type Dependent interface {
+	Dependencies() []string
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
 	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+	"github.com/vmware/harbor/tests/apitests/api-testing/tests/suites"
 	"github.com/vmware/harbor/tests/apitests/api-testing/tests/suites/base"
 )
 
@@ -27,11 +28,16 @@ type ConcourseCiSuite01 struct {
 	base.ConcourseCiSuite
 }
 
+func init() {
+	suites.Register("suite01", &ConcourseCiSuite01{})
+}
+
 //Run : Run a group of cases
 func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report {
-	report := &lib.Report{}
+	report := lib.NewReport(onEnvironment.Events)
 
 	//s0
+	report.Start("GetSystemInfo")
 	sys := lib.NewSystemUtil(onEnvironment.RootURI(), onEnvironment.Hostname, onEnvironment.HTTPClient)
 	if err := sys.GetSystemInfo(); err != nil {
 		report.Failed("GetSystemInfo", err)
@@ -40,6 +46,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s1
+	report.Start("CreateProject")
 	pro := lib.NewProjectUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
 	if err := pro.CreateProject(onEnvironment.TestingProject, false); err != nil {
 		report.Failed("CreateProject", err)
@@ -48,6 +55,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s2
+	report.Start("CreateUser")
 	usr := lib.NewUserUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
 	if err := usr.CreateUser(onEnvironment.Account, onEnvironment.Password); err != nil {
 		report.Failed("CreateUser", err)
@@ -56,6 +64,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s3
+	report.Start("AssignRole")
 	if err := pro.AssignRole(onEnvironment.TestingProject, onEnvironment.Account); err != nil {
 		report.Failed("AssignRole", err)
 	} else {
@@ -63,6 +72,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s4
+	report.Start("pushImage")
 	if err := ccs.PushImage(onEnvironment); err != nil {
 		report.Failed("pushImage", err)
 	} else {
@@ -70,6 +80,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s5
+	report.Start("ScanTag")
 	img := lib.NewImageUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
 	repoName := fmt.Sprintf("%s/%s", onEnvironment.TestingProject, onEnvironment.ImageName)
 	if err := img.ScanTag(repoName, onEnvironment.ImageTag); err != nil {
@@ -79,6 +90,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s6
+	report.Start("pullImage[1]")
 	if err := ccs.PullImage(onEnvironment); err != nil {
 		report.Failed("pullImage[1]", err)
 	} else {
@@ -86,6 +98,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s7
+	report.Start("RevokeRole")
 	if err := pro.RevokeRole(onEnvironment.TestingProject, onEnvironment.Account); err != nil {
 		report.Failed("RevokeRole", err)
 	} else {
@@ -93,6 +106,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s8
+	report.Start("pullImage[2]")
 	if err := ccs.PullImage(onEnvironment); err == nil {
 		report.Failed("pullImage[2]", err)
 	} else {
@@ -100,6 +114,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s9
+	report.Start("DeleteRepo")
 	if err := img.DeleteRepo(repoName); err != nil {
 		report.Failed("DeleteRepo", err)
 	} else {
@@ -107,6 +122,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s10
+	report.Start("DeleteProject")
 	if err := pro.DeleteProject(onEnvironment.TestingProject); err != nil {
 		report.Failed("DeleteProject", err)
 	} else {
@@ -114,6 +130,7 @@ func (ccs *ConcourseCiSuite01) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s11
+	report.Start("DeleteUser")
 	if err := usr.DeleteUser(onEnvironment.Account); err != nil {
 		report.Failed("DeleteUser", err)
 	} else {
@@ -5,6 +5,7 @@ import (
 
 	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
 	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+	"github.com/vmware/harbor/tests/apitests/api-testing/tests/suites"
 	"github.com/vmware/harbor/tests/apitests/api-testing/tests/suites/base"
 )
 
@@ -25,11 +26,16 @@ type ConcourseCiSuite02 struct {
 	base.ConcourseCiSuite
 }
 
+func init() {
+	suites.Register("suite02", &ConcourseCiSuite02{})
+}
+
 //Run : Run a group of cases
 func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report {
-	report := &lib.Report{}
+	report := lib.NewReport(onEnvironment.Events)
 
 	//s0
+	report.Start("GetSystemInfo")
 	sys := lib.NewSystemUtil(onEnvironment.RootURI(), onEnvironment.Hostname, onEnvironment.HTTPClient)
 	if err := sys.GetSystemInfo(); err != nil {
 		report.Failed("GetSystemInfo", err)
@@ -38,6 +44,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s1
+	report.Start("CreateProject")
 	pro := lib.NewProjectUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
 	if err := pro.CreateProject(onEnvironment.TestingProject, false); err != nil {
 		report.Failed("CreateProject", err)
@@ -46,6 +53,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s2
+	report.Start("AssignRole")
 	if err := pro.AssignRole(onEnvironment.TestingProject, onEnvironment.Account); err != nil {
 		report.Failed("AssignRole", err)
 	} else {
@@ -53,6 +61,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s3
+	report.Start("pushImage")
 	if err := ccs.PushImage(onEnvironment); err != nil {
 		report.Failed("pushImage", err)
 	} else {
@@ -60,6 +69,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s4
+	report.Start("ScanTag")
 	img := lib.NewImageUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
 	repoName := fmt.Sprintf("%s/%s", onEnvironment.TestingProject, onEnvironment.ImageName)
 	if err := img.ScanTag(repoName, onEnvironment.ImageTag); err != nil {
@@ -69,6 +79,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s5
+	report.Start("pullImage[1]")
 	if err := ccs.PullImage(onEnvironment); err != nil {
 		report.Failed("pullImage[1]", err)
 	} else {
@@ -76,6 +87,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s6
+	report.Start("RevokeRole")
 	if err := pro.RevokeRole(onEnvironment.TestingProject, onEnvironment.Account); err != nil {
 		report.Failed("RevokeRole", err)
 	} else {
@@ -83,6 +95,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s7
+	report.Start("pullImage[2]")
 	if err := ccs.PullImage(onEnvironment); err == nil {
 		report.Failed("pullImage[2]", err)
 	} else {
@@ -90,6 +103,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s8
+	report.Start("DeleteRepo")
 	if err := img.DeleteRepo(repoName); err != nil {
 		report.Failed("DeleteRepo", err)
 	} else {
@@ -97,6 +111,7 @@ func (ccs *ConcourseCiSuite02) Run(onEnvironment *envs.Environment) *lib.Report
 	}
 
 	//s9
+	report.Start("DeleteProject")
 	if err := pro.DeleteProject(onEnvironment.TestingProject); err != nil {
 		report.Failed("DeleteProject", err)
 	} else {
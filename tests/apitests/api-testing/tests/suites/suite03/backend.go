@@ -0,0 +1,100 @@
+package suite03
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+//StubUser : The user a stub token authenticates as
+type StubUser struct {
+	Username string   `json:"username"`
+	UID      string   `json:"uid"`
+	Groups   []string `json:"groups"`
+}
+
+//StubBackend : A kubernetes-auth TokenReview endpoint authenticating the tokens of a fixture,
+//so the Rackspace provider of the Harbor under test can be pointed at it in CI with
+//RACKSPACE_MK8S_AUTH_URL=http://<address of the test runner>
+type StubBackend struct {
+	//Tokens maps the accepted tokens to their users, any other token is unauthenticated
+	Tokens map[string]StubUser
+
+	listener net.Listener
+	server   *http.Server
+}
+
+//NewStubBackend : Constructor, the tokens are read from a JSON fixture
+func NewStubBackend(fixture []byte) (*StubBackend, error) {
+	tokens := make(map[string]StubUser)
+	if err := json.Unmarshal(fixture, &tokens); err != nil {
+		return nil, fmt.Errorf("Failed to parse stub tokens: %s", err)
+	}
+
+	return &StubBackend{Tokens: tokens}, nil
+}
+
+//Start : Serve the TokenReviews on addr, e.g. ":8090", and return the URL of the backend
+func (sb *StubBackend) Start(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	sb.listener = l
+	sb.server = &http.Server{Handler: sb}
+	go sb.server.Serve(l)
+
+	return fmt.Sprintf("http://%s", l.Addr().String()), nil
+}
+
+//Close : Stop serving
+func (sb *StubBackend) Close() error {
+	if sb.server == nil {
+		return nil
+	}
+	return sb.server.Close()
+}
+
+//ServeHTTP : Answer a TokenReview like kubernetes-auth does
+func (sb *StubBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Spec       struct {
+			Token string `json:"token"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(body, &review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := sb.Tokens[review.Spec.Token]
+	if !ok {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"apiVersion": review.APIVersion,
+		"kind":       review.Kind,
+		"status": map[string]interface{}{
+			"authenticated": true,
+			"user": map[string]interface{}{
+				"username": user.Username,
+				"uid":      user.UID,
+				"groups":   user.Groups,
+			},
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,52 @@
+package suite03
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestStubBackend(t *testing.T) {
+	if _, err := startBackend(""); err == nil {
+		t.Fatal("expect an error without an address")
+	}
+
+	backend, err := startBackend("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	url := "http://" + backend.listener.Addr().String()
+
+	review := func(token string) *http.Response {
+		body := []byte(`{"apiVersion":"authentication.k8s.io/v1","kind":"TokenReview","spec":{"token":"` + token + `"}}`)
+		resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := review("stub-token-dev")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect 200 for a fixture token but got %d", resp.StatusCode)
+	}
+	tr := struct {
+		Status struct {
+			Authenticated bool     `json:"authenticated"`
+			User          StubUser `json:"user"`
+		} `json:"status"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.Status.Authenticated || tr.Status.User.Username != "rackspace-dev" {
+		t.Fatalf("expect rackspace-dev to be authenticated but got %+v", tr.Status)
+	}
+
+	if resp := review("not-a-stub-token"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect 401 for an unknown token but got %d", resp.StatusCode)
+	}
+}
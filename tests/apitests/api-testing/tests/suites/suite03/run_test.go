@@ -0,0 +1,30 @@
+package suite03
+
+import (
+	"os"
+	"testing"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+)
+
+//TestRun : Start to run the case, skipped unless the Harbor under test and its certificates are set up
+func TestRun(t *testing.T) {
+	if os.Getenv("TESTING_ENV_HOSTNAME") == "" {
+		t.Skip("TESTING_ENV_HOSTNAME is not set, no Harbor to test")
+	}
+	if _, err := os.Stat(envs.ConcourseCIRackspaceEnv.CertFile); os.IsNotExist(err) {
+		t.Skipf("%s is missing, no certificates of the Harbor to test", envs.ConcourseCIRackspaceEnv.CertFile)
+	}
+
+	//Initialize env
+	if err := envs.ConcourseCIRackspaceEnv.Load(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	suite := ConcourseCiSuite03{}
+	report := suite.Run(&envs.ConcourseCIRackspaceEnv)
+	report.Print()
+	if report.IsFail() {
+		t.Fail()
+	}
+}
@@ -0,0 +1,173 @@
+package suite03
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/vmware/harbor/tests/apitests/api-testing/envs"
+	"github.com/vmware/harbor/tests/apitests/api-testing/lib"
+	"github.com/vmware/harbor/tests/apitests/api-testing/tests/suites"
+	"github.com/vmware/harbor/tests/apitests/api-testing/tests/suites/base"
+)
+
+//go:embed testdata
+var fixtures embed.FS
+
+//Steps of suite03:
+//  s0: start the stub auth backend
+//  s1: Get systeminfo
+//  s2: login with the token of the account, which creates the user
+//  s3: create project as the account
+//  s4: push a busybox image to project
+//  s5: pull image from project
+//  s6: remove repository busybox
+//  s7: delete project
+//  s8: delete the user created by the login
+
+//ConcourseCiSuite03 : For the harbor rackspace auth journey in concourse pipeline.
+//The stub backend listens on the AuthBackend address of the environment, set with
+//TESTING_AUTH_BACKEND_ADDR, e.g. ":8090". The Harbor under test must be configured with:
+//  auth_mode = rackspace_mk8s_auth in harbor.cfg
+//  project_creation_restriction = everyone in harbor.cfg, the account creates a project
+//  RACKSPACE_MK8S_AUTH_URL in the env of the ui container, the URL of the stub as reached
+//  from Harbor, e.g. http://<test runner>:8090
+//and the account's password must be one of the tokens of testdata/tokens.json.
+type ConcourseCiSuite03 struct {
+	base.ConcourseCiSuite
+}
+
+func init() {
+	suites.Register("suite03", &ConcourseCiSuite03{})
+}
+
+//Run : Run a group of cases
+func (ccs *ConcourseCiSuite03) Run(onEnvironment *envs.Environment) *lib.Report {
+	report := lib.NewReport(onEnvironment.Events)
+
+	//s0
+	report.Start("StartAuthBackend")
+	backend, err := startBackend(onEnvironment.AuthBackend)
+	if err != nil {
+		report.Failed("StartAuthBackend", err)
+		return report
+	}
+	defer backend.Close()
+	report.Passed("StartAuthBackend")
+
+	//s1
+	report.Start("GetSystemInfo")
+	sys := lib.NewSystemUtil(onEnvironment.RootURI(), onEnvironment.Hostname, onEnvironment.HTTPClient)
+	if err := sys.GetSystemInfo(); err != nil {
+		report.Failed("GetSystemInfo", err)
+	} else {
+		report.Passed("GetSystemInfo")
+	}
+
+	//s2
+	report.Start("LoginWithToken")
+	onEnvironment.HTTPClient.SwitchAccount(onEnvironment.Account, onEnvironment.Password)
+	usr := lib.NewUserUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
+	if err := checkCurrentUser(usr, backend, onEnvironment); err != nil {
+		report.Failed("LoginWithToken", err)
+	} else {
+		report.Passed("LoginWithToken")
+	}
+
+	//s3
+	report.Start("CreateProject")
+	pro := lib.NewProjectUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
+	if err := pro.CreateProject(onEnvironment.TestingProject, false); err != nil {
+		report.Failed("CreateProject", err)
+	} else {
+		report.Passed("CreateProject")
+	}
+
+	//s4
+	report.Start("pushImage")
+	if err := ccs.PushImage(onEnvironment); err != nil {
+		report.Failed("pushImage", err)
+	} else {
+		report.Passed("pushImage")
+	}
+
+	//s5
+	report.Start("pullImage")
+	if err := ccs.PullImage(onEnvironment); err != nil {
+		report.Failed("pullImage", err)
+	} else {
+		report.Passed("pullImage")
+	}
+
+	//The cleanup needs the admin
+	onEnvironment.HTTPClient.SwitchAccount(onEnvironment.Admin, onEnvironment.AdminPass)
+
+	//s6
+	report.Start("DeleteRepo")
+	img := lib.NewImageUtil(onEnvironment.RootURI(), onEnvironment.HTTPClient)
+	repoName := fmt.Sprintf("%s/%s", onEnvironment.TestingProject, onEnvironment.ImageName)
+	if err := img.DeleteRepo(repoName); err != nil {
+		report.Failed("DeleteRepo", err)
+	} else {
+		report.Passed("DeleteRepo")
+	}
+
+	//s7
+	report.Start("DeleteProject")
+	if err := pro.DeleteProject(onEnvironment.TestingProject); err != nil {
+		report.Failed("DeleteProject", err)
+	} else {
+		report.Passed("DeleteProject")
+	}
+
+	//s8
+	report.Start("DeleteUser")
+	if err := usr.DeleteUser(onEnvironment.Account); err != nil {
+		report.Failed("DeleteUser", err)
+	} else {
+		report.Passed("DeleteUser")
+	}
+
+	return report
+}
+
+//Start the stub backend with the tokens fixture on addr
+func startBackend(addr string) (*StubBackend, error) {
+	if len(addr) == 0 {
+		return nil, errors.New("No address to start the stub auth backend on, TESTING_AUTH_BACKEND_ADDR is not set")
+	}
+
+	data, err := suites.NewFixtures(fixtures).Read("testdata/tokens.json")
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := NewStubBackend(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := backend.Start(addr); err != nil {
+		return nil, err
+	}
+
+	return backend, nil
+}
+
+//Check the token of the account logs in as the user the stub backend has for it
+func checkCurrentUser(usr *lib.UserUtil, backend *StubBackend, onEnvironment *envs.Environment) error {
+	expected, ok := backend.Tokens[onEnvironment.Password]
+	if !ok {
+		return fmt.Errorf("The password of %s is not a stub token", onEnvironment.Account)
+	}
+
+	current, err := usr.GetCurrentUser()
+	if err != nil {
+		return err
+	}
+	if current.Username != expected.Username {
+		return fmt.Errorf("Expect to be logged in as %s but got %s", expected.Username, current.Username)
+	}
+
+	return nil
+}
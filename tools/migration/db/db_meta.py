@@ -25,6 +25,7 @@ class User(Base):
     sysadmin_flag = sa.Column(sa.Integer)
     creation_time = sa.Column(mysql.TIMESTAMP)
     update_time = sa.Column(mysql.TIMESTAMP)
+    external_id = sa.Column(sa.String(255), index=True)
 
 
 class UserGroup(Base):
@@ -38,6 +39,14 @@ class UserGroup(Base):
     update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
 
 
+class UserGroupMember(Base):
+    __tablename__ = 'user_group_member'
+
+    user_id = sa.Column(sa.Integer, nullable=False, primary_key=True)
+    group_id = sa.Column(sa.Integer, nullable=False, primary_key=True)
+    creation_time = sa.Column(mysql.TIMESTAMP, server_default=sa.text("CURRENT_TIMESTAMP"))
+
+
 class Properties(Base):
     __tablename__ = 'properties'
 
@@ -0,0 +1,47 @@
+# Copyright (c) 2008-2018 VMware, Inc. All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""1.5.0 to 1.5.1
+
+Revision ID: 1.5.1
+Revises:
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '1.5.1'
+down_revision = '1.5.0'
+branch_labels = None
+depends_on = None
+
+from alembic import op
+from db_meta import *
+
+def upgrade():
+    """
+    update schema&data
+    """
+    bind = op.get_bind()
+
+    # create user_group_member
+    UserGroupMember.__table__.create(bind)
+
+    # add external_id to user
+    op.add_column('user', sa.Column('external_id', sa.String(255)))
+    op.create_index('idx_external_id', 'user', ['external_id'])
+
+def downgrade():
+    """
+    Downgrade has been disabled.
+    """